@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"github.com/koushamad/blockchain/Handler"
+	"time"
 )
 
 type Block struct {
@@ -11,31 +12,56 @@ type Block struct {
 	Transactions []*Transaction
 	PrevHash     []byte
 	Nonce        int
+	Height       int
+	Timestamp    int64
+	Algorithm    string
+	Signer       []byte
+	Signature    []byte
+	Vote         Vote
 }
 
-func Genesis(coinbase *Transaction) *Block {
-	return CreateBlock([]*Transaction{coinbase}, []byte{})
+func Genesis(coinbase *Transaction, algorithm string) *Block {
+	block := NewBlock([]*Transaction{coinbase}, []byte{}, 0)
+	err := ProofOfWorkConsensus{Algorithm: algorithm}.Seal(block, nil)
+	Handler.Handle(err)
+
+	return block
 }
 
-func CreateBlock(txs []*Transaction, prevHash []byte) *Block {
-	block := &Block{[]byte{}, txs, prevHash, 0}
+func CreateBlock(txs []*Transaction, prevHash []byte, height int) *Block {
+	block, _ := CreateBlockUntil(txs, prevHash, height, nil)
+
+	return block
+}
+
+func NewBlock(txs []*Transaction, prevHash []byte, height int) *Block {
+	return &Block{Hash: []byte{}, Transactions: txs, PrevHash: prevHash, Height: height, Timestamp: time.Now().Unix()}
+}
+
+func CreateBlockUntil(txs []*Transaction, prevHash []byte, height int, quit <-chan struct{}) (*Block, bool) {
+	block := NewBlock(txs, prevHash, height)
 	pow := NewProof(block)
-	nonce, hash := pow.Run()
+	nonce, hash, ok := pow.RunUntil(quit)
 
 	block.Nonce = nonce
 	block.Hash = hash
 
-	return block
+	return block, ok
 }
 
+// HashTransactions returns the merkle root of the transactions, a block
+// without transactions has none and its nil root matches no header.
 func (b Block) HashTransactions() []byte {
 	var txHashes [][]byte
 
 	for _, tx := range b.Transactions {
-		txHashes = append(txHashes, tx.Serialize())
+		txHashes = append(txHashes, tx.HashData())
 	}
 
-	tree := NewMerkleTree(txHashes)
+	tree, err := NewMerkleTree(txHashes)
+	if err != nil {
+		return nil
+	}
 
 	return tree.RootNode.Data
 }
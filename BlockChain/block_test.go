@@ -0,0 +1,181 @@
+package BlockChain
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestTransactionHash(t *testing.T) {
+	tx := Transaction{nil, []TxInput{{[]byte{1, 2}, 1, []byte{3}, SequenceFinal}}, []TXOutput{{5, []byte{4}}}, 7}
+
+	want := "774556022d1281907f0488947d780c8c6b1ce1bae728caeae4dec6e345584b05"
+	if got := hex.EncodeToString(tx.Hash()); got != want {
+		t.Errorf("transaction hash is %s, want %s", got, want)
+	}
+
+	shifted := Transaction{nil, []TxInput{{[]byte{1}, 1, []byte{2, 3}, SequenceFinal}}, []TXOutput{{5, []byte{4}}}, 7}
+	if hex.EncodeToString(shifted.Hash()) == want {
+		t.Error("moving a byte from the input ID to the script does not change the hash")
+	}
+}
+
+func TestNewMerkleTree(t *testing.T) {
+	if _, err := NewMerkleTree(nil); err == nil {
+		t.Error("built a merkle tree without leaves")
+	}
+
+	one, err := NewMerkleTree([][]byte{[]byte("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	two, err := NewMerkleTree([][]byte{[]byte("a"), []byte("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(one.RootNode.Data) != string(two.RootNode.Data) {
+		t.Error("a single leaf is not paired with itself")
+	}
+
+	three, err := NewMerkleTree([][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped, err := NewMerkleTree([][]byte{[]byte("b"), []byte("a"), []byte("c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(three.RootNode.Data) == string(swapped.RootNode.Data) {
+		t.Error("merkle root does not depend on the order of the leaves")
+	}
+}
+
+func TestMerkleBranch(t *testing.T) {
+	for count := 1; count <= 7; count++ {
+		var leaves [][]byte
+		for i := 0; i < count; i++ {
+			leaves = append(leaves, []byte{byte(i)})
+		}
+
+		tree, err := NewMerkleTree(leaves)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for index := range leaves {
+			root := MerkleRootFromBranch(leaves[index], index, MerkleBranch(leaves, index))
+			if string(root) != string(tree.RootNode.Data) {
+				t.Errorf("branch for leaf %d of %d does not lead to the merkle root", index, count)
+			}
+		}
+
+		if count > 1 {
+			root := MerkleRootFromBranch([]byte("forged"), 0, MerkleBranch(leaves, 0))
+			if string(root) == string(tree.RootNode.Data) {
+				t.Errorf("a forged first leaf of %d leads to the merkle root", count)
+			}
+		}
+	}
+}
+
+func TestMineBlockRejectsInvalidTransactions(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	coin := TxInput{ID: genesis.ID, Out: 0, Sequence: SequenceFinal}
+	coinbase := func(value int) *Transaction {
+		return NewCoinbaseTX(aliceAddress, "", value)
+	}
+	signed := func(inputs []TxInput, values ...int) *Transaction {
+		tx := &Transaction{Inputs: inputs}
+		for _, value := range values {
+			tx.Outputs = append(tx.Outputs, *NewTXOutput(value, aliceAddress))
+		}
+		tx.ID = tx.Hash()
+		chain.SignTransaction(tx, alice.PrivateKey)
+		return tx
+	}
+	payment := signed([]TxInput{coin}, BlockSubsidy-1)
+
+	tests := []struct {
+		name string
+		txs  []*Transaction
+		ok   bool
+	}{
+		{"coinbase only", []*Transaction{coinbase(BlockSubsidy)}, true},
+		{"no transactions", nil, false},
+		{"nil transaction", []*Transaction{nil}, false},
+		{"no coinbase", []*Transaction{payment}, false},
+		{"coinbase after a payment", []*Transaction{payment, coinbase(BlockSubsidy)}, false},
+		{"two coinbases", []*Transaction{coinbase(BlockSubsidy), coinbase(BlockSubsidy)}, false},
+		{"coinbase pays too much", []*Transaction{coinbase(BlockSubsidy + 2), payment}, false},
+		{"transaction twice", []*Transaction{coinbase(BlockSubsidy), payment, payment}, false},
+		{"double spend", []*Transaction{coinbase(BlockSubsidy), payment, signed([]TxInput{coin}, BlockSubsidy-2)}, false},
+		{"duplicate inputs", []*Transaction{coinbase(BlockSubsidy), signed([]TxInput{coin, coin}, 2*BlockSubsidy)}, false},
+		{"negative output", []*Transaction{coinbase(BlockSubsidy), signed([]TxInput{coin}, BlockSubsidy+5, -5)}, false},
+		{"zero output", []*Transaction{coinbase(BlockSubsidy), signed([]TxInput{coin}, BlockSubsidy, 0)}, false},
+		{"coinbase with fees", []*Transaction{coinbase(BlockSubsidy + 1), payment}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			height := chain.GetBestHeight()
+
+			_, err := chain.MineBlock(test.txs, nil)
+			if test.ok != (err == nil) {
+				t.Fatalf("got error %v, want success %t", err, test.ok)
+			}
+			if !test.ok && chain.GetBestHeight() != height {
+				t.Error("rejected block was stored")
+			}
+		})
+	}
+}
+
+func TestConnectBlockRejectsEmptyBlocks(t *testing.T) {
+	_, address := newTestWallet()
+	chain := newTestChain(t, address)
+
+	for _, txs := range [][]*Transaction{nil, {}} {
+		block := NewBlock(txs, chain.LastHash, 1)
+		if err := chain.ConnectBlock(block); err == nil {
+			t.Error("connected a block without transactions")
+		}
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	_, address := newTestWallet()
+	chain := newTestChain(t, address)
+	for i := 0; i < 3; i++ {
+		mineTransactions(t, chain, address)
+	}
+
+	median, err := chain.MedianTimePast(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		ok        bool
+	}{
+		{"after the median", median + 1, true},
+		{"at the median", median, false},
+		{"before the median", median - 1, false},
+		{"within the future limit", now + MaxFutureBlockTime - 60, true},
+		{"beyond the future limit", now + MaxFutureBlockTime + 60, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := chain.CheckTimestamp(test.timestamp, chain.LastHash)
+			if test.ok != (err == nil) {
+				t.Errorf("got error %v, want success %t", err, test.ok)
+			}
+		})
+	}
+}
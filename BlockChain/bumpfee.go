@@ -0,0 +1,95 @@
+package BlockChain
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/Wallet"
+)
+
+// NewReplacement replaces a mempool transaction with one paying fee. The fee
+// increase comes out of a change output of the wallet, when none is large
+// enough confirmed wallet coins are added as inputs and what they pay beyond
+// the increase goes back as change.
+func NewReplacement(wallets *Wallet.Wallets, entry MempoolEntry, fee int, UTXO *UTXOSet) (*Transaction, error) {
+	if !entry.Tx.SignalsReplacement() {
+		return nil, errors.New("transaction does not signal replacement, use -method cpfp")
+	}
+
+	if fee <= entry.Fee {
+		return nil, fmt.Errorf("new fee must be higher than the current fee %d", entry.Fee)
+	}
+
+	tx := entry.Tx.TrimmedCopy()
+	increase := fee - entry.Fee
+
+	change := -1
+	for outIdx, out := range tx.Outputs {
+		if wallets.IsChange(ScriptAddress(out.ScriptPubKey)) && (change < 0 || out.Value > tx.Outputs[change].Value) {
+			change = outIdx
+		}
+	}
+
+	if change >= 0 && tx.Outputs[change].Value >= increase {
+		tx.Outputs[change].Value -= increase
+		if tx.Outputs[change].Value == 0 {
+			tx.Outputs = append(tx.Outputs[:change], tx.Outputs[change+1:]...)
+		}
+	} else {
+		coins, _ := walletCoins(wallets, UTXO)
+		selected, err := SelectCoins(coins, increase, TxOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("no change output can pay the fee increase of %d and the wallet has no coins to add: %s", increase, err)
+		}
+
+		for _, coin := range selected {
+			tx.Inputs = append(tx.Inputs, TxInput{ID: coin.TxID, Out: coin.Index, Sequence: SequenceReplaceable})
+		}
+
+		if rest := total(selected) - increase; rest > 0 && change >= 0 {
+			tx.Outputs[change].Value += rest
+		} else if rest > 0 {
+			tx.Outputs = append(tx.Outputs, TXOutput{rest, selected[0].Output.ScriptPubKey})
+		}
+	}
+	tx.ID = tx.Hash()
+
+	keys, err := walletKeys(UTXO.Chain, wallets, &tx)
+	if err != nil {
+		return nil, err
+	}
+	UTXO.Chain.SignTransactionWithKeys(&tx, keys)
+
+	return &tx, nil
+}
+
+// walletKeys returns the keys of the wallet owning the outputs spent by the
+// inputs, the previous transactions may still be in the mempool.
+func walletKeys(chain *Chain, wallets *Wallet.Wallets, tx *Transaction) ([]ecdsa.PrivateKey, error) {
+	var keys []ecdsa.PrivateKey
+	mempool := Mempool{Chain: chain}
+
+	for inId, in := range tx.Inputs {
+		prevTx, err := chain.FindTransaction(in.ID)
+		if err != nil {
+			entry, ok := mempool.Get(in.ID)
+			if !ok {
+				return nil, err
+			}
+			prevTx = entry.Tx
+		}
+
+		if in.Out < 0 || in.Out >= len(prevTx.Outputs) {
+			return nil, fmt.Errorf("input %d spends output %d of %x which does not exist", inId, in.Out, in.ID)
+		}
+
+		address := ScriptAddress(prevTx.Outputs[in.Out].ScriptPubKey)
+		w, ok := wallets.Wallets[address]
+		if !ok {
+			return nil, fmt.Errorf("input %d is not owned by a wallet key", inId)
+		}
+		keys = append(keys, w.PrivateKey)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,83 @@
+package BlockChain
+
+import (
+	"github.com/koushamad/blockchain/Wallet"
+	"strings"
+	"testing"
+)
+
+func TestNewReplacement(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	change, changeAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	UTXO := UTXOSet{Chain: chain}
+	mempool := Mempool{Chain: chain}
+
+	wallets := &Wallet.Wallets{
+		Wallets: map[string]*Wallet.Wallet{aliceAddress: alice, changeAddress: change},
+		Change:  map[string]bool{changeAddress: true},
+	}
+	genesis := chain.Iterator().Next().Transactions[0]
+
+	replaceable := func(outputs ...TXOutput) MempoolEntry {
+		t.Helper()
+		tx := &Transaction{
+			Inputs:  []TxInput{{ID: genesis.ID, Out: 0, Sequence: SequenceReplaceable}},
+			Outputs: outputs,
+		}
+		tx.ID = tx.Hash()
+		chain.SignTransaction(tx, alice.PrivateKey)
+		if err := mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+		entry, _ := mempool.Get(tx.ID)
+		return entry
+	}
+	replace := func(entry MempoolEntry, fee int) *Transaction {
+		t.Helper()
+		tx, err := NewReplacement(wallets, entry, fee, &UTXO)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mempool.Add(tx); err != nil {
+			t.Fatalf("replacement was rejected: %s", err)
+		}
+		if replaced, _ := mempool.Get(tx.ID); replaced.Fee != fee {
+			t.Errorf("replacement pays %d, want %d", replaced.Fee, fee)
+		}
+		return tx
+	}
+
+	final := respend(chain, alice, OutPoint{genesis.ID, 0}, BlockSubsidy, 1)
+	if _, err := NewReplacement(wallets, MempoolEntry{Tx: *final, Fee: 1}, 5, &UTXO); err == nil {
+		t.Error("replaced a transaction that does not signal replacement")
+	}
+
+	withChange := replaceable(*NewTXOutput(5, bobAddress), *NewTXOutput(BlockSubsidy-6, changeAddress))
+	if _, err := NewReplacement(wallets, withChange, 1, &UTXO); err == nil {
+		t.Error("replacement does not pay more than the original")
+	}
+	tx := replace(withChange, 3)
+	if len(tx.Inputs) != 1 || tx.Outputs[1].Value != BlockSubsidy-8 {
+		t.Errorf("fee increase was not taken from the change output: %d inputs, change %d", len(tx.Inputs), tx.Outputs[1].Value)
+	}
+	mempool.Clear()
+
+	noChange := replaceable(*NewTXOutput(BlockSubsidy-1, bobAddress))
+	_, err := NewReplacement(wallets, noChange, 5, &UTXO)
+	if err == nil || !strings.Contains(err.Error(), "no change output") {
+		t.Errorf("got error %v, want one explaining there is no change to take the fee from", err)
+	}
+	mempool.Clear()
+
+	mineTransactions(t, chain, aliceAddress)
+	noChange = replaceable(*NewTXOutput(BlockSubsidy-1, bobAddress))
+	tx = replace(noChange, 5)
+	if len(tx.Inputs) != 2 || len(tx.Outputs) != 2 || tx.Outputs[1].Value != BlockSubsidy-4 {
+		t.Errorf("replacement has %d inputs and %d outputs, want an added input with change", len(tx.Inputs), len(tx.Outputs))
+	}
+	if !tx.SignalsReplacement() {
+		t.Error("replacement does not signal replacement itself")
+	}
+}
@@ -9,65 +9,103 @@ import (
 	"github.com/dgraph-io/badger"
 	"github.com/koushamad/blockchain/Handler"
 	"github.com/koushamad/blockchain/Wallet"
+	"math"
 	"os"
+	"path/filepath"
 	"runtime"
-)
-
-const (
-	dbPath      = "./tmp/blocks"
-	dbFile      = "./tmp/blocks/MANIFEST"
-	genesisData = "First Transaction from Genesis"
+	"sort"
+	"time"
 )
 
 type Chain struct {
-	LastHash []byte
-	Database *badger.DB
+	LastHash  []byte
+	Database  *badger.DB
+	Params    *Params
+	Consensus Consensus
+	Headers   HeaderIndex
 }
 
-func DBExists() bool {
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+func DBExists(params *Params) bool {
+	if _, err := os.Stat(filepath.Join(params.DBPath, "MANIFEST")); os.IsNotExist(err) {
 		return false
 	}
 
 	return true
 }
 
-func InitBlockChain(address string) *Chain {
-	if DBExists() {
+func InitBlockChain(address string, params *Params) *Chain {
+	return InitBlockChainWithConsensus(address, params, ConsensusConfig{Engine: ProofOfWorkEngine})
+}
+
+func InitBlockChainWithConsensus(address string, params *Params, config ConsensusConfig) *Chain {
+	if DBExists(params) {
 		fmt.Println("Blockchain already exist")
 		runtime.Goexit()
 	}
 
-	var lastHash []byte
+	gbtx := CoinbaseTX(address, params.GenesisData)
+	genesis := Genesis(gbtx, params.PowAlgorithm)
+
+	return initBlockChain(genesis, params, config)
+}
+
+// InitBlockChainFromGenesis creates the database of a node joining a network
+// with the genesis block and consensus config of one of its peers.
+func InitBlockChainFromGenesis(genesis *Block, params *Params, config ConsensusConfig) (*Chain, error) {
+	if DBExists(params) {
+		return nil, errors.New("blockchain already exists")
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if genesis.Height != 0 || len(genesis.PrevHash) != 0 {
+		return nil, errors.New("block is not a genesis block")
+	}
+
+	if err := (ProofOfWorkConsensus{Algorithm: params.PowAlgorithm}).Verify(genesis); err != nil {
+		return nil, err
+	}
+
+	if err := (&Chain{Params: params}).CheckCheckpoint(0, genesis.Hash); err != nil {
+		return nil, err
+	}
+
+	return initBlockChain(genesis, params, config), nil
+}
 
-	opts := badger.DefaultOptions(dbPath)
+func initBlockChain(genesis *Block, params *Params, config ConsensusConfig) *Chain {
+	err := os.MkdirAll(params.DBPath, 0755)
+	Handler.Handle(err)
+
+	opts := badger.DefaultOptions(params.DBPath)
 	db, err := badger.Open(opts)
 	Handler.Handle(err)
 
 	err = db.Update(func(txn *badger.Txn) error {
-		gbtx := CoinbaseTX(address, genesisData)
-		genesis := Genesis(gbtx)
 		err = txn.Set(genesis.Hash, genesis.Serialize())
 		Handler.Handle(err)
-		err = txn.Set([]byte("lh"), genesis.Hash)
-		lastHash = genesis.Hash
-		return err
+		err = txn.Set(consensusKey, config.Serialize())
+		Handler.Handle(err)
+		return txn.Set([]byte("lh"), genesis.Hash)
 	})
 
 	Handler.Handle(err)
-	chain := Chain{lastHash, db}
+	chain := Chain{LastHash: genesis.Hash, Database: db, Params: params}
+	chain.Consensus = NewConsensus(&chain, config)
 	return &chain
 }
 
-func ContinueBlockChain(address string) *Chain {
-	if DBExists() == false {
+func ContinueBlockChain(params *Params) *Chain {
+	if DBExists(params) == false {
 		fmt.Println("No existing blockchain found, create one!")
 		runtime.Goexit()
 	}
 
 	var lastHash []byte
 
-	opts := badger.DefaultOptions(dbPath)
+	opts := badger.DefaultOptions(params.DBPath)
 	db, err := badger.Open(opts)
 	Handler.Handle(err)
 
@@ -83,49 +121,255 @@ func ContinueBlockChain(address string) *Chain {
 	})
 	Handler.Handle(err)
 
-	chain := Chain{lastHash, db}
+	chain := Chain{LastHash: lastHash, Database: db, Params: params}
+	chain.Consensus = NewConsensus(&chain, loadConsensusConfig(db))
 	return &chain
 }
 
-func NewTransaction(from, to string, amount int, UTXO *UTXOSet) *Transaction {
-	var inputs []TxInput
-	var outputs []TXOutput
+const (
+	MedianTimeSpan     = 11
+	MaxFutureBlockTime = 2 * 60 * 60
+)
+
+var ErrMiningInterrupted = errors.New("mining interrupted")
+
+type TxOptions struct {
+	LockTime         int64
+	RelativeLockTime int64
+	CoinSelection    string
+	Coins            []OutPoint
+	ChangeAddress    string
+	Fee              int
+	FeeRate          float64
+	FeeTarget        int
+	Replaceable      bool
+}
 
+func NewTransaction(from, to string, amount int, UTXO *UTXOSet) *Transaction {
 	wallets, err := Wallet.CreateWallets()
 	Handler.Handle(err)
+
+	return NewTransactionWithOptions(wallets, from, to, amount, UTXO, TxOptions{})
+}
+
+// The functions funding a transaction from the wallet take the loaded wallets,
+// loading an encrypted wallet runs scrypt so it is done once by the caller.
+func NewTransactionWithOptions(wallets *Wallet.Wallets, from, to string, amount int, UTXO *UTXOSet, options TxOptions) *Transaction {
 	w := wallets.GetWallet(from)
-	pubKeyHash := Wallet.PublicKeyHash(w.PublicKey)
 
-	acc, validOptions := UTXO.FindSpendableOutputs(pubKeyHash, amount)
+	tx := NewUnsignedTransaction(wallets, from, to, amount, UTXO, options)
+	UTXO.Chain.SignTransaction(tx, w.PrivateKey)
 
-	if acc < amount {
-		Handler.Handle(errors.New("not enough funds"))
+	return tx
+}
+
+type Payment struct {
+	Address string
+	Amount  int
+}
+
+func NewPaymentTransaction(wallets *Wallet.Wallets, from string, payments []Payment, UTXO *UTXOSet, options TxOptions) (*Transaction, error) {
+	var outputs []TXOutput
+
+	if len(payments) == 0 {
+		return nil, errors.New("no payments to send")
 	}
 
-	for txid, outs := range validOptions {
-		txID, err := hex.DecodeString(txid)
-		Handler.Handle(err)
+	for i, payment := range payments {
+		if payment.Amount <= 0 {
+			return nil, fmt.Errorf("payment %d to %s has a non-positive amount", i, payment.Address)
+		}
 
-		for _, out := range outs {
-			input := TxInput{ID: txID, Out: out, PubKey: w.PublicKey}
-			inputs = append(inputs, input)
+		if !Wallet.ValidateAddress(payment.Address) {
+			return nil, fmt.Errorf("payment %d has an invalid address %s", i, payment.Address)
 		}
+
+		outputs = append(outputs, *NewTXOutput(payment.Amount, payment.Address))
+	}
+
+	w := wallets.GetWallet(from)
+
+	tx := FundFromWallet(wallets, from, outputs, UTXO, options)
+	UTXO.Chain.SignTransaction(tx, w.PrivateKey)
+
+	return tx, nil
+}
+
+func NewUnsignedTransaction(wallets *Wallet.Wallets, from, to string, amount int, UTXO *UTXOSet, options TxOptions) *Transaction {
+	output, err := NewPaymentOutput(to, amount, options)
+	Handler.Handle(err)
+
+	return FundFromWallet(wallets, from, []TXOutput{*output}, UTXO, options)
+}
+
+func NewPaymentOutput(to string, amount int, options TxOptions) (*TXOutput, error) {
+	switch {
+	case options.LockTime != 0 && options.RelativeLockTime != 0:
+		return nil, errors.New("use either an absolute or a relative lock time")
+	case options.LockTime != 0:
+		return NewTimeLockedTXOutput(amount, to, options.LockTime), nil
+	case options.RelativeLockTime != 0:
+		return NewRelativeLockedTXOutput(amount, to, options.RelativeLockTime), nil
 	}
 
-	outputs = append(outputs, *NewTXOutput(amount, to))
+	return NewTXOutput(amount, to), nil
+}
+
+func FundFromWallet(wallets *Wallet.Wallets, from string, outputs []TXOutput, UTXO *UTXOSet, options TxOptions) *Transaction {
+	if _, ok := wallets.Wallets[from]; !ok || options.ChangeAddress != "" {
+		return FundTransaction(from, outputs, UTXO, options)
+	}
+
+	options.ChangeAddress = wallets.PeekChangeAddress()
+	tx := FundTransaction(from, outputs, UTXO, options)
+
+	if len(tx.Outputs) > len(outputs) {
+		wallets.AddChangeWallet()
+		wallets.SaveFile()
+	}
+
+	return tx
+}
+
+func NewWalletTransaction(wallets *Wallet.Wallets, outputs []TXOutput, UTXO *UTXOSet, options TxOptions) (*Transaction, []string, error) {
+	var keys []ecdsa.PrivateKey
+	var sources []string
+
+	coins, owners := walletCoins(wallets, UTXO)
+
+	options = UTXO.withFeeEstimate(options)
+	change := options.ChangeAddress
+	if change == "" {
+		options.ChangeAddress = wallets.PeekChangeAddress()
+	}
+
+	tx, selected := fundCoins(coins, outputs, options)
+
+	drawn := make(map[string]bool)
+	for _, coin := range selected {
+		address := owners[coin.String()]
+		if !drawn[address] {
+			drawn[address] = true
+			sources = append(sources, address)
+			keys = append(keys, wallets.GetWallet(address).PrivateKey)
+		}
+	}
+	sort.Strings(sources)
+
+	if change == "" && len(tx.Outputs) > len(outputs) {
+		wallets.AddChangeWallet()
+		wallets.SaveFile()
+	}
+
+	UTXO.Chain.SignTransactionWithKeys(tx, keys)
+
+	return tx, sources, nil
+}
+
+// walletCoins returns the coins of every key in the wallet and the address
+// owning each of them.
+func walletCoins(wallets *Wallet.Wallets, UTXO *UTXOSet) ([]SpendableOutput, map[string]string) {
+	var coins []SpendableOutput
+
+	owners := make(map[string]string)
+	for address, w := range wallets.Wallets {
+		for _, coin := range UTXO.FindUnspentOutputs(Wallet.PublicKeyHash(w.PublicKey)) {
+			coins = append(coins, coin)
+			owners[coin.String()] = address
+		}
+	}
+	sortCoins(coins)
+
+	return coins, owners
+}
+
+func FundTransaction(from string, outputs []TXOutput, UTXO *UTXOSet, options TxOptions) *Transaction {
+	_, fromHash, err := Wallet.DecodeAddress(from)
+	Handler.Handle(err)
+
+	if options.ChangeAddress == "" {
+		options.ChangeAddress = from
+	}
+
+	tx, _ := fundCoins(UTXO.FindUnspentOutputs(fromHash), outputs, UTXO.withFeeEstimate(options))
+
+	return tx
+}
+
+func fundCoins(available []SpendableOutput, outputs []TXOutput, options TxOptions) (*Transaction, []SpendableOutput) {
+	if options.FeeRate <= 0 {
+		return fundCoinsWithFee(available, outputs, options)
+	}
+
+	for {
+		tx, coins := fundCoinsWithFee(available, outputs, options)
+
+		fee := int(math.Ceil(options.FeeRate * float64(tx.EstimateSignedSize())))
+		if fee <= options.Fee {
+			return tx, coins
+		}
+		options.Fee = fee
+	}
+}
+
+func fundCoinsWithFee(available []SpendableOutput, outputs []TXOutput, options TxOptions) (*Transaction, []SpendableOutput) {
+	var inputs []TxInput
+	var lockTime int64
+
+	outputs = append([]TXOutput(nil), outputs...)
+
+	amount := options.Fee
+	for _, out := range outputs {
+		amount += out.Value
+	}
+
+	coins, err := SelectCoins(available, amount, options)
+	Handler.Handle(err)
+
+	acc := 0
+	for _, coin := range coins {
+		input := TxInput{ID: coin.TxID, Out: coin.Index, Sequence: SequenceFinal}
+		acc += coin.Output.Value
+
+		lockOp, value, _ := SplitTimeLock(coin.Output.ScriptPubKey)
+		switch lockOp {
+		case OpCheckLockTimeVerify:
+			if lockTime != 0 && (lockTime < LockTimeThreshold) != (value < LockTimeThreshold) {
+				Handler.Handle(errors.New("cannot spend height and time locked outputs together"))
+			}
+			if value > lockTime {
+				lockTime = value
+			}
+			input.Sequence = SequenceFinal - 1
+		case OpCheckSequenceVerify:
+			input.Sequence = uint32(value)
+		}
+
+		if options.Replaceable && input.Sequence > SequenceReplaceable {
+			input.Sequence = SequenceReplaceable
+		}
+
+		inputs = append(inputs, input)
+	}
 
 	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from))
+		outputs = append(outputs, *NewTXOutput(acc-amount, options.ChangeAddress))
 	}
 
-	tx := Transaction{Inputs: inputs, Outputs: outputs}
+	tx := Transaction{Inputs: inputs, Outputs: outputs, LockTime: lockTime}
 	tx.ID = tx.Hash()
-	UTXO.Chain.SignTransaction(&tx, w.PrivateKey)
 
-	return &tx
+	return &tx, coins
 }
 
 func (chain *Chain) AddBlock(transactions []*Transaction) *Block {
+	block, err := chain.MineBlock(transactions, nil)
+	Handler.Handle(err)
+
+	return block
+}
+
+func (chain *Chain) MineBlock(transactions []*Transaction, quit <-chan struct{}) (*Block, error) {
 	var lastHash []byte
 
 	err := chain.Database.View(func(txn *badger.Txn) error {
@@ -142,20 +386,344 @@ func (chain *Chain) AddBlock(transactions []*Transaction) *Block {
 
 	Handler.Handle(err)
 
-	newBlock := CreateBlock(transactions, lastHash)
-	err = chain.Database.Update(func(txn *badger.Txn) error {
-		err = txn.Set(newBlock.Hash, newBlock.Serialize())
+	lastBlock, err := chain.GetBlock(lastHash)
+	Handler.Handle(err)
+	height := lastBlock.Height + 1
+
+	if err := checkCoinbase(transactions); err != nil {
+		return nil, err
+	}
+
+	blockTime, err := chain.NextBlockTime(lastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	median, err := chain.MedianTimePast(lastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := chain.CheckTransactions(transactions, height, blockTime, median); err != nil {
+		return nil, err
+	}
+
+	if err := chain.checkDraftBlock(transactions, lastHash, height, blockTime); err != nil {
+		return nil, err
+	}
+
+	newBlock := NewBlock(transactions, lastHash, height)
+	newBlock.Timestamp = blockTime
+
+	if err := chain.Consensus.Seal(newBlock, quit); err != nil {
+		return nil, err
+	}
+
+	if err := chain.CheckCheckpoint(newBlock.Height, newBlock.Hash); err != nil {
+		return nil, err
+	}
+
+	chain.storeBlock(newBlock)
+
+	return newBlock, nil
+}
+
+func (chain *Chain) ConnectBlock(block *Block) error {
+	lastBlock, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(block.PrevHash, lastBlock.Hash) || block.Height != lastBlock.Height+1 {
+		return errors.New("block does not extend the best chain")
+	}
+
+	if err := checkCoinbase(block.Transactions); err != nil {
+		return err
+	}
+
+	if err := chain.CheckTimestamp(block.Timestamp, block.PrevHash); err != nil {
+		return err
+	}
+
+	if err := chain.CheckCheckpoint(block.Height, block.Hash); err != nil {
+		return err
+	}
+
+	if err := chain.Consensus.Verify(block); err != nil {
+		return err
+	}
+
+	median, err := chain.MedianTimePast(block.PrevHash)
+	if err != nil {
+		return err
+	}
+
+	if err := chain.checkTransactions(block.Transactions, block.Height, block.Timestamp, median, !chain.assumedValid(block)); err != nil {
+		return err
+	}
+
+	if err := chain.CheckBlockLimits(block); err != nil {
+		return err
+	}
+
+	chain.storeBlock(block)
+
+	return nil
+}
+
+// MedianTimePast is the median timestamp of the block with the given hash and
+// the ones before it, a single miner with a wrong clock can not move it.
+func (chain *Chain) MedianTimePast(hash []byte) (int64, error) {
+	var timestamps []int64
+
+	for len(timestamps) < MedianTimeSpan {
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return 0, err
+		}
+		timestamps = append(timestamps, block.Timestamp)
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+		hash = block.PrevHash
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2], nil
+}
+
+// medianTimeBefore is the median time past of the parent of a block, the
+// genesis block has no parent and counts from its own timestamp.
+func (chain *Chain) medianTimeBefore(block *Block) (int64, error) {
+	if len(block.PrevHash) == 0 {
+		return block.Timestamp, nil
+	}
+
+	return chain.MedianTimePast(block.PrevHash)
+}
+
+// CheckTimestamp accepts a block time after the median time past of its
+// parent and no more than MaxFutureBlockTime ahead of the local clock.
+func (chain *Chain) CheckTimestamp(timestamp int64, prevHash []byte) error {
+	if limit := time.Now().Unix() + MaxFutureBlockTime; timestamp > limit {
+		return fmt.Errorf("block time %d is more than %d seconds in the future", timestamp, MaxFutureBlockTime)
+	}
+
+	median, err := chain.MedianTimePast(prevHash)
+	if err != nil {
+		return err
+	}
+
+	if timestamp <= median {
+		return fmt.Errorf("block time %d is not after the median time past %d", timestamp, median)
+	}
+
+	return nil
+}
+
+// NextBlockTime is the time for a block on top of prevHash, the clock unless
+// it lags behind the median time past.
+func (chain *Chain) NextBlockTime(prevHash []byte) (int64, error) {
+	median, err := chain.MedianTimePast(prevHash)
+	if err != nil {
+		return 0, err
+	}
+
+	if now := time.Now().Unix(); now > median {
+		return now, nil
+	}
+
+	return median + 1, nil
+}
+
+// checkCoinbase runs before anything hashes the transactions of a block, a
+// block needs at least one and the first has to be the coinbase.
+func checkCoinbase(transactions []*Transaction) error {
+	if len(transactions) == 0 {
+		return errors.New("block has no transactions")
+	}
+
+	if transactions[0] == nil || !transactions[0].IsCoinbase() {
+		return errors.New("the first transaction of a block must be a coinbase")
+	}
+
+	return nil
+}
+
+// CheckBlockBody runs the checks of a block that need no chain state, so the
+// blocks of a competing branch are checked before the chain disconnects its
+// own blocks to switch to it.
+func (chain *Chain) CheckBlockBody(block *Block) error {
+	if err := checkCoinbase(block.Transactions); err != nil {
+		return err
+	}
+
+	for i, tx := range block.Transactions {
+		if tx == nil {
+			return fmt.Errorf("transaction %d of the block is missing", i)
+		}
+		if err := tx.CheckSanity(); err != nil {
+			return fmt.Errorf("transaction %x: %s", tx.ID, err)
+		}
+		if i != 0 && tx.IsCoinbase() {
+			return fmt.Errorf("coinbase %x must be the first transaction of the block", tx.ID)
+		}
+	}
+
+	return chain.CheckBlockLimits(block)
+}
+
+// Rollback disconnects the blocks above ancestor and rebuilds the UTXO set,
+// the blocks stay in the database so the chain can switch back to them. It
+// returns the disconnected blocks, the tip first.
+func (chain *Chain) Rollback(ancestor []byte) ([]*Block, error) {
+	var disconnected []*Block
+
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		if bytes.Equal(block.Hash, ancestor) {
+			break
+		}
+		if len(block.PrevHash) == 0 {
+			return nil, fmt.Errorf("block %x is not on the best chain", ancestor)
+		}
+		disconnected = append(disconnected, block)
+	}
+
+	if len(disconnected) == 0 {
+		return nil, nil
+	}
+
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("lh"), ancestor)
+	})
+	if err != nil {
+		return nil, err
+	}
+	chain.LastHash = ancestor
+
+	UTXOSet{Chain: chain}.Reindex()
+
+	return disconnected, nil
+}
+
+func (chain *Chain) storeBlock(block *Block) {
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		err := txn.Set(block.Hash, block.Serialize())
 		Handler.Handle(err)
-		err = txn.Set([]byte("lh"), newBlock.Hash)
+		err = txn.Set([]byte("lh"), block.Hash)
 
-		chain.LastHash = newBlock.Hash
+		chain.LastHash = block.Hash
 
 		return err
 	})
 
 	Handler.Handle(err)
+}
+
+func (chain *Chain) CheckTransactions(transactions []*Transaction, height int, blockTime int64, median int64) error {
+	return chain.checkTransactions(transactions, height, blockTime, median, true)
+}
+
+func (chain *Chain) checkTransactions(transactions []*Transaction, height int, blockTime int64, median int64, verifyScripts bool) error {
+	UTXO := UTXOSet{Chain: chain}
+	pending := make(map[string]*Transaction)
+	spent := make(map[string]bool)
+	sigOps, fees := 0, 0
+	var coinbase *Transaction
+
+	for i, tx := range transactions {
+		txID := hex.EncodeToString(tx.ID)
+		if err := tx.CheckSanity(); err != nil {
+			return fmt.Errorf("transaction %x: %s", tx.ID, err)
+		}
+
+		if _, ok := pending[txID]; ok {
+			return fmt.Errorf("transaction %x appears twice in the block", tx.ID)
+		}
+		if _, ok := UTXO.GetOutputs(tx.ID); ok {
+			return fmt.Errorf("transaction %x already has unspent outputs", tx.ID)
+		}
+
+		if tx.IsCoinbase() {
+			if i != 0 {
+				return fmt.Errorf("coinbase %x must be the first transaction of the block", tx.ID)
+			}
+			coinbase = tx
+			sigOps += tx.SigOpCount(nil)
+			pending[txID] = tx
+			continue
+		}
+
+		preTXs := make(map[string]Transaction)
+		inputValue := 0
+
+		for _, in := range tx.Inputs {
+			outPoint := OutPoint{in.ID, in.Out}.String()
+			if spent[outPoint] {
+				return fmt.Errorf("transaction %x double spends %s", tx.ID, outPoint)
+			}
+			spent[outPoint] = true
+
+			inID := hex.EncodeToString(in.ID)
+			if parent, ok := pending[inID]; ok {
+				if in.Out < 0 || in.Out >= len(parent.Outputs) {
+					return fmt.Errorf("transaction %x spends missing output %s", tx.ID, outPoint)
+				}
+				if parent.IsCoinbase() && chain.Params.CoinbaseMaturity > 0 {
+					return fmt.Errorf("transaction %x spends immature coinbase output %s", tx.ID, outPoint)
+				}
+				preTXs[inID] = *parent
+				inputValue += parent.Outputs[in.Out].Value
+				continue
+			}
+
+			outs, ok := UTXO.GetOutputs(in.ID)
+			out, unspent := outs.Outputs[in.Out]
+			if !ok || !unspent {
+				return fmt.Errorf("transaction %x spends missing or spent output %s", tx.ID, outPoint)
+			}
+			if !outs.IsMature(height, chain.Params.CoinbaseMaturity) {
+				return fmt.Errorf("transaction %x spends immature coinbase output %s", tx.ID, outPoint)
+			}
+			inputValue += out.Value
+
+			preTx, err := chain.FindTransaction(in.ID)
+			if err != nil {
+				return err
+			}
+			preTXs[inID] = preTx
+		}
+
+		if verifyScripts && !tx.Verify(preTXs) {
+			return fmt.Errorf("invalid transaction %x", tx.ID)
+		}
 
-	return newBlock
+		if inputValue < tx.OutputValue() {
+			return fmt.Errorf("transaction %x spends more than its inputs", tx.ID)
+		}
+		fees += inputValue - tx.OutputValue()
+
+		if err := chain.checkLocks(tx, height, blockTime, median, pending); err != nil {
+			return err
+		}
+
+		sigOps += tx.SigOpCount(preTXs)
+		if sigOps > chain.Params.MaxBlockSigOps {
+			return fmt.Errorf("block exceeds %d signature operations", chain.Params.MaxBlockSigOps)
+		}
+
+		pending[txID] = tx
+	}
+
+	if coinbase != nil && coinbase.OutputValue() > BlockSubsidy+fees {
+		return fmt.Errorf("coinbase %x pays %d, more than the subsidy and fees of %d", coinbase.ID, coinbase.OutputValue(), BlockSubsidy+fees)
+	}
+
+	return nil
 }
 
 func (chain *Chain) FindUTXO() map[string]TxOutputs {
@@ -166,6 +734,9 @@ func (chain *Chain) FindUTXO() map[string]TxOutputs {
 
 	for {
 		block := iter.Next()
+		median, err := chain.medianTimeBefore(block)
+		Handler.Handle(err)
+
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.ID)
 
@@ -180,7 +751,10 @@ func (chain *Chain) FindUTXO() map[string]TxOutputs {
 				}
 
 				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
+				if outs.Outputs == nil {
+					outs = TxOutputs{make(map[int]TXOutput), block.Height, block.Timestamp, tx.IsCoinbase(), median}
+				}
+				outs.Outputs[outIdx] = out
 				UTXO[txID] = outs
 			}
 			if tx.IsCoinbase() == false {
@@ -189,13 +763,82 @@ func (chain *Chain) FindUTXO() map[string]TxOutputs {
 					spentTXOs[inTXID] = append(spentTXOs[inTXID], in.Out)
 				}
 			}
-			if len(block.PrevHash) == 0 {
-				break
-			}
 		}
 
-		return UTXO
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return UTXO
+}
+
+func (chain *Chain) GetBlock(hash []byte) (Block, error) {
+	var block Block
+
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(hash)
+		if err != nil {
+			return errors.New("block is not found")
+		}
+
+		return item.Value(func(val []byte) error {
+			block = *Deserialize(val)
+			return nil
+		})
+	})
+
+	return block, err
+}
+
+func (chain *Chain) GetBestHeight() int {
+	lastBlock, err := chain.GetBlock(chain.LastHash)
+	Handler.Handle(err)
+
+	return lastBlock.Height
+}
+
+// CheckLocks checks the lock time of a transaction for a block at height with
+// blockTime, relative time locks compare the median time past before that
+// block with the one before the blocks of the inputs.
+func (chain *Chain) CheckLocks(tx *Transaction, height int, blockTime int64, median int64) error {
+	return chain.checkLocks(tx, height, blockTime, median, nil)
+}
+
+func (chain *Chain) checkLocks(tx *Transaction, height int, blockTime int64, median int64, pending map[string]*Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
 	}
+
+	if !tx.IsFinal(height, blockTime) {
+		return fmt.Errorf("transaction %x is locked until %d", tx.ID, tx.LockTime)
+	}
+
+	for _, in := range tx.Inputs {
+		isTime, value := in.RelativeLock()
+		if value == 0 {
+			continue
+		}
+
+		if _, ok := pending[hex.EncodeToString(in.ID)]; ok {
+			return fmt.Errorf("input %x:%d is locked until its transaction confirms", in.ID, in.Out)
+		}
+
+		outs, ok := UTXOSet{Chain: chain}.GetOutputs(in.ID)
+		if !ok {
+			return fmt.Errorf("input %x:%d spends a missing transaction", in.ID, in.Out)
+		}
+
+		if isTime && median-outs.LockStart() < value {
+			return fmt.Errorf("input %x:%d is locked for %d seconds", in.ID, in.Out, value)
+		}
+
+		if !isTime && int64(height-outs.Height) < value {
+			return fmt.Errorf("input %x:%d is locked for %d blocks", in.ID, in.Out, value)
+		}
+	}
+
+	return nil
 }
 
 func (chain *Chain) FindTransaction(ID []byte) (Transaction, error) {
@@ -219,15 +862,25 @@ func (chain *Chain) FindTransaction(ID []byte) (Transaction, error) {
 }
 
 func (chain Chain) SignTransaction(tx *Transaction, priKey ecdsa.PrivateKey) {
+	chain.SignTransactionWithKeys(tx, []ecdsa.PrivateKey{priKey})
+}
+
+func (chain Chain) SignTransactionWithKeys(tx *Transaction, keys []ecdsa.PrivateKey) {
 	preTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
 		preTx, err := chain.FindTransaction(in.ID)
-		Handler.Handle(err)
+		if err != nil {
+			entry, ok := Mempool{Chain: &chain}.Get(in.ID)
+			if !ok {
+				Handler.Handle(err)
+			}
+			preTx = entry.Tx
+		}
 		preTXs[hex.EncodeToString(preTx.ID)] = preTx
 	}
 
-	tx.Sigh(priKey, preTXs)
+	tx.SighWithKeys(keys, preTXs)
 }
 
 func (chain Chain) VerifyTransaction(tx *Transaction) bool {
@@ -0,0 +1,167 @@
+package BlockChain
+
+import (
+	"github.com/koushamad/blockchain/Wallet"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newTestChain creates a test network chain in a temporary directory whose
+// genesis block pays address, coinbase outputs can be spent right away.
+func newTestChain(t *testing.T, address string) *Chain {
+	t.Helper()
+
+	params := TestNetParams
+	params.DBPath = t.TempDir()
+	params.CoinbaseMaturity = 0
+
+	chain := InitBlockChain(address, &params)
+	t.Cleanup(func() { chain.Database.Close() })
+	UTXOSet{Chain: chain}.Reindex()
+
+	return chain
+}
+
+func newTestWallet() (*Wallet.Wallet, string) {
+	w := Wallet.MakeWallet()
+
+	return w, string(w.Address())
+}
+
+// mineTransactions adds the transactions to the mempool and mines them in a
+// block paying reward.
+func mineTransactions(t *testing.T, chain *Chain, reward string, txs ...*Transaction) *Block {
+	t.Helper()
+
+	for _, tx := range txs {
+		if err := (Mempool{Chain: chain}).Add(tx); err != nil {
+			t.Fatalf("adding transaction %x to the mempool: %s", tx.ID, err)
+		}
+	}
+
+	block, err := Miner{Chain: chain, RewardAddress: reward}.MineBlock(nil)
+	if err != nil {
+		t.Fatalf("mining block: %s", err)
+	}
+
+	return block
+}
+
+func balance(chain *Chain, address string) int {
+	_, hash, err := Wallet.DecodeAddress(address)
+	if err != nil {
+		panic(err)
+	}
+	spendable, immature := UTXOSet{Chain: chain}.FindBalance(hash)
+
+	return spendable + immature
+}
+
+func TestCheckRelativeTimeLock(t *testing.T) {
+	_, address := newTestWallet()
+	chain := newTestChain(t, address)
+
+	genesis := chain.Iterator().Next()
+	outs, ok := UTXOSet{Chain: chain}.GetOutputs(genesis.Transactions[0].ID)
+	if !ok || outs.MedianTime != genesis.Timestamp {
+		t.Fatalf("genesis outputs count relative locks from %d, want %d", outs.MedianTime, genesis.Timestamp)
+	}
+
+	lock := int64(1) << SequenceLockTimeGranularity
+	tx := &Transaction{Inputs: []TxInput{{ID: genesis.Transactions[0].ID, Out: 0, Sequence: SequenceLockTimeIsTime | 1}}}
+	far := time.Now().Unix() + MaxFutureBlockTime
+
+	tests := []struct {
+		name   string
+		median int64
+		ok     bool
+	}{
+		{"before the lock", outs.MedianTime + lock - 1, false},
+		{"at the lock", outs.MedianTime + lock, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := chain.CheckLocks(tx, 1, far, test.median)
+			if test.ok != (err == nil) {
+				t.Errorf("got error %v, want success %t", err, test.ok)
+			}
+		})
+	}
+}
+
+func TestNewPaymentTransaction(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	_, carolAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	UTXO := UTXOSet{Chain: chain}
+
+	wallets := &Wallet.Wallets{Wallets: map[string]*Wallet.Wallet{aliceAddress: alice}}
+	options := TxOptions{Fee: 1, ChangeAddress: aliceAddress}
+
+	invalid := []struct {
+		name     string
+		payments []Payment
+	}{
+		{"no payments", nil},
+		{"zero amount", []Payment{{bobAddress, 3}, {carolAddress, 0}}},
+		{"negative amount", []Payment{{bobAddress, -3}}},
+		{"invalid address", []Payment{{bobAddress, 3}, {"carol", 4}}},
+	}
+
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewPaymentTransaction(wallets, aliceAddress, test.payments, &UTXO, options); err == nil {
+				t.Error("created a transaction for invalid payments")
+			}
+		})
+	}
+
+	tx, err := NewPaymentTransaction(wallets, aliceAddress, []Payment{{bobAddress, 3}, {carolAddress, 4}, {bobAddress, 5}}, &UTXO, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Outputs) != 4 {
+		t.Errorf("transaction has %d outputs, want one per payment and the change", len(tx.Outputs))
+	}
+	mineTransactions(t, chain, aliceAddress, tx)
+
+	for address, want := range map[string]int{bobAddress: 8, carolAddress: 4} {
+		if got := balance(chain, address); got != want {
+			t.Errorf("%s has %d, want %d", address, got, want)
+		}
+	}
+}
+
+func TestNewWalletTransaction(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	dave, daveAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	_, outsiderAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	UTXO := UTXOSet{Chain: chain}
+	mineTransactions(t, chain, daveAddress)
+	mineTransactions(t, chain, outsiderAddress)
+
+	wallets := &Wallet.Wallets{Wallets: map[string]*Wallet.Wallet{aliceAddress: alice, daveAddress: dave}}
+	output := NewTXOutput(BlockSubsidy+5, bobAddress)
+
+	tx, sources, err := NewWalletTransaction(wallets, []TXOutput{*output}, &UTXO, TxOptions{Fee: 1, ChangeAddress: aliceAddress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{aliceAddress, daveAddress}
+	sort.Strings(want)
+	if !equalStrings(sources, want) {
+		t.Errorf("drew from %v, want %v", sources, want)
+	}
+	mineTransactions(t, chain, outsiderAddress, tx)
+
+	for address, want := range map[string]int{bobAddress: BlockSubsidy + 5, aliceAddress: BlockSubsidy - 6, daveAddress: 0} {
+		if got := balance(chain, address); got != want {
+			t.Errorf("%s has %d, want %d", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package BlockChain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	CheckpointsEnv = "BLOCKCHAIN_CHECKPOINTS"
+	AssumeValidEnv = "BLOCKCHAIN_ASSUME_VALID"
+)
+
+type Checkpoint struct {
+	Height int
+	Hash   string
+}
+
+func (c Checkpoint) String() string {
+	return fmt.Sprintf("%d:%s", c.Height, c.Hash)
+}
+
+func ParseCheckpoint(value string) (Checkpoint, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), ":", 2)
+	if len(parts) != 2 {
+		return Checkpoint{}, fmt.Errorf("checkpoint %q must be HEIGHT:HASH", value)
+	}
+
+	height, err := strconv.Atoi(parts[0])
+	if err != nil || height < 0 {
+		return Checkpoint{}, fmt.Errorf("checkpoint %q has an invalid height", value)
+	}
+
+	hash, err := hex.DecodeString(parts[1])
+	if err != nil || len(hash) != 32 {
+		return Checkpoint{}, fmt.Errorf("checkpoint %q has an invalid hash", value)
+	}
+
+	return Checkpoint{height, hex.EncodeToString(hash)}, nil
+}
+
+// withConfig returns a copy of the params with the checkpoints, the assumed
+// valid block and the seed nodes supplied through the environment added to the
+// hardcoded ones.
+func (p Params) withConfig() (*Params, error) {
+	p.Checkpoints = append([]Checkpoint{}, p.Checkpoints...)
+
+	if value := os.Getenv(CheckpointsEnv); value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			checkpoint, err := ParseCheckpoint(entry)
+			if err != nil {
+				return nil, err
+			}
+			if existing, ok := p.CheckpointAt(checkpoint.Height); ok {
+				if existing.Hash != checkpoint.Hash {
+					return nil, fmt.Errorf("checkpoint %s conflicts with %s", checkpoint, existing)
+				}
+				continue
+			}
+			p.Checkpoints = append(p.Checkpoints, checkpoint)
+		}
+	}
+	sort.Slice(p.Checkpoints, func(i, j int) bool { return p.Checkpoints[i].Height < p.Checkpoints[j].Height })
+
+	if value := os.Getenv(AssumeValidEnv); value != "" {
+		assumeValid, err := ParseCheckpoint(value)
+		if err != nil {
+			return nil, err
+		}
+		p.AssumeValid = &assumeValid
+	}
+
+	p.Seeds = append([]string{}, p.Seeds...)
+	if value := os.Getenv(SeedsEnv); value != "" {
+		for _, seed := range strings.Split(value, ",") {
+			if seed = strings.TrimSpace(seed); seed != "" {
+				p.Seeds = append(p.Seeds, seed)
+			}
+		}
+	}
+
+	return &p, nil
+}
+
+func (p *Params) CheckpointAt(height int) (Checkpoint, bool) {
+	for _, checkpoint := range p.Checkpoints {
+		if checkpoint.Height == height {
+			return checkpoint, true
+		}
+	}
+
+	if p.AssumeValid != nil && p.AssumeValid.Height == height {
+		return *p.AssumeValid, true
+	}
+
+	return Checkpoint{}, false
+}
+
+// CheckCheckpoint rejects a block at a checkpointed height unless it is the
+// checkpointed block, so no competing chain can pass a checkpoint. The
+// assumed valid block is enforced the same way.
+func (chain *Chain) CheckCheckpoint(height int, hash []byte) error {
+	checkpoint, ok := chain.Params.CheckpointAt(height)
+	if !ok {
+		return nil
+	}
+
+	expected, err := hex.DecodeString(checkpoint.Hash)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(hash, expected) {
+		return fmt.Errorf("block %d %x conflicts with checkpoint %s", height, hash, checkpoint)
+	}
+
+	return nil
+}
+
+// assumedValid reports whether the scripts of a block may be skipped because
+// it is an ancestor of the assumed valid block in the validated header chain.
+// Proof of work, amounts and the UTXO set are still checked, and without a
+// header chain that reaches the assumed valid block every script is verified.
+func (chain *Chain) assumedValid(block *Block) bool {
+	assumeValid := chain.Params.AssumeValid
+	if assumeValid == nil || chain.Headers == nil || block.Height > assumeValid.Height {
+		return false
+	}
+
+	hash, ok := chain.Headers.HeaderHash(assumeValid.Height)
+	if !ok || hex.EncodeToString(hash) != assumeValid.Hash {
+		return false
+	}
+
+	ancestor, ok := chain.Headers.HeaderHash(block.Height)
+
+	return ok && bytes.Equal(ancestor, block.Hash)
+}
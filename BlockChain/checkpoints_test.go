@@ -0,0 +1,146 @@
+package BlockChain
+
+import (
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+// headerChain is a header index listing the hashes of one chain by height.
+type headerChain [][]byte
+
+func (headers headerChain) HeaderHash(height int) ([]byte, bool) {
+	if height < 0 || height >= len(headers) {
+		return nil, false
+	}
+
+	return headers[height], true
+}
+
+func (headers headerChain) Header(hash []byte) (Header, bool) {
+	return Header{}, false
+}
+
+func TestParseCheckpoint(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"10:" + hash, true},
+		{" 0:" + strings.ToUpper(hash) + " ", true},
+		{"10", false},
+		{"-1:" + hash, false},
+		{"ten:" + hash, false},
+		{"10:abcd", false},
+		{"10:" + strings.Repeat("zz", 32), false},
+	}
+
+	for _, test := range tests {
+		checkpoint, err := ParseCheckpoint(test.value)
+		if test.ok != (err == nil) {
+			t.Errorf("%q: got error %v, want success %t", test.value, err, test.ok)
+		}
+		if err == nil && checkpoint.Hash != hash {
+			t.Errorf("%q: hash is %s, want it in lower case", test.value, checkpoint.Hash)
+		}
+	}
+}
+
+func TestCheckpointsFromEnvironment(t *testing.T) {
+	first, second := strings.Repeat("01", 32), strings.Repeat("02", 32)
+	defer os.Unsetenv(CheckpointsEnv)
+	defer os.Unsetenv(AssumeValidEnv)
+
+	os.Setenv(CheckpointsEnv, "20:"+second+",10:"+first)
+	os.Setenv(AssumeValidEnv, "30:"+second)
+	params, err := TestNetParams.withConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params.Checkpoints) != 2 || params.Checkpoints[0].Height != 10 || params.Checkpoints[1].Height != 20 {
+		t.Errorf("checkpoints are %v, want heights 10 and 20 in order", params.Checkpoints)
+	}
+	if checkpoint, ok := params.CheckpointAt(30); !ok || checkpoint.Hash != second {
+		t.Errorf("assumed valid block is %v, want %s at height 30", params.AssumeValid, second)
+	}
+	if len(TestNetParams.Checkpoints) != 0 || TestNetParams.AssumeValid != nil {
+		t.Error("the configuration changed the network params")
+	}
+
+	os.Setenv(CheckpointsEnv, "10:"+first+",10:"+second)
+	if _, err := TestNetParams.withConfig(); err == nil {
+		t.Error("accepted conflicting checkpoints")
+	}
+}
+
+func TestAssumeValid(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	genesis := chain.Iterator().Next()
+
+	forged := &Transaction{
+		Inputs:  []TxInput{{ID: genesis.Transactions[0].ID, Out: 0, Sequence: SequenceFinal}},
+		Outputs: []TXOutput{*NewTXOutput(BlockSubsidy, aliceAddress)},
+	}
+	forged.ID = forged.Hash()
+	chain.SignTransaction(forged, alice.PrivateKey)
+	forged.Inputs[0].ScriptSig[2] ^= 0xff
+
+	timestamp, err := chain.NextBlockTime(genesis.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := NewBlock([]*Transaction{NewCoinbaseTX(aliceAddress, "", BlockSubsidy), forged}, genesis.Hash, 1)
+	block.Timestamp = timestamp
+	if err := chain.Consensus.Seal(block, nil); err != nil {
+		t.Fatal(err)
+	}
+	assumeValid := &Checkpoint{1, hex.EncodeToString(block.Hash)}
+	other := &Checkpoint{1, strings.Repeat("00", 32)}
+
+	tests := []struct {
+		name        string
+		assumeValid *Checkpoint
+		headers     HeaderIndex
+		ok          bool
+	}{
+		{"no assumed valid block", nil, headerChain{genesis.Hash, block.Hash}, false},
+		{"no header chain", assumeValid, nil, false},
+		{"header chain without the block", assumeValid, headerChain{genesis.Hash}, false},
+		{"ancestor of the assumed valid block", assumeValid, headerChain{genesis.Hash, block.Hash}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := *chain.Params
+			params.AssumeValid = test.assumeValid
+			chain.Params = &params
+			chain.Headers = test.headers
+
+			if got := chain.assumedValid(block); got != test.ok {
+				t.Errorf("assumed valid is %t, want %t", got, test.ok)
+			}
+		})
+	}
+
+	params := *chain.Params
+	params.AssumeValid = other
+	chain.Params = &params
+	if err := chain.CheckCheckpoint(1, block.Hash); err == nil {
+		t.Error("block conflicting with the assumed valid block passed the checkpoint")
+	}
+
+	chain.Headers = headerChain{genesis.Hash, block.Hash}
+	params.AssumeValid = nil
+	if err := chain.ConnectBlock(block); err == nil {
+		t.Fatal("connected a block with a forged signature")
+	}
+
+	params.AssumeValid = assumeValid
+	if err := chain.ConnectBlock(block); err != nil {
+		t.Errorf("scripts of the assumed valid block were checked: %s", err)
+	}
+}
@@ -0,0 +1,329 @@
+package BlockChain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger"
+	"github.com/koushamad/blockchain/Handler"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCoinSelection = "largest-first"
+	maxBnBTries          = 100000
+)
+
+type OutPoint struct {
+	TxID  []byte
+	Index int
+}
+
+type SpendableOutput struct {
+	OutPoint
+	Output      TXOutput
+	Height      int
+	Unconfirmed bool
+}
+
+type CoinSelector func(coins []SpendableOutput, amount int) ([]SpendableOutput, error)
+
+var CoinSelectors = map[string]CoinSelector{
+	"largest-first":    SelectLargestFirst,
+	"smallest-first":   SelectSmallestFirst,
+	"branch-and-bound": SelectBranchAndBound,
+	"random-improve":   SelectRandomImprove,
+}
+
+func (op OutPoint) String() string {
+	return fmt.Sprintf("%x:%d", op.TxID, op.Index)
+}
+
+func ParseOutPoint(value string) (OutPoint, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return OutPoint{}, fmt.Errorf("outpoint %s is not txid:index", value)
+	}
+
+	txID, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return OutPoint{}, fmt.Errorf("outpoint %s has an invalid txid", value)
+	}
+
+	index, err := strconv.Atoi(parts[1])
+	if err != nil || index < 0 {
+		return OutPoint{}, fmt.Errorf("outpoint %s has an invalid index", value)
+	}
+
+	return OutPoint{txID, index}, nil
+}
+
+func (u UTXOSet) FindUnspentOutputs(publicKeyHash []byte) []SpendableOutput {
+	var coins []SpendableOutput
+	db := u.Chain.Database
+	height := u.Chain.GetBestHeight() + 1
+	blockTime := time.Now().Unix()
+	median, err := u.Chain.MedianTimePast(u.Chain.LastHash)
+	Handler.Handle(err)
+	maturity := u.Chain.Params.CoinbaseMaturity
+	mempool := Mempool{Chain: u.Chain}
+	entries := mempool.Entries()
+
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(UTXOPrefix); it.ValidForPrefix(UTXOPrefix); it.Next() {
+			item := it.Item()
+			txID := bytes.TrimPrefix(item.KeyCopy(nil), UTXOPrefix)
+			var outs TxOutputs
+
+			if err := item.Value(func(val []byte) error {
+				outs = DeserializeOutputs(val)
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			if !outs.IsMature(height, maturity) {
+				continue
+			}
+
+			for outIdx, out := range outs.Outputs {
+				outPoint := OutPoint{txID, outIdx}
+				if _, spent, err := spenderIn(txn, outPoint); err != nil {
+					return err
+				} else if spent {
+					continue
+				}
+
+				if out.IsLockedWithKey(publicKeyHash) && outs.IsUnlocked(outIdx, height, blockTime, median) {
+					coins = append(coins, SpendableOutput{outPoint, out, outs.Height, false})
+				}
+			}
+		}
+
+		return nil
+	})
+
+	Handler.Handle(err)
+
+	for _, entry := range entries {
+		for outIdx, out := range entry.Tx.Outputs {
+			outPoint := OutPoint{entry.Tx.ID, outIdx}
+			if _, spent := mempool.Spender(outPoint); spent {
+				continue
+			}
+
+			if out.IsLockedWithKey(publicKeyHash) && ClassifyScript(out.ScriptPubKey) != TimeLockScript {
+				coins = append(coins, SpendableOutput{outPoint, out, height, true})
+			}
+		}
+	}
+
+	sortCoins(coins)
+
+	return coins
+}
+
+func SelectCoins(coins []SpendableOutput, amount int, options TxOptions) ([]SpendableOutput, error) {
+	if len(options.Coins) != 0 {
+		return selectManual(coins, amount, options.Coins)
+	}
+
+	strategy := options.CoinSelection
+	if strategy == "" {
+		strategy = DefaultCoinSelection
+	}
+
+	selector, ok := CoinSelectors[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown coin selection strategy %s", strategy)
+	}
+
+	var confirmed []SpendableOutput
+	for _, coin := range coins {
+		if !coin.Unconfirmed {
+			confirmed = append(confirmed, coin)
+		}
+	}
+
+	return selector(confirmed, amount)
+}
+
+func selectManual(coins []SpendableOutput, amount int, outPoints []OutPoint) ([]SpendableOutput, error) {
+	var selected []SpendableOutput
+
+	available := make(map[string]SpendableOutput)
+	for _, coin := range coins {
+		available[coin.String()] = coin
+	}
+
+	for _, outPoint := range outPoints {
+		coin, ok := available[outPoint.String()]
+		if !ok {
+			return nil, fmt.Errorf("output %s is not spendable by the sender", outPoint)
+		}
+
+		delete(available, outPoint.String())
+		selected = append(selected, coin)
+	}
+
+	if total(selected) < amount {
+		return nil, errors.New("not enough funds in the selected coins")
+	}
+
+	return selected, nil
+}
+
+func SelectLargestFirst(coins []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	sorted := sortedCoins(coins, func(a, b SpendableOutput) bool { return a.Output.Value > b.Output.Value })
+
+	return accumulate(sorted, amount)
+}
+
+func SelectSmallestFirst(coins []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	sorted := sortedCoins(coins, func(a, b SpendableOutput) bool { return a.Output.Value < b.Output.Value })
+
+	return accumulate(sorted, amount)
+}
+
+func SelectBranchAndBound(coins []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	sorted := sortedCoins(coins, func(a, b SpendableOutput) bool { return a.Output.Value > b.Output.Value })
+
+	remaining := total(sorted)
+	if remaining < amount {
+		return nil, errors.New("not enough funds")
+	}
+
+	var selected []bool
+	var search func(depth, value, remaining int) bool
+	tries := 0
+
+	search = func(depth, value, remaining int) bool {
+		tries++
+		if value == amount {
+			return true
+		}
+		if value > amount || value+remaining < amount || depth == len(sorted) || tries > maxBnBTries {
+			return false
+		}
+
+		coinValue := sorted[depth].Output.Value
+
+		selected = append(selected, true)
+		if search(depth+1, value+coinValue, remaining-coinValue) {
+			return true
+		}
+		selected[len(selected)-1] = false
+		if search(depth+1, value, remaining-coinValue) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+
+		return false
+	}
+
+	if !search(0, 0, remaining) {
+		return SelectLargestFirst(coins, amount)
+	}
+
+	var result []SpendableOutput
+	for i, use := range selected {
+		if use {
+			result = append(result, sorted[i])
+		}
+	}
+
+	return result, nil
+}
+
+func SelectRandomImprove(coins []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	shuffled := sortedCoins(coins, nil)
+	random.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	selected, err := accumulate(shuffled, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	target := 2 * amount
+	value := total(selected)
+
+	for _, coin := range shuffled[len(selected):] {
+		improved := value + coin.Output.Value
+		if improved > 3*amount || abs(target-improved) >= abs(target-value) {
+			continue
+		}
+
+		selected = append(selected, coin)
+		value = improved
+	}
+
+	return selected, nil
+}
+
+func accumulate(coins []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	var selected []SpendableOutput
+	value := 0
+
+	for _, coin := range coins {
+		if value >= amount && len(selected) > 0 {
+			break
+		}
+
+		selected = append(selected, coin)
+		value += coin.Output.Value
+	}
+
+	if value < amount {
+		return nil, errors.New("not enough funds")
+	}
+
+	return selected, nil
+}
+
+func sortedCoins(coins []SpendableOutput, less func(a, b SpendableOutput) bool) []SpendableOutput {
+	sorted := make([]SpendableOutput, len(coins))
+	copy(sorted, coins)
+
+	if less != nil {
+		sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	}
+
+	return sorted
+}
+
+func sortCoins(coins []SpendableOutput) {
+	sort.Slice(coins, func(i, j int) bool {
+		if cmp := bytes.Compare(coins[i].TxID, coins[j].TxID); cmp != 0 {
+			return cmp < 0
+		}
+
+		return coins[i].Index < coins[j].Index
+	})
+}
+
+func total(coins []SpendableOutput) int {
+	value := 0
+	for _, coin := range coins {
+		value += coin.Output.Value
+	}
+
+	return value
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+
+	return value
+}
@@ -0,0 +1,209 @@
+package BlockChain
+
+import (
+	"sort"
+	"testing"
+)
+
+func testCoins(values ...int) []SpendableOutput {
+	var coins []SpendableOutput
+	for i, value := range values {
+		coins = append(coins, SpendableOutput{OutPoint: OutPoint{[]byte{byte(i)}, i}, Output: TXOutput{Value: value}})
+	}
+
+	return coins
+}
+
+func coinValues(coins []SpendableOutput) []int {
+	var values []int
+	for _, coin := range coins {
+		values = append(values, coin.Output.Value)
+	}
+	sort.Ints(values)
+
+	return values
+}
+
+func equalValues(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestSelectCoins(t *testing.T) {
+	coins := testCoins(1, 3, 5, 10)
+	pending := SpendableOutput{OutPoint: OutPoint{[]byte("pending"), 0}, Output: TXOutput{Value: 100}, Unconfirmed: true}
+	unconfirmed := append([]SpendableOutput{pending}, coins...)
+
+	tests := []struct {
+		name    string
+		coins   []SpendableOutput
+		amount  int
+		options TxOptions
+		want    []int
+	}{
+		{"largest first", coins, 12, TxOptions{}, []int{5, 10}},
+		{"smallest first", coins, 4, TxOptions{CoinSelection: "smallest-first"}, []int{1, 3}},
+		{"branch and bound exact match", coins, 8, TxOptions{CoinSelection: "branch-and-bound"}, []int{3, 5}},
+		{"branch and bound without a match", coins, 17, TxOptions{CoinSelection: "branch-and-bound"}, []int{3, 5, 10}},
+		{"manual", coins, 2, TxOptions{Coins: []OutPoint{coins[1].OutPoint}}, []int{3}},
+		{"unconfirmed coins are skipped", unconfirmed, 12, TxOptions{}, []int{5, 10}},
+		{"manual unconfirmed coin", unconfirmed, 12, TxOptions{Coins: []OutPoint{pending.OutPoint}}, []int{100}},
+		{"not enough funds", coins, 20, TxOptions{}, nil},
+		{"not enough funds for branch and bound", coins, 20, TxOptions{CoinSelection: "branch-and-bound"}, nil},
+		{"not enough in manual coins", coins, 4, TxOptions{Coins: []OutPoint{coins[1].OutPoint}}, nil},
+		{"manual coin spent twice", coins, 4, TxOptions{Coins: []OutPoint{coins[1].OutPoint, coins[1].OutPoint}}, nil},
+		{"manual coin not owned", coins, 1, TxOptions{Coins: []OutPoint{{[]byte("other"), 0}}}, nil},
+		{"unknown strategy", coins, 1, TxOptions{CoinSelection: "newest-first"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := SelectCoins(test.coins, test.amount, test.options)
+			if test.want == nil {
+				if err == nil {
+					t.Errorf("selected %v", coinValues(selected))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := coinValues(selected); !equalValues(got, test.want) {
+				t.Errorf("selected %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectRandomImprove(t *testing.T) {
+	coins := testCoins(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
+	for i := 0; i < 50; i++ {
+		selected, err := SelectRandomImprove(coins, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value := total(selected)
+		if value < 10 || value > 30 {
+			t.Fatalf("selected %v worth %d for 10", coinValues(selected), value)
+		}
+	}
+
+	if _, err := SelectRandomImprove(coins, 100); err == nil {
+		t.Error("selected coins worth more than all coins")
+	}
+}
+
+func TestParseOutPoint(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"00ff:1", true},
+		{"00ff:0", true},
+		{"00ff", false},
+		{"00ff:1:2", false},
+		{"zz:1", false},
+		{"00ff:-1", false},
+		{"00ff:x", false},
+	}
+
+	for _, test := range tests {
+		outPoint, err := ParseOutPoint(test.value)
+		if test.ok != (err == nil) {
+			t.Errorf("%s: got error %v, want success %t", test.value, err, test.ok)
+		}
+		if test.ok && outPoint.String() != test.value {
+			t.Errorf("%s parsed as %s", test.value, outPoint)
+		}
+	}
+}
+
+func TestSelectBranchAndBound(t *testing.T) {
+	tests := []struct {
+		name   string
+		coins  []SpendableOutput
+		amount int
+		want   []int
+	}{
+		{"exact match", testCoins(1, 2, 4, 8, 16), 11, []int{1, 2, 8}},
+		{"every coin", testCoins(1, 2, 4, 8, 16), 31, []int{1, 2, 4, 8, 16}},
+		{"single coin", testCoins(3, 7, 9), 7, []int{7}},
+		{"largest first without a match", testCoins(5, 10), 7, []int{10}},
+		{"not enough funds", testCoins(5, 10), 16, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := SelectBranchAndBound(test.coins, test.amount)
+			if test.want == nil {
+				if err == nil {
+					t.Errorf("selected %v", coinValues(selected))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := coinValues(selected); !equalValues(got, test.want) {
+				t.Errorf("selected %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectRandomImproveTarget(t *testing.T) {
+	coins := testCoins(5, 5, 5, 5, 5, 5)
+
+	for i := 0; i < 20; i++ {
+		selected, err := SelectRandomImprove(coins, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value := total(selected); value != 10 {
+			t.Fatalf("selected %v, want coins worth twice the amount", coinValues(selected))
+		}
+	}
+
+	selected, err := SelectRandomImprove(coins, 30)
+	if err != nil || len(selected) != len(coins) {
+		t.Errorf("selected %d coins with error %v, want all of them", len(selected), err)
+	}
+}
+
+func TestSelectManual(t *testing.T) {
+	coins := testCoins(1, 3, 5, 10)
+
+	selected, err := selectManual(coins, 12, []OutPoint{coins[3].OutPoint, coins[0].OutPoint, coins[1].OutPoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 3 || selected[0].Output.Value != 10 || selected[1].Output.Value != 1 || selected[2].Output.Value != 3 {
+		t.Errorf("selected %v, want the coins in the given order", selected)
+	}
+
+	tests := []struct {
+		name      string
+		amount    int
+		outPoints []OutPoint
+	}{
+		{"not enough", 6, []OutPoint{coins[2].OutPoint}},
+		{"coin twice", 6, []OutPoint{coins[2].OutPoint, coins[2].OutPoint}},
+		{"unknown coin", 1, []OutPoint{{coins[0].TxID, 1}}},
+	}
+
+	for _, test := range tests {
+		if selected, err := selectManual(coins, test.amount, test.outPoints); err == nil {
+			t.Errorf("%s: selected %v", test.name, coinValues(selected))
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package BlockChain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"math/big"
+)
+
+const (
+	ProofOfWorkEngine      = "pow"
+	ProofOfAuthorityEngine = "poa"
+)
+
+var consensusKey = []byte("consensus")
+
+// Consensus seals new blocks and decides whether a received block was sealed
+// by someone entitled to extend the chain.
+type Consensus interface {
+	Seal(block *Block, quit <-chan struct{}) error
+	Verify(block *Block) error
+	VerifyHeader(header Header) error
+}
+
+type ConsensusConfig struct {
+	Engine  string
+	Signers []string
+}
+
+func (c ConsensusConfig) Validate() error {
+	switch c.Engine {
+	case ProofOfWorkEngine:
+		if len(c.Signers) > 0 {
+			return errors.New("proof of work does not use signers")
+		}
+	case ProofOfAuthorityEngine:
+		if len(c.Signers) == 0 {
+			return errors.New("proof of authority needs at least one signer")
+		}
+
+		seen := make(map[string]bool)
+		for _, signer := range c.Signers {
+			if err := validateSigner(signer); err != nil {
+				return err
+			}
+			if seen[signer] {
+				return fmt.Errorf("signer %s is listed twice", signer)
+			}
+			seen[signer] = true
+		}
+	default:
+		return fmt.Errorf("unknown consensus engine %q", c.Engine)
+	}
+
+	return nil
+}
+
+func validateSigner(address string) error {
+	version, _, err := Wallet.DecodeAddress(address)
+	if err != nil || version != Wallet.Version {
+		return fmt.Errorf("signer %s is not a valid public key address", address)
+	}
+
+	return nil
+}
+
+func (c ConsensusConfig) Serialize() []byte {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(c)
+	Handler.Handle(err)
+
+	return buffer.Bytes()
+}
+
+func DeserializeConsensusConfig(data []byte) ConsensusConfig {
+	var config ConsensusConfig
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&config)
+	Handler.Handle(err)
+
+	return config
+}
+
+func loadConsensusConfig(db *badger.DB) ConsensusConfig {
+	config := ConsensusConfig{Engine: ProofOfWorkEngine}
+
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(consensusKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			config = DeserializeConsensusConfig(val)
+			return nil
+		})
+	})
+	Handler.Handle(err)
+
+	return config
+}
+
+func (chain *Chain) ConsensusConfig() ConsensusConfig {
+	return loadConsensusConfig(chain.Database)
+}
+
+func NewConsensus(chain *Chain, config ConsensusConfig) Consensus {
+	if config.Engine == ProofOfAuthorityEngine {
+		return NewProofOfAuthority(chain, config.Signers)
+	}
+
+	return ProofOfWorkConsensus{Algorithm: chain.Params.PowAlgorithm}
+}
+
+type ProofOfWorkConsensus struct {
+	Algorithm string
+}
+
+func (c ProofOfWorkConsensus) PowAlgorithm() (PowAlgorithm, error) {
+	return PowAlgorithmByName(c.Algorithm)
+}
+
+func (c ProofOfWorkConsensus) Seal(block *Block, quit <-chan struct{}) error {
+	algorithm, err := c.PowAlgorithm()
+	if err != nil {
+		return err
+	}
+	block.Algorithm = algorithm.Name()
+
+	nonce, hash, ok := NewProof(block).RunUntil(quit)
+	if !ok {
+		return ErrMiningInterrupted
+	}
+
+	block.Nonce = nonce
+	block.Hash = hash
+
+	return nil
+}
+
+func (c ProofOfWorkConsensus) Verify(block *Block) error {
+	return c.VerifyHeader(block.Header())
+}
+
+func (c ProofOfWorkConsensus) VerifyHeader(header Header) error {
+	if len(header.Signer) > 0 || len(header.Signature) > 0 || header.Vote.Address != "" {
+		return errors.New("proof of work blocks cannot carry a signer or a vote")
+	}
+
+	algorithm, err := c.PowAlgorithm()
+	if err != nil {
+		return err
+	}
+
+	if declared, err := PowAlgorithmByName(header.Algorithm); err != nil {
+		return err
+	} else if declared != algorithm {
+		return fmt.Errorf("block uses %s proof of work, the network requires %s", declared.Name(), algorithm.Name())
+	}
+
+	hash := algorithm.Hash(HeaderData(header.PrevHash, header.MerkleRoot, header.Timestamp, header.Height, header.Nonce, algorithm.Difficulty()))
+	if !bytes.Equal(header.Hash, hash) || new(big.Int).SetBytes(hash).Cmp(Target(algorithm.Difficulty())) != -1 {
+		return errors.New("block has an invalid proof of work")
+	}
+
+	return nil
+}
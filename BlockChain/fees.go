@@ -0,0 +1,203 @@
+package BlockChain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger"
+	"github.com/koushamad/blockchain/Handler"
+	"math"
+)
+
+const (
+	DefaultConfirmationTarget = 6
+	FeeEstimateWindow         = 100
+	feeBucketStart            = 0.0001
+	feeBucketSpacing          = 1.2
+	feeBucketCount            = 100
+	feeSuccessThreshold       = 0.85
+	minFeeSamples             = 2
+	scriptSigEstimate         = 1 + 64 + 1 + 64
+)
+
+var FeeStatsPrefix = []byte("feestats-")
+
+type FeeRecord struct {
+	FeeRate float64
+	Blocks  int
+	Seconds int64
+}
+
+type feeBucket struct {
+	confirmed int
+	total     int
+	minRate   float64
+}
+
+func feeStatsKey(height int) []byte {
+	key := make([]byte, len(FeeStatsPrefix)+8)
+	copy(key, FeeStatsPrefix)
+	binary.BigEndian.PutUint64(key[len(FeeStatsPrefix):], uint64(height))
+
+	return key
+}
+
+func feeBucketIndex(rate float64) int {
+	if rate < feeBucketStart {
+		return 0
+	}
+
+	index := 1 + int(math.Log(rate/feeBucketStart)/math.Log(feeBucketSpacing))
+	if index >= feeBucketCount {
+		return feeBucketCount - 1
+	}
+
+	return index
+}
+
+func (tx Transaction) EstimateSignedSize() int {
+	size := tx.Size()
+	for _, in := range tx.Inputs {
+		if len(in.ScriptSig) == 0 {
+			size += scriptSigEstimate
+		}
+	}
+
+	return size
+}
+
+func (u UTXOSet) withFeeEstimate(options TxOptions) TxOptions {
+	if options.FeeTarget == 0 || options.Fee != 0 || options.FeeRate != 0 {
+		return options
+	}
+
+	if rate, err := (Mempool{Chain: u.Chain}).EstimateFeeRate(options.FeeTarget); err == nil {
+		options.FeeRate = rate
+	}
+
+	return options
+}
+
+func (m Mempool) recordConfirmations(txn *badger.Txn, block *Block, entries map[string]MempoolEntry) error {
+	var records []FeeRecord
+
+	for _, tx := range block.Transactions {
+		entry, ok := entries[hex.EncodeToString(tx.ID)]
+		if !ok {
+			continue
+		}
+
+		records = append(records, FeeRecord{
+			FeeRate: entry.FeeRate(),
+			Blocks:  block.Height - entry.Height,
+			Seconds: block.Timestamp - entry.Time,
+		})
+	}
+
+	if stale := block.Height - FeeEstimateWindow; stale >= 0 {
+		if err := txn.Delete(feeStatsKey(stale)); err != nil {
+			return err
+		}
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(records); err != nil {
+		return err
+	}
+
+	return txn.Set(feeStatsKey(block.Height), buffer.Bytes())
+}
+
+func (m Mempool) FeeRecords() []FeeRecord {
+	var records []FeeRecord
+
+	err := m.Chain.Database.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(FeeStatsPrefix); it.ValidForPrefix(FeeStatsPrefix); it.Next() {
+			if err := it.Item().Value(func(val []byte) error {
+				var blockRecords []FeeRecord
+				if err := gob.NewDecoder(bytes.NewReader(val)).Decode(&blockRecords); err != nil {
+					return err
+				}
+				records = append(records, blockRecords...)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	Handler.Handle(err)
+
+	return records
+}
+
+func (m Mempool) EstimateFeeRate(target int) (float64, error) {
+	if target < 1 {
+		return 0, errors.New("confirmation target must be at least 1 block")
+	}
+
+	var buckets [feeBucketCount]feeBucket
+
+	add := func(rate float64, confirmed bool) {
+		bucket := &buckets[feeBucketIndex(rate)]
+		bucket.total++
+		if confirmed {
+			bucket.confirmed++
+			if bucket.confirmed == 1 || rate < bucket.minRate {
+				bucket.minRate = rate
+			}
+		}
+	}
+
+	for _, record := range m.FeeRecords() {
+		add(record.FeeRate, record.Blocks <= target)
+	}
+
+	height := m.Chain.GetBestHeight()
+	for _, entry := range m.Entries() {
+		if height-entry.Height >= target {
+			add(entry.FeeRate(), false)
+		}
+	}
+
+	estimate := -1.0
+	confirmed, total := 0, 0
+	groupMin := math.Inf(1)
+
+	for i := feeBucketCount - 1; i >= 0; i-- {
+		confirmed += buckets[i].confirmed
+		total += buckets[i].total
+		if buckets[i].confirmed > 0 {
+			groupMin = math.Min(groupMin, buckets[i].minRate)
+		}
+
+		if total < minFeeSamples {
+			continue
+		}
+
+		if float64(confirmed)/float64(total) < feeSuccessThreshold {
+			break
+		}
+
+		estimate = groupMin
+		confirmed, total = 0, 0
+		groupMin = math.Inf(1)
+	}
+
+	if estimate < 0 {
+		return 0, fmt.Errorf("not enough fee data to estimate confirmation within %d blocks", target)
+	}
+
+	return estimate, nil
+}
@@ -0,0 +1,105 @@
+package BlockChain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/dgraph-io/badger"
+	"testing"
+)
+
+func storeFeeRecords(t *testing.T, chain *Chain, height int, records []FeeRecord) {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(records); err != nil {
+		t.Fatal(err)
+	}
+
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(feeStatsKey(height), buffer.Bytes())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func repeatRecord(record FeeRecord, n int) []FeeRecord {
+	records := make([]FeeRecord, n)
+	for i := range records {
+		records[i] = record
+	}
+
+	return records
+}
+
+func TestEstimateFeeRate(t *testing.T) {
+	fast := repeatRecord(FeeRecord{FeeRate: 2, Blocks: 1}, 3)
+	slow := repeatRecord(FeeRecord{FeeRate: 0.5, Blocks: 10}, 3)
+
+	tests := []struct {
+		name    string
+		records []FeeRecord
+		target  int
+		want    float64
+		ok      bool
+	}{
+		{"no data", nil, 1, 0, false},
+		{"target below one block", fast, 0, 0, false},
+		{"too few samples", fast[:1], 1, 0, false},
+		{"all confirmed in the next block", append(fast, repeatRecord(FeeRecord{FeeRate: 1, Blocks: 1}, 2)...), 1, 1, true},
+		{"too few samples at the lower rate", append(fast, FeeRecord{FeeRate: 1, Blocks: 1}), 1, 2, true},
+		{"next block needs the fast rate", append(fast, slow...), 1, 2, true},
+		{"ten blocks takes the slow rate", append(fast, slow...), 10, 0.5, true},
+		{"nothing confirms in time", slow, 1, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, address := newTestWallet()
+			chain := newTestChain(t, address)
+			if test.records != nil {
+				storeFeeRecords(t, chain, 1, test.records)
+			}
+
+			rate, err := Mempool{Chain: chain}.EstimateFeeRate(test.target)
+			if test.ok != (err == nil) {
+				t.Fatalf("got error %v, want success %t", err, test.ok)
+			}
+			if test.ok && rate != test.want {
+				t.Errorf("estimated %g, want %g", rate, test.want)
+			}
+		})
+	}
+}
+
+func TestRecordConfirmations(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	mempool := Mempool{Chain: chain}
+
+	tx := spend(chain, alice, bobAddress, 5, TxOptions{Fee: 2})
+	unsigned := tx.TrimmedCopy()
+	if unsigned.EstimateSignedSize() <= unsigned.Size() || tx.EstimateSignedSize() != tx.Size() {
+		t.Error("signed size is only estimated for unsigned inputs")
+	}
+	mineTransactions(t, chain, aliceAddress, tx)
+
+	records := mempool.FeeRecords()
+	if len(records) != 1 {
+		t.Fatalf("recorded %d confirmations, want 1", len(records))
+	}
+	if records[0].Blocks != 1 || records[0].FeeRate != 2/float64(tx.Size()) {
+		t.Errorf("recorded %+v", records[0])
+	}
+
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		return mempool.recordConfirmations(txn, &Block{Height: 1 + FeeEstimateWindow}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records := mempool.FeeRecords(); len(records) != 0 {
+		t.Errorf("%d confirmations kept beyond the window", len(records))
+	}
+}
@@ -0,0 +1,122 @@
+package BlockChain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Header is a block without its transactions, the merkle root commits to
+// them so a header can be checked before the block body is downloaded.
+type Header struct {
+	Hash       []byte
+	PrevHash   []byte
+	MerkleRoot []byte
+	Nonce      int
+	Height     int
+	Timestamp  int64
+	Algorithm  string
+	Signer     []byte
+	Signature  []byte
+	Vote       Vote
+}
+
+// HeaderIndex is a header chain validated ahead of its blocks, the node
+// syncing the chain provides it. Header also finds headers of side branches.
+type HeaderIndex interface {
+	HeaderHash(height int) ([]byte, bool)
+	Header(hash []byte) (Header, bool)
+}
+
+func (b *Block) Header() Header {
+	return Header{
+		Hash:       b.Hash,
+		PrevHash:   b.PrevHash,
+		MerkleRoot: b.HashTransactions(),
+		Nonce:      b.Nonce,
+		Height:     b.Height,
+		Timestamp:  b.Timestamp,
+		Algorithm:  b.Algorithm,
+		Signer:     b.Signer,
+		Signature:  b.Signature,
+		Vote:       b.Vote,
+	}
+}
+
+// Block puts the transactions of a header back into a block, the caller checks
+// them against the merkle root.
+func (h Header) Block(txs []*Transaction) *Block {
+	return &Block{
+		Hash:         h.Hash,
+		Transactions: txs,
+		PrevHash:     h.PrevHash,
+		Nonce:        h.Nonce,
+		Height:       h.Height,
+		Timestamp:    h.Timestamp,
+		Algorithm:    h.Algorithm,
+		Signer:       h.Signer,
+		Signature:    h.Signature,
+		Vote:         h.Vote,
+	}
+}
+
+// Work is what a header adds to the weight of its chain, the 2^difficulty
+// hashes a proof of work takes on average or one for an authority's signature.
+func (h Header) Work() *big.Int {
+	algorithm, err := PowAlgorithmByName(h.Algorithm)
+	if len(h.Signer) > 0 || err != nil {
+		return big.NewInt(1)
+	}
+
+	return new(big.Int).Lsh(big.NewInt(1), uint(algorithm.Difficulty()))
+}
+
+func (h Header) SealHash() []byte {
+	authorize := int64(0)
+	if h.Vote.Authorize {
+		authorize = 1
+	}
+
+	data := bytes.Join(
+		[][]byte{
+			HeaderData(h.PrevHash, h.MerkleRoot, h.Timestamp, h.Height, h.Nonce, Difficulty),
+			[]byte(h.Vote.Address),
+			ToHex(authorize),
+			h.Signer,
+		},
+		[]byte{},
+	)
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
+
+func (h Header) SignerAddress() string {
+	return (&Block{Signer: h.Signer}).SignerAddress()
+}
+
+// CheckHeader validates a header that extends prev before its block is known:
+// the link, the height, the time, the checkpoints and the consensus seal. The
+// median time past needs the blocks before it and waits for ConnectBlock.
+func (chain *Chain) CheckHeader(header Header, prev Header) error {
+	if !bytes.Equal(header.PrevHash, prev.Hash) {
+		return errors.New("header does not link to the previous header")
+	}
+
+	if header.Height != prev.Height+1 {
+		return fmt.Errorf("header has height %d after height %d", header.Height, prev.Height)
+	}
+
+	if limit := time.Now().Unix() + MaxFutureBlockTime; header.Timestamp > limit {
+		return fmt.Errorf("header time %d is more than %d seconds in the future", header.Timestamp, MaxFutureBlockTime)
+	}
+
+	if err := chain.CheckCheckpoint(header.Height, header.Hash); err != nil {
+		return err
+	}
+
+	return chain.Consensus.VerifyHeader(header)
+}
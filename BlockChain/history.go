@@ -0,0 +1,61 @@
+package BlockChain
+
+import (
+	"fmt"
+)
+
+type HistoryEntry struct {
+	TxID      []byte
+	Height    int
+	Timestamp int64
+	Received  int
+	Sent      int
+}
+
+func (chain *Chain) FindHistory(pubKeyHash []byte) []HistoryEntry {
+	var blocks []*Block
+	var history []HistoryEntry
+
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		blocks = append(blocks, block)
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	owned := make(map[string]int)
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+
+		for _, tx := range block.Transactions {
+			entry := HistoryEntry{TxID: tx.ID, Height: block.Height, Timestamp: block.Timestamp}
+
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Inputs {
+					key := fmt.Sprintf("%x:%d", in.ID, in.Out)
+					if value, ok := owned[key]; ok {
+						entry.Sent += value
+						delete(owned, key)
+					}
+				}
+			}
+
+			for outIdx, out := range tx.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) {
+					owned[fmt.Sprintf("%x:%d", tx.ID, outIdx)] = out.Value
+					entry.Received += out.Value
+				}
+			}
+
+			if entry.Received != 0 || entry.Sent != 0 {
+				history = append(history, entry)
+			}
+		}
+	}
+
+	return history
+}
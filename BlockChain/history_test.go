@@ -0,0 +1,36 @@
+package BlockChain
+
+import (
+	"bytes"
+	"github.com/koushamad/blockchain/Wallet"
+	"testing"
+)
+
+func TestFindHistory(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	bob, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	genesis := chain.Iterator().Next().Transactions[0]
+
+	tx := spend(chain, alice, bobAddress, 5, TxOptions{Fee: 1})
+	block := mineTransactions(t, chain, bobAddress, tx)
+
+	history := chain.FindHistory(Wallet.PublicKeyHash(alice.PublicKey))
+	if len(history) != 2 {
+		t.Fatalf("alice has %d history entries, want 2", len(history))
+	}
+	if entry := history[0]; !bytes.Equal(entry.TxID, genesis.ID) || entry.Height != 0 || entry.Received != BlockSubsidy || entry.Sent != 0 {
+		t.Errorf("first entry is %+v, want the genesis coinbase", entry)
+	}
+	if entry := history[1]; !bytes.Equal(entry.TxID, tx.ID) || entry.Height != 1 || entry.Sent != BlockSubsidy || entry.Received != BlockSubsidy-6 {
+		t.Errorf("second entry is %+v, want the payment with its change", entry)
+	}
+
+	history = chain.FindHistory(Wallet.PublicKeyHash(bob.PublicKey))
+	if len(history) != 2 || history[0].Received+history[1].Received != BlockSubsidy+1+5 {
+		t.Errorf("bob has history %+v, want the coinbase with the fee and the payment", history)
+	}
+	if history[0].Timestamp != block.Timestamp {
+		t.Errorf("entry has time %d, want the block time %d", history[0].Timestamp, block.Timestamp)
+	}
+}
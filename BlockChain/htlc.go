@@ -0,0 +1,236 @@
+package BlockChain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"math"
+)
+
+const PreimageLength = 32
+
+type HTLC struct {
+	Hash          []byte
+	RecipientHash []byte
+	RefundHash    []byte
+	Timeout       int64
+}
+
+func NewHTLCScript(htlc HTLC) []byte {
+	return mustScript(NewScriptBuilder().
+		AddOp(OpIf).
+		AddOp(OpSha256).
+		AddData(htlc.Hash).
+		AddOp(OpEqualVerify).
+		AddOp(OpDup).
+		AddOp(OpHash160).
+		AddData(htlc.RecipientHash).
+		AddOp(OpElse).
+		AddInt(htlc.Timeout).
+		AddOp(OpCheckLockTimeVerify).
+		AddOp(OpDrop).
+		AddOp(OpDup).
+		AddOp(OpHash160).
+		AddData(htlc.RefundHash).
+		AddOp(OpEndIf).
+		AddOp(OpEqualVerify).
+		AddOp(OpCheckSig))
+}
+
+func ExtractHTLC(script []byte) (HTLC, error) {
+	ops, err := ParseScript(script)
+	if err != nil {
+		return HTLC{}, err
+	}
+
+	if !isHTLC(ops) {
+		return HTLC{}, errors.New("script is not a hash time-locked contract")
+	}
+
+	timeout, ok := smallInt(ops[8].Opcode)
+	htlc := HTLC{Hash: ops[2].Data, RecipientHash: ops[6].Data, RefundHash: ops[13].Data, Timeout: int64(timeout)}
+	if !ok {
+		if htlc.Timeout, err = decodeScriptNum(ops[8].Data, 5); err != nil {
+			return HTLC{}, err
+		}
+	}
+
+	return htlc, nil
+}
+
+func isHTLC(ops []ScriptOp) bool {
+	pattern := []byte{OpIf, OpSha256, 0, OpEqualVerify, OpDup, OpHash160, 0, OpElse, 0,
+		OpCheckLockTimeVerify, OpDrop, OpDup, OpHash160, 0, OpEndIf, OpEqualVerify, OpCheckSig}
+
+	if len(ops) != len(pattern) {
+		return false
+	}
+
+	for i, opcode := range pattern {
+		if opcode != 0 && ops[i].Opcode != opcode {
+			return false
+		}
+	}
+
+	if _, ok := smallInt(ops[8].Opcode); !ok && ops[8].Data == nil {
+		return false
+	}
+
+	return len(ops[2].Data) == sha256.Size && len(ops[6].Data) == HashLength && len(ops[13].Data) == HashLength
+}
+
+func NewHTLCTransaction(wallets *Wallet.Wallets, from, to, refund string, amount int, hash []byte, timeout int64, UTXO *UTXOSet) *Transaction {
+	if len(hash) != sha256.Size {
+		Handler.Handle(errors.New("hash lock must be a SHA-256 digest"))
+	}
+
+	_, recipientHash, err := Wallet.DecodeAddress(to)
+	Handler.Handle(err)
+	_, refundHash, err := Wallet.DecodeAddress(refund)
+	Handler.Handle(err)
+
+	w := wallets.GetWallet(from)
+
+	script := NewHTLCScript(HTLC{hash, recipientHash, refundHash, timeout})
+	tx := FundFromWallet(wallets, from, []TXOutput{{amount, script}}, UTXO, TxOptions{})
+	UTXO.Chain.SignTransaction(tx, w.PrivateKey)
+
+	return tx
+}
+
+func NewHTLCRedeemTransaction(txID []byte, outIdx int, preimage []byte, w Wallet.Wallet, to string, UTXO *UTXOSet, options TxOptions) (*Transaction, error) {
+	out, htlc, err := findHTLC(txID, outIdx, UTXO)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(preimage)
+	if !bytes.Equal(hash[:], htlc.Hash) {
+		return nil, errors.New("preimage does not match the hash lock")
+	}
+
+	if !bytes.Equal(Wallet.PublicKeyHash(w.PublicKey), htlc.RecipientHash) {
+		return nil, errors.New("wallet is not the recipient of the contract")
+	}
+
+	tx := Transaction{
+		Inputs:  []TxInput{{ID: txID, Out: outIdx, Sequence: SequenceFinal}},
+		Outputs: []TXOutput{*NewTXOutput(out.Value, to)},
+	}
+	if err := UTXO.payHTLCFee(&tx, preimage, options); err != nil {
+		return nil, err
+	}
+
+	signature := tx.SignInput(0, w.PrivateKey, out.ScriptPubKey)
+	tx.Inputs[0].ScriptSig, err = NewScriptBuilder().
+		AddData(signature).
+		AddData(w.PublicKey).
+		AddData(preimage).
+		AddOp(OpTrue).
+		Script()
+
+	return &tx, err
+}
+
+func NewHTLCRefundTransaction(txID []byte, outIdx int, w Wallet.Wallet, to string, UTXO *UTXOSet, options TxOptions) (*Transaction, error) {
+	out, htlc, err := findHTLC(txID, outIdx, UTXO)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(Wallet.PublicKeyHash(w.PublicKey), htlc.RefundHash) {
+		return nil, errors.New("wallet is not the refund address of the contract")
+	}
+
+	tx := Transaction{
+		Inputs:   []TxInput{{ID: txID, Out: outIdx, Sequence: SequenceFinal - 1}},
+		Outputs:  []TXOutput{*NewTXOutput(out.Value, to)},
+		LockTime: htlc.Timeout,
+	}
+	if err := UTXO.payHTLCFee(&tx, nil, options); err != nil {
+		return nil, err
+	}
+
+	signature := tx.SignInput(0, w.PrivateKey, out.ScriptPubKey)
+	tx.Inputs[0].ScriptSig, err = NewScriptBuilder().
+		AddData(signature).
+		AddData(w.PublicKey).
+		AddOp(OpFalse).
+		Script()
+
+	return &tx, err
+}
+
+// payHTLCFee takes the fee out of the single output of a redeem or refund,
+// a fee rate is charged on the signed size which also carries the preimage.
+func (u UTXOSet) payHTLCFee(tx *Transaction, preimage []byte, options TxOptions) error {
+	options = u.withFeeEstimate(options)
+
+	fee := options.Fee
+	if options.FeeRate > 0 {
+		size := tx.EstimateSignedSize() + len(preimage) + 2
+		if rated := int(math.Ceil(options.FeeRate * float64(size))); rated > fee {
+			fee = rated
+		}
+	}
+
+	if fee < 0 {
+		return errors.New("fee can not be negative")
+	}
+	if fee >= tx.Outputs[0].Value {
+		return fmt.Errorf("fee of %d leaves nothing of the %d locked in the contract", fee, tx.Outputs[0].Value)
+	}
+
+	tx.Outputs[0].Value -= fee
+	tx.ID = tx.Hash()
+
+	return nil
+}
+
+func findHTLC(txID []byte, outIdx int, UTXO *UTXOSet) (TXOutput, HTLC, error) {
+	outs, ok := UTXO.GetOutputs(txID)
+	if !ok {
+		return TXOutput{}, HTLC{}, errors.New("contract output is spent or does not exist")
+	}
+
+	out, ok := outs.Outputs[outIdx]
+	if !ok {
+		return TXOutput{}, HTLC{}, fmt.Errorf("output %d is spent or does not exist", outIdx)
+	}
+
+	htlc, err := ExtractHTLC(out.ScriptPubKey)
+
+	return out, htlc, err
+}
+
+func (chain *Chain) FindHTLCPreimage(txID []byte, outIdx int) ([]byte, error) {
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			for _, in := range tx.Inputs {
+				if !bytes.Equal(in.ID, txID) || in.Out != outIdx {
+					continue
+				}
+
+				ops, err := ParseScript(in.ScriptSig)
+				if err != nil || len(ops) != 4 || ops[3].Opcode != OpTrue {
+					return nil, errors.New("contract was refunded")
+				}
+
+				return ops[2].Data, nil
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return nil, errors.New("contract has not been redeemed")
+}
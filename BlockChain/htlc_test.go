@@ -0,0 +1,154 @@
+package BlockChain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"github.com/koushamad/blockchain/Wallet"
+	"testing"
+)
+
+func lockHTLC(t *testing.T, chain *Chain, from *Wallet.Wallet, htlc HTLC, amount int) *Transaction {
+	t.Helper()
+
+	UTXO := UTXOSet{Chain: chain}
+	tx := FundTransaction(string(from.Address()), []TXOutput{{amount, NewHTLCScript(htlc)}}, &UTXO, TxOptions{Fee: 1})
+	chain.SignTransaction(tx, from.PrivateKey)
+	mineTransactions(t, chain, string(from.Address()), tx)
+
+	return tx
+}
+
+func newPreimage(t *testing.T) ([]byte, []byte) {
+	preimage := make([]byte, PreimageLength)
+	if _, err := rand.Read(preimage); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(preimage)
+
+	return preimage, hash[:]
+}
+
+// TestHTLCAtomicSwap swaps coins between two chains, Alice locks on chain A
+// for Bob and Bob on chain B for Alice under the same hash. Alice redeeming on
+// B reveals the preimage which Bob then uses to redeem on A.
+func TestHTLCAtomicSwap(t *testing.T) {
+	const amount, fee = 10, 2
+
+	alice, aliceAddress := newTestWallet()
+	bob, bobAddress := newTestWallet()
+	chainA := newTestChain(t, aliceAddress)
+	chainB := newTestChain(t, bobAddress)
+	aliceHash := Wallet.PublicKeyHash(alice.PublicKey)
+	bobHash := Wallet.PublicKeyHash(bob.PublicKey)
+
+	preimage, hash := newPreimage(t)
+	lockA := lockHTLC(t, chainA, alice, HTLC{hash, bobHash, aliceHash, 20}, amount)
+	lockB := lockHTLC(t, chainB, bob, HTLC{hash, aliceHash, bobHash, 10}, amount)
+
+	UTXOB := UTXOSet{Chain: chainB}
+	redeemB, err := NewHTLCRedeemTransaction(lockB.ID, 0, preimage, *alice, aliceAddress, &UTXOB, TxOptions{Fee: fee})
+	if err != nil {
+		t.Fatalf("redeeming on chain B: %s", err)
+	}
+	blockB := mineTransactions(t, chainB, bobAddress, redeemB)
+
+	revealed, err := chainB.FindHTLCPreimage(lockB.ID, 0)
+	if err != nil {
+		t.Fatalf("finding the preimage on chain B: %s", err)
+	}
+	if !bytes.Equal(revealed, preimage) {
+		t.Fatalf("revealed preimage %x, want %x", revealed, preimage)
+	}
+
+	UTXOA := UTXOSet{Chain: chainA}
+	redeemA, err := NewHTLCRedeemTransaction(lockA.ID, 0, revealed, *bob, bobAddress, &UTXOA, TxOptions{Fee: fee})
+	if err != nil {
+		t.Fatalf("redeeming on chain A: %s", err)
+	}
+	blockA := mineTransactions(t, chainA, aliceAddress, redeemA)
+
+	for name, swap := range map[string]struct {
+		chain  *Chain
+		lock   *Transaction
+		redeem *Transaction
+		block  *Block
+	}{
+		"chain A": {chainA, lockA, redeemA, blockA},
+		"chain B": {chainB, lockB, redeemB, blockB},
+	} {
+		if got := swap.redeem.Outputs[0].Value; got != amount-fee {
+			t.Errorf("%s: redeem pays %d, want %d", name, got, amount-fee)
+		}
+		if got := swap.block.Transactions[0].Outputs[0].Value; got != BlockSubsidy+fee {
+			t.Errorf("%s: coinbase pays %d, want the subsidy plus the %d fee", name, got, fee)
+		}
+		if outs, ok := (UTXOSet{Chain: swap.chain}).GetOutputs(swap.lock.ID); ok {
+			if _, unspent := outs.Outputs[0]; unspent {
+				t.Errorf("%s: contract output is still unspent", name)
+			}
+		}
+	}
+}
+
+func TestHTLCSpendErrors(t *testing.T) {
+	const amount, timeout = 10, 3
+
+	alice, aliceAddress := newTestWallet()
+	bob, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	UTXO := UTXOSet{Chain: chain}
+
+	preimage, hash := newPreimage(t)
+	htlc := HTLC{hash, Wallet.PublicKeyHash(bob.PublicKey), Wallet.PublicKeyHash(alice.PublicKey), timeout}
+	lock := lockHTLC(t, chain, alice, htlc, amount)
+
+	tests := []struct {
+		name  string
+		build func() (*Transaction, error)
+	}{
+		{"wrong preimage", func() (*Transaction, error) {
+			return NewHTLCRedeemTransaction(lock.ID, 0, make([]byte, PreimageLength), *bob, bobAddress, &UTXO, TxOptions{})
+		}},
+		{"redeem by the refund wallet", func() (*Transaction, error) {
+			return NewHTLCRedeemTransaction(lock.ID, 0, preimage, *alice, aliceAddress, &UTXO, TxOptions{})
+		}},
+		{"redeem fee takes the whole value", func() (*Transaction, error) {
+			return NewHTLCRedeemTransaction(lock.ID, 0, preimage, *bob, bobAddress, &UTXO, TxOptions{Fee: amount})
+		}},
+		{"negative redeem fee", func() (*Transaction, error) {
+			return NewHTLCRedeemTransaction(lock.ID, 0, preimage, *bob, bobAddress, &UTXO, TxOptions{Fee: -1})
+		}},
+		{"refund by the recipient", func() (*Transaction, error) {
+			return NewHTLCRefundTransaction(lock.ID, 0, *bob, bobAddress, &UTXO, TxOptions{})
+		}},
+		{"missing output", func() (*Transaction, error) {
+			return NewHTLCRefundTransaction(lock.ID, 5, *alice, aliceAddress, &UTXO, TxOptions{})
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if tx, err := test.build(); err == nil {
+				t.Errorf("built transaction %x, want an error", tx.ID)
+			}
+		})
+	}
+
+	refund, err := NewHTLCRefundTransaction(lock.ID, 0, *alice, aliceAddress, &UTXO, TxOptions{FeeRate: 0.01})
+	if err != nil {
+		t.Fatalf("building the refund: %s", err)
+	}
+	if refund.Outputs[0].Value >= amount {
+		t.Errorf("refund pays %d, want less than the %d locked", refund.Outputs[0].Value, amount)
+	}
+
+	if err := (Mempool{Chain: chain}).Add(refund); err == nil {
+		t.Fatalf("mempool accepted a refund at height %d before the timeout %d", chain.GetBestHeight(), timeout)
+	}
+
+	for chain.GetBestHeight() < timeout {
+		mineTransactions(t, chain, aliceAddress)
+	}
+	mineTransactions(t, chain, aliceAddress, refund)
+}
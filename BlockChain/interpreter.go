@@ -0,0 +1,468 @@
+package BlockChain
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/Wallet"
+	"math/big"
+)
+
+const (
+	MaxStackSize   = 1000
+	SignatureSize  = 2 * Wallet.KeyLength
+	maxNumberBytes = 4
+)
+
+type ScriptEngine struct {
+	tx        *Transaction
+	inputIdx  int
+	stack     [][]byte
+	condStack []bool
+}
+
+func NewScriptEngine(tx *Transaction, inputIdx int) *ScriptEngine {
+	return &ScriptEngine{tx: tx, inputIdx: inputIdx}
+}
+
+func VerifyScript(scriptSig, scriptPubKey []byte, tx *Transaction, inputIdx int) error {
+	if len(scriptSig) > MaxScriptSize || len(scriptPubKey) > MaxScriptSize {
+		return errors.New("script is too large")
+	}
+
+	if !IsPushOnly(scriptSig) {
+		return errors.New("signature script is not push only")
+	}
+
+	engine := NewScriptEngine(tx, inputIdx)
+
+	if err := engine.Execute(scriptSig, nil); err != nil {
+		return err
+	}
+
+	sigStack := make([][]byte, len(engine.stack))
+	copy(sigStack, engine.stack)
+
+	if err := engine.Execute(scriptPubKey, scriptPubKey); err != nil {
+		return err
+	}
+
+	if !engine.Succeeded() {
+		return errors.New("script evaluated to false")
+	}
+
+	if ClassifyScript(scriptPubKey) != ScriptHashScript {
+		return nil
+	}
+
+	if len(sigStack) == 0 {
+		return errors.New("missing redeem script")
+	}
+
+	redeemScript := sigStack[len(sigStack)-1]
+	engine.stack = sigStack[:len(sigStack)-1]
+
+	if err := engine.Execute(redeemScript, redeemScript); err != nil {
+		return err
+	}
+
+	if !engine.Succeeded() {
+		return errors.New("redeem script evaluated to false")
+	}
+
+	return nil
+}
+
+func (e *ScriptEngine) Succeeded() bool {
+	return len(e.stack) > 0 && castToBool(e.stack[len(e.stack)-1])
+}
+
+func (e *ScriptEngine) Execute(script, subScript []byte) error {
+	ops, err := ParseScript(script)
+	if err != nil {
+		return err
+	}
+
+	e.condStack = nil
+
+	for _, op := range ops {
+		if err := e.step(op, subScript); err != nil {
+			return fmt.Errorf("%s: %s", opcodeName(op.Opcode), err)
+		}
+
+		if len(e.stack) > MaxStackSize {
+			return errors.New("stack size limit exceeded")
+		}
+	}
+
+	if len(e.condStack) != 0 {
+		return errors.New("unbalanced conditional")
+	}
+
+	return nil
+}
+
+func (e *ScriptEngine) executing() bool {
+	for _, cond := range e.condStack {
+		if !cond {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *ScriptEngine) push(data []byte) error {
+	if len(data) > MaxScriptElement {
+		return errors.New("stack element is too large")
+	}
+
+	e.stack = append(e.stack, data)
+
+	return nil
+}
+
+func (e *ScriptEngine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, errors.New("stack is empty")
+	}
+
+	top := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+
+	return top, nil
+}
+
+func (e *ScriptEngine) peek() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, errors.New("stack is empty")
+	}
+
+	return e.stack[len(e.stack)-1], nil
+}
+
+func (e *ScriptEngine) popInt() (int64, error) {
+	data, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeScriptNum(data, maxNumberBytes)
+}
+
+func (e *ScriptEngine) popBool() (bool, error) {
+	data, err := e.pop()
+	if err != nil {
+		return false, err
+	}
+
+	return castToBool(data), nil
+}
+
+func (e *ScriptEngine) step(op ScriptOp, subScript []byte) error {
+	switch op.Opcode {
+	case OpIf, OpNotIf:
+		if !e.executing() {
+			e.condStack = append(e.condStack, false)
+			return nil
+		}
+
+		cond, err := e.popBool()
+		if err != nil {
+			return err
+		}
+
+		if op.Opcode == OpNotIf {
+			cond = !cond
+		}
+		e.condStack = append(e.condStack, cond)
+		return nil
+	case OpElse:
+		if len(e.condStack) == 0 {
+			return errors.New("no matching OP_IF")
+		}
+
+		e.condStack[len(e.condStack)-1] = !e.condStack[len(e.condStack)-1]
+		return nil
+	case OpEndIf:
+		if len(e.condStack) == 0 {
+			return errors.New("no matching OP_IF")
+		}
+
+		e.condStack = e.condStack[:len(e.condStack)-1]
+		return nil
+	}
+
+	if !e.executing() {
+		return nil
+	}
+
+	switch {
+	case op.Opcode == Op0:
+		return e.push([]byte{})
+	case op.Opcode == Op1Negate:
+		return e.push(encodeScriptNum(-1))
+	case op.Opcode >= Op1 && op.Opcode <= Op16:
+		return e.push(encodeScriptNum(int64(op.Opcode-Op1) + 1))
+	case op.Opcode <= OpPushData4:
+		return e.push(op.Data)
+	}
+
+	switch op.Opcode {
+	case OpNop:
+		return nil
+	case OpVerify:
+		return e.verify()
+	case OpReturn:
+		return errors.New("script returned early")
+	case OpDrop:
+		_, err := e.pop()
+		return err
+	case OpDup:
+		top, err := e.peek()
+		if err != nil {
+			return err
+		}
+		return e.push(top)
+	case OpSwap:
+		if len(e.stack) < 2 {
+			return errors.New("stack has fewer than two items")
+		}
+		last := len(e.stack) - 1
+		e.stack[last], e.stack[last-1] = e.stack[last-1], e.stack[last]
+		return nil
+	case OpSize:
+		top, err := e.peek()
+		if err != nil {
+			return err
+		}
+		return e.push(encodeScriptNum(int64(len(top))))
+	case OpEqual, OpEqualVerify:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if err := e.push(fromBool(string(a) == string(b))); err != nil {
+			return err
+		}
+		if op.Opcode == OpEqualVerify {
+			return e.verify()
+		}
+		return nil
+	case OpSha256:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(data)
+		return e.push(hash[:])
+	case OpHash160:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		return e.push(Wallet.PublicKeyHash(data))
+	case OpCheckSig, OpCheckSigVerify:
+		pubKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		signature, err := e.pop()
+		if err != nil {
+			return err
+		}
+		valid := e.checkSignature(signature, pubKey, subScript)
+		if err := e.push(fromBool(valid)); err != nil {
+			return err
+		}
+		if op.Opcode == OpCheckSigVerify {
+			return e.verify()
+		}
+		return nil
+	case OpCheckLockTimeVerify:
+		return e.checkLockTime()
+	case OpCheckSequenceVerify:
+		return e.checkSequence()
+	case OpCheckMultiSig, OpCheckMultiSigVerify:
+		if err := e.checkMultiSig(subScript); err != nil {
+			return err
+		}
+		if op.Opcode == OpCheckMultiSigVerify {
+			return e.verify()
+		}
+		return nil
+	}
+
+	return errors.New("unknown opcode")
+}
+
+func (e *ScriptEngine) verify() error {
+	ok, err := e.popBool()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.New("verify failed")
+	}
+
+	return nil
+}
+
+func (e *ScriptEngine) checkMultiSig(subScript []byte) error {
+	total, err := e.popInt()
+	if err != nil {
+		return err
+	}
+
+	if total < 0 || total > MaxMultiSigKeys {
+		return errors.New("invalid public key count")
+	}
+
+	pubKeys := make([][]byte, total)
+	for i := total - 1; i >= 0; i-- {
+		if pubKeys[i], err = e.pop(); err != nil {
+			return err
+		}
+	}
+
+	required, err := e.popInt()
+	if err != nil {
+		return err
+	}
+
+	if required < 0 || required > total {
+		return errors.New("invalid signature count")
+	}
+
+	signatures := make([][]byte, required)
+	for i := required - 1; i >= 0; i-- {
+		if signatures[i], err = e.pop(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := e.pop(); err != nil {
+		return errors.New("missing dummy element")
+	}
+
+	keyIdx := 0
+	valid := true
+	for _, signature := range signatures {
+		for keyIdx < len(pubKeys) && !e.checkSignature(signature, pubKeys[keyIdx], subScript) {
+			keyIdx++
+		}
+
+		if keyIdx == len(pubKeys) {
+			valid = false
+			break
+		}
+		keyIdx++
+	}
+
+	return e.push(fromBool(valid))
+}
+
+func (e *ScriptEngine) peekLockValue() (int64, error) {
+	top, err := e.peek()
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := decodeScriptNum(top, 5)
+	if err != nil {
+		return 0, err
+	}
+
+	if value < 0 {
+		return 0, errors.New("negative lock time")
+	}
+
+	return value, nil
+}
+
+func (e *ScriptEngine) checkLockTime() error {
+	lockTime, err := e.peekLockValue()
+	if err != nil {
+		return err
+	}
+
+	if e.tx == nil {
+		return errors.New("no transaction to check against")
+	}
+
+	if (lockTime < LockTimeThreshold) != (e.tx.LockTime < LockTimeThreshold) {
+		return errors.New("lock time type mismatch")
+	}
+
+	if lockTime > e.tx.LockTime {
+		return fmt.Errorf("locked until %d, transaction lock time is %d", lockTime, e.tx.LockTime)
+	}
+
+	if e.tx.Inputs[e.inputIdx].Sequence == SequenceFinal {
+		return errors.New("input sequence is final")
+	}
+
+	return nil
+}
+
+func (e *ScriptEngine) checkSequence() error {
+	value, err := e.peekLockValue()
+	if err != nil {
+		return err
+	}
+
+	sequence := uint32(value)
+	if sequence&SequenceLockTimeDisabled != 0 {
+		return nil
+	}
+
+	if e.tx == nil {
+		return errors.New("no transaction to check against")
+	}
+
+	txSequence := e.tx.Inputs[e.inputIdx].Sequence
+	if txSequence&SequenceLockTimeDisabled != 0 {
+		return errors.New("input relative lock time is disabled")
+	}
+
+	if sequence&SequenceLockTimeIsTime != txSequence&SequenceLockTimeIsTime {
+		return errors.New("relative lock time type mismatch")
+	}
+
+	if sequence&SequenceLockTimeMask > txSequence&SequenceLockTimeMask {
+		return fmt.Errorf("relatively locked for %d, input sequence is %d", sequence&SequenceLockTimeMask, txSequence&SequenceLockTimeMask)
+	}
+
+	return nil
+}
+
+func (e *ScriptEngine) checkSignature(signature, pubKey, subScript []byte) bool {
+	if e.tx == nil || len(signature) != SignatureSize {
+		return false
+	}
+
+	rawPubKey, err := Wallet.ParsePublicKey(pubKey)
+	if err != nil {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:Wallet.KeyLength])
+	s := new(big.Int).SetBytes(signature[Wallet.KeyLength:])
+	hash := e.tx.SignatureHash(e.inputIdx, subScript)
+
+	return ecdsa.Verify(rawPubKey, hash, r, s)
+}
+
+func fromBool(value bool) []byte {
+	if value {
+		return []byte{1}
+	}
+
+	return []byte{}
+}
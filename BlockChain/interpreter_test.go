@@ -0,0 +1,181 @@
+package BlockChain
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func script(t *testing.T, b *ScriptBuilder) []byte {
+	t.Helper()
+
+	result, err := b.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestVerifyScript(t *testing.T) {
+	preimage := []byte("preimage")
+	hash := sha256.Sum256(preimage)
+	hashLock := NewHashLockScript(hash[:])
+
+	tests := []struct {
+		name         string
+		scriptSig    []byte
+		scriptPubKey []byte
+		ok           bool
+	}{
+		{"true", nil, []byte{OpTrue}, true},
+		{"false", nil, []byte{OpFalse}, false},
+		{"empty stack", nil, nil, false},
+		{"small integers", []byte{Op1 + 2}, []byte{Op1 + 2, OpEqual}, true},
+		{"negative one", []byte{Op1Negate}, script(t, NewScriptBuilder().AddInt(-1).AddOp(OpEqual)), true},
+		{"if branch", []byte{OpTrue}, []byte{OpIf, OpTrue, OpElse, OpFalse, OpEndIf}, true},
+		{"else branch", []byte{OpFalse}, []byte{OpIf, OpFalse, OpElse, OpTrue, OpEndIf}, true},
+		{"not if", []byte{OpFalse}, []byte{OpNotIf, OpTrue, OpEndIf}, true},
+		{"skipped return", []byte{OpFalse}, []byte{OpIf, OpReturn, OpEndIf, OpTrue}, true},
+		{"unbalanced if", []byte{OpTrue}, []byte{OpIf, OpTrue}, false},
+		{"else without if", nil, []byte{OpElse}, false},
+		{"end if without if", nil, []byte{OpEndIf}, false},
+		{"return", nil, []byte{OpReturn, OpTrue}, false},
+		{"verify false", nil, []byte{OpFalse, OpVerify, OpTrue}, false},
+		{"drop from an empty stack", nil, []byte{OpDrop}, false},
+		{"swap one item", []byte{OpTrue}, []byte{OpSwap}, false},
+		{"size", script(t, NewScriptBuilder().AddData([]byte("abc"))), []byte{OpSize, Op1 + 2, OpEqualVerify, OpDrop, OpTrue}, true},
+		{"unknown opcode", nil, []byte{0xff}, false},
+		{"negative zero is false", script(t, NewScriptBuilder().AddData([]byte{0x80})), nil, false},
+		{"signature script with an opcode", []byte{OpTrue, OpDup}, []byte{OpTrue}, false},
+		{"hash lock", script(t, NewScriptBuilder().AddData(preimage)), hashLock, true},
+		{"hash lock with the wrong preimage", script(t, NewScriptBuilder().AddData([]byte("wrong"))), hashLock, false},
+		{"pay to script hash", script(t, NewScriptBuilder().AddData(preimage).AddData(hashLock)), NewPayToScriptHashScript(ScriptHash(hashLock)), true},
+		{"pay to script hash with the wrong preimage", script(t, NewScriptBuilder().AddData([]byte("wrong")).AddData(hashLock)), NewPayToScriptHashScript(ScriptHash(hashLock)), false},
+		{"pay to script hash with another script", script(t, NewScriptBuilder().AddData([]byte{OpTrue})), NewPayToScriptHashScript(ScriptHash(hashLock)), false},
+		{"oversized script", nil, make([]byte, MaxScriptSize+1), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyScript(test.scriptSig, test.scriptPubKey, nil, 0)
+			if test.ok != (err == nil) {
+				t.Errorf("got error %v, want success %t", err, test.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyPayToPubKeyHash(t *testing.T) {
+	w, address := newTestWallet()
+	other, _ := newTestWallet()
+	scriptPubKey, err := LockingScript(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTx := func() *Transaction {
+		tx := &Transaction{
+			Inputs:  []TxInput{{ID: []byte("previous"), Out: 0, Sequence: SequenceFinal}},
+			Outputs: []TXOutput{*NewTXOutput(5, address)},
+		}
+		tx.ID = tx.Hash()
+		return tx
+	}
+
+	tests := []struct {
+		name string
+		sign func(tx *Transaction) []byte
+		ok   bool
+	}{
+		{"signed", func(tx *Transaction) []byte {
+			return script(t, NewScriptBuilder().AddData(tx.SignInput(0, w.PrivateKey, scriptPubKey)).AddData(w.PublicKey))
+		}, true},
+		{"signed by another key", func(tx *Transaction) []byte {
+			return script(t, NewScriptBuilder().AddData(tx.SignInput(0, other.PrivateKey, scriptPubKey)).AddData(w.PublicKey))
+		}, false},
+		{"another public key", func(tx *Transaction) []byte {
+			return script(t, NewScriptBuilder().AddData(tx.SignInput(0, other.PrivateKey, scriptPubKey)).AddData(other.PublicKey))
+		}, false},
+		{"output changed after signing", func(tx *Transaction) []byte {
+			signature := tx.SignInput(0, w.PrivateKey, scriptPubKey)
+			tx.Outputs[0].Value++
+			return script(t, NewScriptBuilder().AddData(signature).AddData(w.PublicKey))
+		}, false},
+		{"short signature", func(tx *Transaction) []byte {
+			return script(t, NewScriptBuilder().AddData([]byte{1}).AddData(w.PublicKey))
+		}, false},
+		{"no signature", func(tx *Transaction) []byte {
+			return script(t, NewScriptBuilder().AddData(w.PublicKey))
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := newTx()
+			scriptSig := test.sign(tx)
+
+			err := VerifyScript(scriptSig, scriptPubKey, tx, 0)
+			if test.ok != (err == nil) {
+				t.Errorf("got error %v, want success %t", err, test.ok)
+			}
+		})
+	}
+}
+
+func TestScriptNum(t *testing.T) {
+	for _, num := range []int64{0, 1, -1, 127, 128, -128, 255, 256, -32768, 1 << 30, -(1 << 31) + 1} {
+		encoded := encodeScriptNum(num)
+		decoded, err := decodeScriptNum(encoded, 5)
+		if err != nil || decoded != num {
+			t.Errorf("%d encoded as %x decoded as %d %v", num, encoded, decoded, err)
+		}
+	}
+
+	if _, err := decodeScriptNum(make([]byte, maxNumberBytes+1), maxNumberBytes); err == nil {
+		t.Error("decoded a number longer than the limit")
+	}
+}
+
+func TestVerifyLockTimeScripts(t *testing.T) {
+	absolute := NewTimeLockScript(OpCheckLockTimeVerify, 100, []byte{OpTrue})
+	relative := NewTimeLockScript(OpCheckSequenceVerify, 10, []byte{OpTrue})
+	relativeTime := NewTimeLockScript(OpCheckSequenceVerify, int64(SequenceLockTimeIsTime|2), []byte{OpTrue})
+	disabled := NewTimeLockScript(OpCheckSequenceVerify, int64(SequenceLockTimeDisabled), []byte{OpTrue})
+
+	spending := func(lockTime int64, sequence uint32) *Transaction {
+		return &Transaction{
+			Inputs:   []TxInput{{ID: []byte("previous"), Out: 0, Sequence: sequence}},
+			Outputs:  []TXOutput{{Value: 1}},
+			LockTime: lockTime,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		scriptPubKey []byte
+		tx           *Transaction
+		ok           bool
+	}{
+		{"lock time reached", absolute, spending(100, 0), true},
+		{"lock time not reached", absolute, spending(99, 0), false},
+		{"lock time is a timestamp", absolute, spending(LockTimeThreshold+100, 0), false},
+		{"final sequence", absolute, spending(100, SequenceFinal), false},
+		{"no transaction", absolute, nil, false},
+		{"relative lock reached", relative, spending(0, 10), true},
+		{"relative lock not reached", relative, spending(0, 9), false},
+		{"relative lock disabled in the input", relative, spending(0, SequenceLockTimeDisabled|10), false},
+		{"relative lock in seconds", relativeTime, spending(0, SequenceLockTimeIsTime|2), true},
+		{"relative lock of another type", relativeTime, spending(0, 2), false},
+		{"relative lock disabled in the script", disabled, spending(0, 0), true},
+		{"negative lock", script(t, NewScriptBuilder().AddInt(-1).AddOp(OpCheckLockTimeVerify)), spending(100, 0), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyScript(nil, test.scriptPubKey, test.tx, 0)
+			if test.ok != (err == nil) {
+				t.Errorf("got error %v, want success %t", err, test.ok)
+			}
+		})
+	}
+}
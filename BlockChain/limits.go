@@ -0,0 +1,99 @@
+package BlockChain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/koushamad/blockchain/Wallet"
+	"math"
+)
+
+const BlockTemplateReserve = 1000
+
+func (b *Block) Size() int {
+	return len(b.Serialize())
+}
+
+func CountSigOps(script []byte) int {
+	ops, err := ParseScript(script)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for i, op := range ops {
+		switch op.Opcode {
+		case OpCheckSig, OpCheckSigVerify:
+			count++
+		case OpCheckMultiSig, OpCheckMultiSigVerify:
+			keys := 0
+			if i > 0 {
+				keys, _ = smallInt(ops[i-1].Opcode)
+			}
+			if keys == 0 {
+				keys = MaxMultiSigKeys
+			}
+			count += keys
+		}
+	}
+
+	return count
+}
+
+func (tx Transaction) SigOpCount(preTXs map[string]Transaction) int {
+	count := 0
+
+	for _, out := range tx.Outputs {
+		count += CountSigOps(out.ScriptPubKey)
+	}
+
+	if tx.IsCoinbase() {
+		return count
+	}
+
+	for _, in := range tx.Inputs {
+		count += CountSigOps(in.ScriptSig)
+
+		preTX, ok := preTXs[hex.EncodeToString(in.ID)]
+		if !ok || in.Out < 0 || in.Out >= len(preTX.Outputs) {
+			continue
+		}
+
+		if ClassifyScript(preTX.Outputs[in.Out].ScriptPubKey) != ScriptHashScript {
+			continue
+		}
+
+		ops, err := ParseScript(in.ScriptSig)
+		if err == nil && len(ops) > 0 {
+			count += CountSigOps(ops[len(ops)-1].Data)
+		}
+	}
+
+	return count
+}
+
+func (chain *Chain) CheckBlockLimits(block *Block) error {
+	if count := len(block.Transactions); count > chain.Params.MaxBlockTransactions {
+		return fmt.Errorf("block has %d transactions, the limit is %d", count, chain.Params.MaxBlockTransactions)
+	}
+
+	if size := block.Size(); size > chain.Params.MaxBlockSize {
+		return fmt.Errorf("block is %d bytes, the limit is %d", size, chain.Params.MaxBlockSize)
+	}
+
+	return nil
+}
+
+func (chain *Chain) checkDraftBlock(transactions []*Transaction, prevHash []byte, height int, blockTime int64) error {
+	draft := &Block{
+		Hash:         make([]byte, 32),
+		Transactions: transactions,
+		PrevHash:     prevHash,
+		Nonce:        math.MaxInt64,
+		Height:       height,
+		Timestamp:    blockTime,
+		Signer:       make([]byte, 2*Wallet.KeyLength),
+		Signature:    make([]byte, SignatureSize),
+	}
+
+	return chain.CheckBlockLimits(draft)
+}
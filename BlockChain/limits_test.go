@@ -0,0 +1,119 @@
+package BlockChain
+
+import (
+	"testing"
+)
+
+func TestCountSigOps(t *testing.T) {
+	var keys [][]byte
+	for i := 0; i < 3; i++ {
+		w, _ := newTestWallet()
+		keys = append(keys, w.PublicKey)
+	}
+	multiSig, err := NewMultiSigScript(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		script []byte
+		want   int
+	}{
+		{"pay to public key hash", NewPayToPubKeyHashScript(make([]byte, 20)), 1},
+		{"multisig counts its keys", multiSig, 3},
+		{"multisig without a key count", []byte{OpCheckMultiSig}, MaxMultiSigKeys},
+		{"unparsable script", []byte{0x4c}, 0},
+	}
+
+	for _, test := range tests {
+		if got := CountSigOps(test.script); got != test.want {
+			t.Errorf("%s: counted %d signature operations, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBlockLimits(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	mempool := Mempool{Chain: chain}
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	tx := spend(chain, alice, bobAddress, 5, TxOptions{Coins: []OutPoint{{genesis.ID, 0}}, Fee: 1})
+	coinbase := NewCoinbaseTX(aliceAddress, "", BlockSubsidy+1)
+
+	limit := func(t *testing.T, change func(params *Params)) {
+		original := chain.Params
+		params := *original
+		change(&params)
+		chain.Params = &params
+		t.Cleanup(func() { chain.Params = original })
+	}
+
+	limits := []struct {
+		name  string
+		limit func(params *Params)
+	}{
+		{"transaction size", func(params *Params) { params.MaxTxSize = tx.Size() - 1 }},
+		{"signature operations", func(params *Params) { params.MaxBlockSigOps = tx.SigOpCount(nil) - 1 }},
+	}
+
+	for _, test := range limits {
+		t.Run("mempool "+test.name, func(t *testing.T) {
+			limit(t, test.limit)
+
+			if err := mempool.Add(tx); err == nil {
+				mempool.Clear()
+				t.Error("mempool accepted a transaction over the limit")
+			}
+		})
+	}
+
+	if err := mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	templates := []struct {
+		name  string
+		limit func(params *Params)
+		want  int
+	}{
+		{"within the limits", func(params *Params) {}, 1},
+		{"block size", func(params *Params) { params.MaxBlockSize = BlockTemplateReserve + tx.Size() - 1 }, 0},
+		{"transaction count", func(params *Params) { params.MaxBlockTransactions = 1 }, 0},
+		{"signature operations", func(params *Params) { params.MaxBlockSigOps = tx.SigOpCount(nil) - 1 }, 0},
+	}
+
+	for _, test := range templates {
+		t.Run("template "+test.name, func(t *testing.T) {
+			limit(t, test.limit)
+
+			if got := len(mempool.BlockTemplate()); got != test.want {
+				t.Errorf("template has %d transactions, want %d", got, test.want)
+			}
+		})
+	}
+
+	blocks := []struct {
+		name  string
+		limit func(params *Params)
+	}{
+		{"block size", func(params *Params) { params.MaxBlockSize = tx.Size() }},
+		{"transaction count", func(params *Params) { params.MaxBlockTransactions = 1 }},
+	}
+
+	for _, test := range blocks {
+		t.Run("mined "+test.name, func(t *testing.T) {
+			limit(t, test.limit)
+
+			if _, err := chain.MineBlock([]*Transaction{coinbase, tx}, nil); err == nil {
+				t.Error("mined a block over the limit")
+			}
+		})
+	}
+
+	if err := chain.CheckBlockLimits(&Block{Transactions: []*Transaction{coinbase, tx}}); err != nil {
+		t.Errorf("block within the limits: %s", err)
+	}
+}
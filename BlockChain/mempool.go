@@ -0,0 +1,654 @@
+package BlockChain
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger"
+	"github.com/koushamad/blockchain/Handler"
+	"sort"
+	"time"
+)
+
+var (
+	MempoolPrefix      = []byte("mempool-")
+	MempoolSpendPrefix = []byte("mempoolspend-")
+)
+
+// ErrMissingInputs means an input refers to a transaction that is neither in
+// the mempool nor has unspent outputs, usually a parent that is not known yet.
+var ErrMissingInputs = errors.New("transaction spends outputs of unknown transactions")
+
+// InvalidTxError rejects a transaction that breaks the consensus rules and
+// can never be mined, as opposed to one the mempool turns down by policy or
+// because it does not fit the current chain yet.
+type InvalidTxError struct {
+	Reason string
+}
+
+func (e InvalidTxError) Error() string {
+	return e.Reason
+}
+
+func invalidTx(format string, args ...interface{}) error {
+	return InvalidTxError{fmt.Sprintf(format, args...)}
+}
+
+type Mempool struct {
+	Chain *Chain
+}
+
+type MempoolEntry struct {
+	Tx     Transaction
+	Fee    int
+	Size   int
+	SigOps int
+	Height int
+	Time   int64
+}
+
+func mempoolKey(txID []byte) []byte {
+	key := make([]byte, 0, len(MempoolPrefix)+len(txID))
+	key = append(key, MempoolPrefix...)
+
+	return append(key, txID...)
+}
+
+// spendKey indexes the mempool transaction that spends an output, the mempool
+// holds no double spends so every output has at most one.
+func spendKey(outPoint OutPoint) []byte {
+	key := append([]byte{}, MempoolSpendPrefix...)
+
+	return append(key, outPoint.String()...)
+}
+
+func (e MempoolEntry) FeeRate() float64 {
+	return float64(e.Fee) / float64(e.Size)
+}
+
+func (e MempoolEntry) Serialize() []byte {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(e)
+	Handler.Handle(err)
+
+	return buffer.Bytes()
+}
+
+func DeserializeMempoolEntry(data []byte) MempoolEntry {
+	var entry MempoolEntry
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry)
+	Handler.Handle(err)
+
+	return entry
+}
+
+func (m Mempool) Entries() map[string]MempoolEntry {
+	entries := make(map[string]MempoolEntry)
+
+	err := m.Chain.Database.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(MempoolPrefix); it.ValidForPrefix(MempoolPrefix); it.Next() {
+			if err := it.Item().Value(func(val []byte) error {
+				entry := DeserializeMempoolEntry(val)
+				entries[hex.EncodeToString(entry.Tx.ID)] = entry
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	Handler.Handle(err)
+
+	return entries
+}
+
+func (m Mempool) Get(txID []byte) (MempoolEntry, bool) {
+	var entry MempoolEntry
+	var found bool
+
+	err := m.Chain.Database.View(func(txn *badger.Txn) error {
+		var err error
+		entry, found, err = entryIn(txn, txID)
+		return err
+	})
+	Handler.Handle(err)
+
+	return entry, found
+}
+
+func entryIn(txn *badger.Txn, txID []byte) (MempoolEntry, bool, error) {
+	var entry MempoolEntry
+
+	item, err := txn.Get(mempoolKey(txID))
+	if err == badger.ErrKeyNotFound {
+		return entry, false, nil
+	}
+	if err != nil {
+		return entry, false, err
+	}
+
+	err = item.Value(func(val []byte) error {
+		entry = DeserializeMempoolEntry(val)
+		return nil
+	})
+
+	return entry, err == nil, err
+}
+
+// Spender returns the ID of the mempool transaction spending an output.
+func (m Mempool) Spender(outPoint OutPoint) (string, bool) {
+	var spender string
+	var found bool
+
+	err := m.Chain.Database.View(func(txn *badger.Txn) error {
+		var err error
+		spender, found, err = spenderIn(txn, outPoint)
+		return err
+	})
+	Handler.Handle(err)
+
+	return spender, found
+}
+
+func spenderIn(txn *badger.Txn, outPoint OutPoint) (string, bool, error) {
+	item, err := txn.Get(spendKey(outPoint))
+	if err == badger.ErrKeyNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	value, err := item.ValueCopy(nil)
+
+	return string(value), err == nil, err
+}
+
+// Add checks the transaction against the pool and stores it in the same
+// database transaction, so of two conflicting transactions added at the same
+// time one fails to commit and is checked again against the other.
+func (m Mempool) Add(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return invalidTx("coinbase transactions cannot enter the mempool")
+	}
+
+	if size := tx.Size(); size > m.Chain.Params.MaxTxSize {
+		return fmt.Errorf("transaction is %d bytes, the limit is %d", size, m.Chain.Params.MaxTxSize)
+	}
+
+	if err := tx.CheckSanity(); err != nil {
+		return invalidTx("%s", err)
+	}
+
+	for {
+		err := m.Chain.Database.Update(func(txn *badger.Txn) error {
+			return m.add(txn, tx)
+		})
+		if err != badger.ErrConflict {
+			return err
+		}
+	}
+}
+
+func (m Mempool) add(txn *badger.Txn, tx *Transaction) error {
+	_, exists, err := entryIn(txn, tx.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("transaction is already in the mempool")
+	}
+
+	height := m.Chain.GetBestHeight()
+	parents := make(map[string]*Transaction)
+	conflicts := make(map[string]bool)
+	preTXs := make(map[string]Transaction)
+	inputValue := 0
+
+	for _, in := range tx.Inputs {
+		outPoint := OutPoint{in.ID, in.Out}.String()
+		spender, spent, err := spenderIn(txn, OutPoint{in.ID, in.Out})
+		if err != nil {
+			return err
+		}
+		if spent {
+			conflicts[spender] = true
+		}
+
+		inID := hex.EncodeToString(in.ID)
+		parent, inPool, err := entryIn(txn, in.ID)
+		if err != nil {
+			return err
+		}
+		if inPool {
+			if in.Out < 0 || in.Out >= len(parent.Tx.Outputs) {
+				return invalidTx("input spends missing output %s", outPoint)
+			}
+			parentTx := parent.Tx
+			parents[inID] = &parentTx
+			preTXs[inID] = parentTx
+			inputValue += parentTx.Outputs[in.Out].Value
+			continue
+		}
+
+		outs, ok, err := outputsIn(txn, in.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrMissingInputs
+		}
+		out, unspent := outs.Outputs[in.Out]
+		if !unspent {
+			return fmt.Errorf("input spends missing or spent output %s", outPoint)
+		}
+		if !outs.IsMature(height+1, m.Chain.Params.CoinbaseMaturity) {
+			return fmt.Errorf("input spends immature coinbase output %s", outPoint)
+		}
+		inputValue += out.Value
+
+		preTx, err := m.Chain.FindTransaction(in.ID)
+		if err != nil {
+			return err
+		}
+		preTXs[inID] = preTx
+	}
+
+	if !tx.Verify(preTXs) {
+		return invalidTx("transaction signatures do not verify")
+	}
+
+	sigOps := tx.SigOpCount(preTXs)
+	if sigOps > m.Chain.Params.MaxBlockSigOps {
+		return invalidTx("transaction has %d signature operations, the block limit is %d", sigOps, m.Chain.Params.MaxBlockSigOps)
+	}
+
+	fee := inputValue - tx.OutputValue()
+	if fee < 0 {
+		return invalidTx("transaction spends more than its inputs")
+	}
+
+	median, err := m.Chain.MedianTimePast(m.Chain.LastHash)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Chain.checkLocks(tx, height+1, time.Now().Unix(), median, parents); err != nil {
+		return err
+	}
+
+	replaced, err := checkReplacement(txn, fee, conflicts, parents)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range replaced {
+		if err := deleteEntry(txn, old); err != nil {
+			return err
+		}
+	}
+
+	entry := MempoolEntry{Tx: *tx, Fee: fee, Size: tx.Size(), SigOps: sigOps, Height: height, Time: time.Now().Unix()}
+
+	return setEntry(txn, entry)
+}
+
+func setEntry(txn *badger.Txn, entry MempoolEntry) error {
+	for _, in := range entry.Tx.Inputs {
+		if err := txn.Set(spendKey(OutPoint{in.ID, in.Out}), []byte(hex.EncodeToString(entry.Tx.ID))); err != nil {
+			return err
+		}
+	}
+
+	return txn.Set(mempoolKey(entry.Tx.ID), entry.Serialize())
+}
+
+func deleteEntry(txn *badger.Txn, entry MempoolEntry) error {
+	for _, in := range entry.Tx.Inputs {
+		if err := txn.Delete(spendKey(OutPoint{in.ID, in.Out})); err != nil {
+			return err
+		}
+	}
+
+	return txn.Delete(mempoolKey(entry.Tx.ID))
+}
+
+func checkReplacement(txn *badger.Txn, fee int, conflicts map[string]bool, parents map[string]*Transaction) ([]MempoolEntry, error) {
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+
+	for txID := range conflicts {
+		id, _ := hex.DecodeString(txID)
+		entry, _, err := entryIn(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		if !entry.Tx.SignalsReplacement() {
+			return nil, fmt.Errorf("transaction conflicts with %s which does not signal replacement", txID)
+		}
+	}
+
+	replaced, err := descendantsIn(txn, conflicts)
+	if err != nil {
+		return nil, err
+	}
+	replacedFee := 0
+	for _, entry := range replaced {
+		txID := hex.EncodeToString(entry.Tx.ID)
+		if _, ok := parents[txID]; ok {
+			return nil, fmt.Errorf("transaction spends %s which it replaces", txID)
+		}
+		replacedFee += entry.Fee
+	}
+
+	if fee <= replacedFee {
+		return nil, fmt.Errorf("replacement fee %d must be higher than the %d it replaces", fee, replacedFee)
+	}
+
+	return replaced, nil
+}
+
+func (m Mempool) RemoveBlock(block *Block) {
+	confirmed := make(map[string]MempoolEntry)
+	removed := make(map[string]MempoolEntry)
+
+	for _, tx := range block.Transactions {
+		txID := hex.EncodeToString(tx.ID)
+		if entry, ok := m.Get(tx.ID); ok {
+			confirmed[txID] = entry
+			removed[txID] = entry
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		for _, in := range tx.Inputs {
+			spender, ok := m.Spender(OutPoint{in.ID, in.Out})
+			if ok && spender != txID {
+				for _, conflict := range m.descendants(map[string]bool{spender: true}) {
+					removed[hex.EncodeToString(conflict.Tx.ID)] = conflict
+				}
+			}
+		}
+	}
+
+	err := m.Chain.Database.Update(func(txn *badger.Txn) error {
+		for _, entry := range removed {
+			if err := deleteEntry(txn, entry); err != nil {
+				return err
+			}
+		}
+
+		return m.recordConfirmations(txn, block, confirmed)
+	})
+	Handler.Handle(err)
+}
+
+// Reorganize runs after blocks were disconnected, their transactions go back
+// into the mempool and entries that no longer fit on the chain are dropped.
+func (m Mempool) Reorganize(disconnected []*Block) {
+	var pending []*Transaction
+
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		for _, tx := range disconnected[i].Transactions {
+			if !tx.IsCoinbase() {
+				pending = append(pending, tx)
+			}
+		}
+	}
+
+	entries := m.Entries()
+	var ids []string
+	for txID := range entries {
+		ids = append(ids, txID)
+	}
+	sort.Strings(ids)
+
+	included := make(map[string]bool)
+	for _, txID := range ids {
+		for _, member := range ancestors(entries, txID, included) {
+			tx := entries[member].Tx
+			pending = append(pending, &tx)
+			included[member] = true
+		}
+	}
+
+	m.Clear()
+
+	for len(pending) > 0 {
+		var missing []*Transaction
+		for _, tx := range pending {
+			if err := m.Add(tx); err == ErrMissingInputs {
+				missing = append(missing, tx)
+			}
+		}
+
+		if len(missing) == len(pending) {
+			return
+		}
+		pending = missing
+	}
+}
+
+// templatePackage is an entry with its ancestors that are not in the template
+// yet, the totals shrink as those ancestors get included.
+type templatePackage struct {
+	ancestors map[string]bool
+	fee       int
+	size      int
+	sigOps    int
+	version   int
+}
+
+func (p *templatePackage) remove(entry MempoolEntry) {
+	delete(p.ancestors, hex.EncodeToString(entry.Tx.ID))
+	p.fee -= entry.Fee
+	p.size -= entry.Size
+	p.sigOps -= entry.SigOps
+	p.version++
+}
+
+// packageQueue orders packages by fee rate, an update pushes the package again
+// with a new version and the outdated item is dropped when it comes up.
+type packageQueue []packageItem
+
+type packageItem struct {
+	txID    string
+	rate    float64
+	version int
+}
+
+func (q packageQueue) Len() int {
+	return len(q)
+}
+
+func (q packageQueue) Less(i, j int) bool {
+	if q[i].rate != q[j].rate {
+		return q[i].rate > q[j].rate
+	}
+
+	return q[i].txID < q[j].txID
+}
+
+func (q packageQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *packageQueue) Push(item interface{}) {
+	*q = append(*q, item.(packageItem))
+}
+
+func (q *packageQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return item
+}
+
+// BlockTemplate picks the package with the best fee rate until the block is
+// full. The ancestors of every entry are collected once, including a package
+// only updates the packages of its descendants.
+func (m Mempool) BlockTemplate() []*Transaction {
+	var template []*Transaction
+
+	params := m.Chain.Params
+	maxSize := params.MaxBlockSize - BlockTemplateReserve
+	maxCount := params.MaxBlockTransactions - 1
+
+	entries := m.Entries()
+	packages := make(map[string]*templatePackage)
+	dependents := make(map[string][]string)
+	queue := &packageQueue{}
+
+	for txID := range entries {
+		pkg := &templatePackage{ancestors: make(map[string]bool)}
+		for _, member := range ancestors(entries, txID, nil) {
+			pkg.ancestors[member] = true
+			pkg.fee += entries[member].Fee
+			pkg.size += entries[member].Size
+			pkg.sigOps += entries[member].SigOps
+			if member != txID {
+				dependents[member] = append(dependents[member], txID)
+			}
+		}
+		packages[txID] = pkg
+		heap.Push(queue, packageItem{txID, float64(pkg.fee) / float64(pkg.size), 0})
+	}
+
+	included := make(map[string]bool)
+	skipped := make(map[string]bool)
+	size, sigOps := 0, 0
+
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(packageItem)
+		pkg := packages[item.txID]
+		if included[item.txID] || skipped[item.txID] || item.version != pkg.version {
+			continue
+		}
+
+		if size+pkg.size > maxSize || len(template)+len(pkg.ancestors) > maxCount || sigOps+pkg.sigOps > params.MaxBlockSigOps {
+			skipped[item.txID] = true
+			for _, dependent := range dependents[item.txID] {
+				skipped[dependent] = true
+			}
+			continue
+		}
+
+		size += pkg.size
+		sigOps += pkg.sigOps
+
+		for _, member := range ancestors(entries, item.txID, included) {
+			entry := entries[member]
+			tx := entry.Tx
+			template = append(template, &tx)
+			included[member] = true
+
+			for _, dependent := range dependents[member] {
+				if included[dependent] || skipped[dependent] {
+					continue
+				}
+				other := packages[dependent]
+				other.remove(entry)
+				if len(other.ancestors) > 0 {
+					heap.Push(queue, packageItem{dependent, float64(other.fee) / float64(other.size), other.version})
+				}
+			}
+		}
+	}
+
+	return template
+}
+
+func (m Mempool) Clear() {
+	UTXO := UTXOSet{Chain: m.Chain}
+	UTXO.DeleteByPrefix(MempoolPrefix)
+	UTXO.DeleteByPrefix(MempoolSpendPrefix)
+}
+
+func ancestors(entries map[string]MempoolEntry, txID string, included map[string]bool) []string {
+	var ordered []string
+	visited := make(map[string]bool)
+
+	var visit func(id string)
+	visit = func(id string) {
+		if visited[id] || included[id] {
+			return
+		}
+		visited[id] = true
+
+		for _, in := range entries[id].Tx.Inputs {
+			parentID := hex.EncodeToString(in.ID)
+			if _, ok := entries[parentID]; ok {
+				visit(parentID)
+			}
+		}
+
+		ordered = append(ordered, id)
+	}
+	visit(txID)
+
+	return ordered
+}
+
+// descendants returns the entries of the roots and of every transaction that
+// spends their outputs, following the spender index.
+func (m Mempool) descendants(roots map[string]bool) []MempoolEntry {
+	var result []MempoolEntry
+
+	err := m.Chain.Database.View(func(txn *badger.Txn) error {
+		var err error
+		result, err = descendantsIn(txn, roots)
+		return err
+	})
+	Handler.Handle(err)
+
+	return result
+}
+
+func descendantsIn(txn *badger.Txn, roots map[string]bool) ([]MempoolEntry, error) {
+	var result []MempoolEntry
+	found := make(map[string]bool)
+
+	queue := make([]string, 0, len(roots))
+	for txID := range roots {
+		queue = append(queue, txID)
+		found[txID] = true
+	}
+
+	for len(queue) > 0 {
+		id, _ := hex.DecodeString(queue[0])
+		queue = queue[1:]
+
+		entry, ok, err := entryIn(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		result = append(result, entry)
+
+		for outIdx := range entry.Tx.Outputs {
+			childID, ok, err := spenderIn(txn, OutPoint{id, outIdx})
+			if err != nil {
+				return nil, err
+			}
+			if ok && !found[childID] {
+				found[childID] = true
+				queue = append(queue, childID)
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,417 @@
+package BlockChain
+
+import (
+	"encoding/hex"
+	"github.com/koushamad/blockchain/Wallet"
+	"sync"
+	"testing"
+	"time"
+)
+
+// spend builds and signs a transaction paying amount to to from the coins of
+// from, options picks the coins and the fee.
+func spend(chain *Chain, from *Wallet.Wallet, to string, amount int, options TxOptions) *Transaction {
+	UTXO := UTXOSet{Chain: chain}
+	output := NewTXOutput(amount, to)
+	tx := FundTransaction(string(from.Address()), []TXOutput{*output}, &UTXO, options)
+	chain.SignTransaction(tx, from.PrivateKey)
+
+	return tx
+}
+
+// respend spends a coin the mempool already spends, coin selection would skip
+// it so the transaction is built by hand.
+func respend(chain *Chain, from *Wallet.Wallet, coin OutPoint, value, fee int) *Transaction {
+	tx := &Transaction{
+		Inputs:  []TxInput{{ID: coin.TxID, Out: coin.Index, Sequence: SequenceFinal}},
+		Outputs: []TXOutput{*NewTXOutput(value-fee, string(from.Address()))},
+	}
+	tx.ID = tx.Hash()
+	chain.SignTransaction(tx, from.PrivateKey)
+
+	return tx
+}
+
+func spenderOf(m Mempool, tx *Transaction, outIdx int) string {
+	spender, _ := m.Spender(OutPoint{tx.ID, outIdx})
+
+	return spender
+}
+
+func TestMempoolSpenderIndex(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	mempool := Mempool{Chain: chain}
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	coin := OutPoint{genesis.ID, 0}
+
+	parent := spend(chain, alice, bobAddress, 5, TxOptions{Coins: []OutPoint{coin}, Fee: 1, Replaceable: true})
+	if err := mempool.Add(parent); err != nil {
+		t.Fatal(err)
+	}
+	child := spend(chain, alice, bobAddress, 3, TxOptions{Coins: []OutPoint{{parent.ID, 1}}, Fee: 4})
+	if err := mempool.Add(child); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := spenderOf(mempool, genesis, 0); got != hex.EncodeToString(parent.ID) {
+		t.Errorf("genesis coin spent by %s, want the parent", got)
+	}
+	if got := spenderOf(mempool, parent, 1); got != hex.EncodeToString(child.ID) {
+		t.Errorf("parent change spent by %s, want the child", got)
+	}
+
+	tests := []struct {
+		name string
+		fee  int
+		ok   bool
+	}{
+		{"same fee", 1, false},
+		{"fee of the package", 5, false},
+		{"above the fee of the package", 8, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replacement := respend(chain, alice, coin, BlockSubsidy, test.fee)
+			err := mempool.Add(replacement)
+			if test.ok != (err == nil) {
+				t.Fatalf("got error %v, want success %t", err, test.ok)
+			}
+			if !test.ok {
+				return
+			}
+
+			if _, ok := mempool.Get(parent.ID); ok {
+				t.Error("replaced parent is still in the mempool")
+			}
+			if _, ok := mempool.Get(child.ID); ok {
+				t.Error("child of the replaced parent is still in the mempool")
+			}
+			if _, spent := mempool.Spender(OutPoint{parent.ID, 1}); spent {
+				t.Error("spend of the removed child is still indexed")
+			}
+			if got := spenderOf(mempool, genesis, 0); got != hex.EncodeToString(replacement.ID) {
+				t.Errorf("genesis coin spent by %s, want the replacement", got)
+			}
+
+			mempool.Reorganize(nil)
+			if got := spenderOf(mempool, genesis, 0); got != hex.EncodeToString(replacement.ID) {
+				t.Errorf("after a reorganization the genesis coin is spent by %s", got)
+			}
+
+			mineTransactions(t, chain, aliceAddress)
+			if _, spent := mempool.Spender(coin); spent || len(mempool.Entries()) != 0 {
+				t.Error("mined transaction is still in the mempool")
+			}
+		})
+	}
+}
+
+func TestMempoolRejectsInvalidTransactions(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	mempool := Mempool{Chain: chain}
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	coin := TxInput{ID: genesis.ID, Out: 0, Sequence: SequenceFinal}
+	pay := func(value int) TXOutput {
+		return *NewTXOutput(value, aliceAddress)
+	}
+
+	tests := []struct {
+		name      string
+		inputs    []TxInput
+		outputs   []TXOutput
+		signed    bool
+		consensus bool
+	}{
+		{"duplicate inputs", []TxInput{coin, coin}, []TXOutput{pay(2 * BlockSubsidy)}, true, true},
+		{"negative output", []TxInput{coin}, []TXOutput{pay(BlockSubsidy + 5), pay(-5)}, true, true},
+		{"zero output", []TxInput{coin}, []TXOutput{pay(BlockSubsidy), pay(0)}, true, true},
+		{"no outputs", []TxInput{coin}, nil, true, true},
+		{"spends more than its inputs", []TxInput{coin}, []TXOutput{pay(BlockSubsidy + 1)}, true, true},
+		{"unsigned", []TxInput{coin}, []TXOutput{pay(BlockSubsidy - 1)}, false, true},
+		{"missing output", []TxInput{{ID: genesis.ID, Out: 5, Sequence: SequenceFinal}}, []TXOutput{pay(1)}, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := &Transaction{Inputs: test.inputs, Outputs: test.outputs}
+			tx.ID = tx.Hash()
+			if test.signed {
+				chain.SignTransaction(tx, alice.PrivateKey)
+			}
+
+			err := mempool.Add(tx)
+			if err == nil {
+				t.Fatal("transaction entered the mempool")
+			}
+			if _, invalid := err.(InvalidTxError); invalid != test.consensus {
+				t.Errorf("error %q is a consensus failure %t, want %t", err, invalid, test.consensus)
+			}
+			if _, spent := mempool.Spender(OutPoint{genesis.ID, 0}); spent {
+				t.Error("rejected transaction is indexed as a spender")
+			}
+		})
+	}
+}
+
+func TestMempoolRejectsLockedTransactions(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	mempool := Mempool{Chain: chain}
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	locked := func(lockTime int64, sequence uint32) *Transaction {
+		tx := &Transaction{
+			Inputs:   []TxInput{{ID: genesis.ID, Out: 0, Sequence: sequence}},
+			Outputs:  []TXOutput{*NewTXOutput(BlockSubsidy-1, aliceAddress)},
+			LockTime: lockTime,
+		}
+		tx.ID = tx.Hash()
+		chain.SignTransaction(tx, alice.PrivateKey)
+		return tx
+	}
+
+	tests := []struct {
+		name string
+		tx   *Transaction
+	}{
+		{"locked until a later height", locked(5, 0)},
+		{"locked until a later time", locked(time.Now().Unix()+3600, 0)},
+		{"relatively locked for blocks", locked(0, 3)},
+		{"relatively locked for seconds", locked(0, SequenceLockTimeIsTime|1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := mempool.Add(test.tx); err == nil {
+				t.Error("locked transaction entered the mempool")
+			}
+		})
+	}
+
+	if err := mempool.Add(locked(5, SequenceFinal)); err != nil {
+		t.Errorf("lock time of a transaction with final inputs was enforced: %s", err)
+	}
+	mempool.Clear()
+
+	for i := 0; i < 2; i++ {
+		mineTransactions(t, chain, aliceAddress)
+	}
+	if err := mempool.Add(locked(0, 3)); err != nil {
+		t.Errorf("relative lock did not expire after 3 blocks: %s", err)
+	}
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	coinbase := TxOutputs{Height: 5, Coinbase: true}
+
+	tests := []struct {
+		name   string
+		outs   TxOutputs
+		height int
+		ok     bool
+	}{
+		{"payment", TxOutputs{Height: 5}, 6, true},
+		{"immature coinbase", coinbase, 7, false},
+		{"coinbase at the limit", coinbase, 8, true},
+		{"genesis coinbase", TxOutputs{Height: 0, Coinbase: true}, 1, true},
+	}
+
+	for _, test := range tests {
+		if got := test.outs.IsMature(test.height, 3); got != test.ok {
+			t.Errorf("%s: mature %t, want %t", test.name, got, test.ok)
+		}
+	}
+
+	alice, aliceAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	chain.Params.CoinbaseMaturity = 3
+	mempool := Mempool{Chain: chain}
+	_, aliceHash, _ := Wallet.DecodeAddress(aliceAddress)
+
+	reward := mineTransactions(t, chain, aliceAddress).Transactions[0]
+	if spendable, immature := (UTXOSet{Chain: chain}).FindBalance(aliceHash); spendable != BlockSubsidy || immature != BlockSubsidy {
+		t.Errorf("balance is %d spendable and %d immature", spendable, immature)
+	}
+
+	if err := mempool.Add(respend(chain, alice, OutPoint{reward.ID, 0}, BlockSubsidy, 1)); err == nil {
+		t.Error("immature coinbase was spent")
+	}
+
+	for i := 0; i < 2; i++ {
+		mineTransactions(t, chain, aliceAddress)
+	}
+	if err := mempool.Add(respend(chain, alice, OutPoint{reward.ID, 0}, BlockSubsidy, 1)); err != nil {
+		t.Errorf("coinbase did not mature after %d blocks: %s", chain.Params.CoinbaseMaturity, err)
+	}
+}
+
+func TestMempoolReplacementNeedsSignal(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	mempool := Mempool{Chain: chain}
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	coin := OutPoint{genesis.ID, 0}
+
+	original := spend(chain, alice, bobAddress, 5, TxOptions{Coins: []OutPoint{coin}, Fee: 1})
+	if err := mempool.Add(original); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mempool.Add(respend(chain, alice, coin, BlockSubsidy, 10)); err == nil {
+		t.Error("replaced a transaction that does not signal replacement")
+	}
+	if got := spenderOf(mempool, genesis, 0); got != hex.EncodeToString(original.ID) {
+		t.Errorf("genesis coin spent by %s, want the original", got)
+	}
+}
+
+func TestMempoolChildPaysForParent(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	mempool := Mempool{Chain: chain}
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	second := mineTransactions(t, chain, aliceAddress).Transactions[0]
+
+	other := spend(chain, alice, bobAddress, 5, TxOptions{Coins: []OutPoint{{second.ID, 0}}, Fee: 3})
+	parent := spend(chain, alice, bobAddress, 5, TxOptions{Coins: []OutPoint{{genesis.ID, 0}}, Fee: 1})
+	for _, tx := range []*Transaction{other, parent} {
+		if err := mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	child := spend(chain, alice, bobAddress, 3, TxOptions{Coins: []OutPoint{{parent.ID, 1}}, Fee: 10})
+	if err := mempool.Add(child); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, tx := range mempool.BlockTemplate() {
+		order = append(order, hex.EncodeToString(tx.ID))
+	}
+	want := []string{hex.EncodeToString(parent.ID), hex.EncodeToString(child.ID), hex.EncodeToString(other.ID)}
+	if !equalStrings(order, want) {
+		t.Errorf("template is %v, want the parent and child before the other transaction %v", order, want)
+	}
+
+	mineTransactions(t, chain, aliceAddress)
+	if entries := mempool.Entries(); len(entries) != 0 {
+		t.Errorf("%d transactions left in the mempool after mining", len(entries))
+	}
+	if got := balance(chain, bobAddress); got != 13 {
+		t.Errorf("bob has %d, want 13", got)
+	}
+}
+
+func TestMempoolConcurrentConflicts(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	mempool := Mempool{Chain: chain}
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	coin := OutPoint{genesis.ID, 0}
+
+	var txs []*Transaction
+	for fee := 1; fee <= 8; fee++ {
+		txs = append(txs, respend(chain, alice, coin, BlockSubsidy, fee))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(txs))
+	for i, tx := range txs {
+		wg.Add(1)
+		go func(i int, tx *Transaction) {
+			defer wg.Done()
+			errs[i] = mempool.Add(tx)
+		}(i, tx)
+	}
+	wg.Wait()
+
+	added := 0
+	for _, err := range errs {
+		if err == nil {
+			added++
+		}
+	}
+	if entries := mempool.Entries(); added != 1 || len(entries) != 1 {
+		t.Fatalf("%d concurrent double spends were added, the mempool holds %d", added, len(entries))
+	}
+	for txID := range mempool.Entries() {
+		if spender, _ := mempool.Spender(coin); spender != txID {
+			t.Errorf("coin is indexed as spent by %s, the mempool holds %s", spender, txID)
+		}
+	}
+}
+
+func TestBlockTemplatePackages(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	mempool := Mempool{Chain: chain}
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	second := mineTransactions(t, chain, aliceAddress).Transactions[0]
+
+	parent := spend(chain, alice, bobAddress, 5, TxOptions{Coins: []OutPoint{{genesis.ID, 0}}, Fee: 1})
+	other := spend(chain, alice, bobAddress, 5, TxOptions{Coins: []OutPoint{{second.ID, 0}}, Fee: 3})
+	for _, tx := range []*Transaction{parent, other} {
+		if err := mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	child := spend(chain, alice, bobAddress, 3, TxOptions{Coins: []OutPoint{{parent.ID, 1}}, Fee: 10})
+	if err := mempool.Add(child); err != nil {
+		t.Fatal(err)
+	}
+
+	id := func(tx *Transaction) string {
+		return hex.EncodeToString(tx.ID)
+	}
+
+	tests := []struct {
+		name         string
+		transactions int
+		want         []string
+	}{
+		{"everything fits", 10, []string{id(parent), id(child), id(other)}},
+		{"room for the package only", 3, []string{id(parent), id(child)}},
+		{"package does not fit", 2, []string{id(other)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain.Params.MaxBlockTransactions = test.transactions
+
+			var order []string
+			for _, tx := range mempool.BlockTemplate() {
+				order = append(order, id(tx))
+			}
+			if !equalStrings(order, test.want) {
+				t.Errorf("template is %v, want %v", order, test.want)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
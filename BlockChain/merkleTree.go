@@ -1,6 +1,9 @@
 package BlockChain
 
-import "crypto/sha256"
+import (
+	"crypto/sha256"
+	"errors"
+)
 
 type MerkleTree struct {
 	RootNode *MerkleNode
@@ -30,11 +33,11 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	return &node
 }
 
-func NewMerkleTree(data [][]byte) *MerkleTree {
+func NewMerkleTree(data [][]byte) (*MerkleTree, error) {
 	var nodes []MerkleNode
 
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
+	if len(data) == 0 {
+		return nil, errors.New("a merkle tree needs at least one leaf")
 	}
 
 	for _, dat := range data {
@@ -42,9 +45,17 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 		nodes = append(nodes, *node)
 	}
 
-	for i := 0; i < len(data)/2; i++ {
+	if len(nodes) == 1 {
+		nodes = append(nodes, nodes[0])
+	}
+
+	for len(nodes) > 1 {
 		var level []MerkleNode
 
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+
 		for j := 0; j < len(nodes); j += 2 {
 			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
 			level = append(level, *node)
@@ -54,5 +65,63 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 	}
 	tree := MerkleTree{&nodes[0]}
 
-	return &tree
+	return &tree, nil
+}
+
+func MerkleBranch(data [][]byte, index int) [][]byte {
+	var branch [][]byte
+	var hashes [][]byte
+
+	for _, dat := range data {
+		hashes = append(hashes, NewMerkleNode(nil, nil, dat).Data)
+	}
+
+	if len(hashes) == 1 {
+		return [][]byte{nil}
+	}
+
+	for len(hashes) > 1 {
+		var level [][]byte
+
+		if index^1 < len(hashes) {
+			branch = append(branch, hashes[index^1])
+		} else {
+			branch = append(branch, nil)
+		}
+
+		if len(hashes)%2 != 0 {
+			hashes = append(hashes, hashes[len(hashes)-1])
+		}
+
+		for j := 0; j < len(hashes); j += 2 {
+			hash := sha256.Sum256(append(append([]byte{}, hashes[j]...), hashes[j+1]...))
+			level = append(level, hash[:])
+		}
+
+		hashes = level
+		index /= 2
+	}
+
+	return branch
+}
+
+func MerkleRootFromBranch(data []byte, index int, branch [][]byte) []byte {
+	root := NewMerkleNode(nil, nil, data).Data
+
+	for _, sibling := range branch {
+		var hash [32]byte
+		if len(sibling) == 0 {
+			sibling = root
+		}
+
+		if index%2 == 0 {
+			hash = sha256.Sum256(append(append([]byte{}, root...), sibling...))
+		} else {
+			hash = sha256.Sum256(append(append([]byte{}, sibling...), root...))
+		}
+		root = hash[:]
+		index /= 2
+	}
+
+	return root
 }
@@ -0,0 +1,71 @@
+package BlockChain
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/koushamad/blockchain/Wallet"
+)
+
+type Miner struct {
+	Chain         *Chain
+	RewardAddress string
+}
+
+func (m Miner) Template() ([]*Transaction, int) {
+	mempool := Mempool{Chain: m.Chain}
+
+	transactions := mempool.BlockTemplate()
+	entries := mempool.Entries()
+
+	fees := 0
+	for _, tx := range transactions {
+		fees += entries[hex.EncodeToString(tx.ID)].Fee
+	}
+
+	return transactions, fees
+}
+
+func (m Miner) Coinbase(fees int, data string) (*Transaction, error) {
+	if !Wallet.ValidateAddress(m.RewardAddress) {
+		return nil, errors.New("reward address is not valid")
+	}
+
+	return NewCoinbaseTX(m.RewardAddress, data, BlockSubsidy+fees), nil
+}
+
+// MineBlock needs a reward address, a block without a coinbase is invalid and
+// the fees of its transactions would be lost.
+func (m Miner) MineBlock(quit <-chan struct{}) (*Block, error) {
+	transactions, fees := m.Template()
+
+	coinbase, err := m.Coinbase(fees, "")
+	if err != nil {
+		return nil, err
+	}
+	transactions = append([]*Transaction{coinbase}, transactions...)
+
+	block, err := m.Chain.MineBlock(transactions, quit)
+	if err != nil {
+		return nil, err
+	}
+
+	m.connected(block)
+
+	return block, nil
+}
+
+func (m Miner) SubmitBlock(block *Block) error {
+	if err := m.Chain.ConnectBlock(block); err != nil {
+		return err
+	}
+
+	m.connected(block)
+
+	return nil
+}
+
+func (m Miner) connected(block *Block) {
+	UTXO := UTXOSet{Chain: m.Chain}
+	UTXO.Update(block)
+	Mempool{Chain: m.Chain}.RemoveBlock(block)
+}
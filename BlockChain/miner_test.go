@@ -0,0 +1,47 @@
+package BlockChain
+
+import (
+	"testing"
+)
+
+func TestMinerNeedsCoinbase(t *testing.T) {
+	_, address := newTestWallet()
+	chain := newTestChain(t, address)
+
+	tests := []struct {
+		name string
+		mine func() (*Block, error)
+	}{
+		{"miner without reward address", func() (*Block, error) {
+			return Miner{Chain: chain}.MineBlock(nil)
+		}},
+		{"miner with invalid reward address", func() (*Block, error) {
+			return Miner{Chain: chain, RewardAddress: "not an address"}.MineBlock(nil)
+		}},
+		{"chain without transactions", func() (*Block, error) {
+			return chain.MineBlock(nil, nil)
+		}},
+		{"chain without leading coinbase", func() (*Block, error) {
+			UTXO := UTXOSet{Chain: chain}
+			tx := FundTransaction(address, []TXOutput{*NewTXOutput(1, address)}, &UTXO, TxOptions{})
+			return chain.MineBlock([]*Transaction{tx, CoinbaseTX(address, "")}, nil)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if block, err := test.mine(); err == nil {
+				t.Errorf("mined block %x, want an error", block.Hash)
+			}
+		})
+	}
+
+	if height := chain.GetBestHeight(); height != 0 {
+		t.Errorf("chain grew to height %d", height)
+	}
+
+	block := mineTransactions(t, chain, address)
+	if len(block.Transactions) != 1 || !block.Transactions[0].IsCoinbase() {
+		t.Errorf("block with an empty mempool has %d transactions, want a lone coinbase", len(block.Transactions))
+	}
+}
@@ -0,0 +1,111 @@
+package BlockChain
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	NetworkEnv = "BLOCKCHAIN_NETWORK"
+	SeedsEnv   = "BLOCKCHAIN_SEEDS"
+)
+
+type Params struct {
+	Name                 string
+	DBPath               string
+	GenesisData          string
+	MaxBlockSize         int
+	MaxBlockTransactions int
+	MaxBlockSigOps       int
+	MaxTxSize            int
+	CoinbaseMaturity     int
+	PowAlgorithm         string
+	Checkpoints          []Checkpoint
+	AssumeValid          *Checkpoint
+	Seeds                []string
+}
+
+// No network hardcodes checkpoints, every chain mines its own genesis block
+// paying the address it was created with so there is no hash to pin. They are
+// configured through CheckpointsEnv and AssumeValidEnv instead.
+var MainNetParams = Params{
+	Name:                 "mainnet",
+	DBPath:               "./tmp/blocks",
+	GenesisData:          "First Transaction from Genesis",
+	MaxBlockSize:         1000000,
+	MaxBlockTransactions: 10000,
+	MaxBlockSigOps:       20000,
+	MaxTxSize:            100000,
+	CoinbaseMaturity:     100,
+	PowAlgorithm:         SHA256Algorithm,
+}
+
+var TestNetParams = Params{
+	Name:                 "testnet",
+	DBPath:               "./tmp/testnet/blocks",
+	GenesisData:          "First Transaction from Testnet Genesis",
+	MaxBlockSize:         1000000,
+	MaxBlockTransactions: 10000,
+	MaxBlockSigOps:       20000,
+	MaxTxSize:            100000,
+	CoinbaseMaturity:     10,
+	PowAlgorithm:         SHA256Algorithm,
+}
+
+var ScryptNetParams = Params{
+	Name:                 "scryptnet",
+	DBPath:               "./tmp/scryptnet/blocks",
+	GenesisData:          "First Transaction from Scryptnet Genesis",
+	MaxBlockSize:         1000000,
+	MaxBlockTransactions: 10000,
+	MaxBlockSigOps:       20000,
+	MaxTxSize:            100000,
+	CoinbaseMaturity:     10,
+	PowAlgorithm:         ScryptAlgorithm,
+}
+
+var Argon2NetParams = Params{
+	Name:                 "argon2net",
+	DBPath:               "./tmp/argon2net/blocks",
+	GenesisData:          "First Transaction from Argon2net Genesis",
+	MaxBlockSize:         1000000,
+	MaxBlockTransactions: 10000,
+	MaxBlockSigOps:       20000,
+	MaxTxSize:            100000,
+	CoinbaseMaturity:     10,
+	PowAlgorithm:         Argon2Algorithm,
+}
+
+var networks = map[string]*Params{
+	MainNetParams.Name:   &MainNetParams,
+	TestNetParams.Name:   &TestNetParams,
+	ScryptNetParams.Name: &ScryptNetParams,
+	Argon2NetParams.Name: &Argon2NetParams,
+}
+
+func ParamsByName(name string) (*Params, error) {
+	params, ok := networks[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown network %s", name)
+	}
+
+	return params, nil
+}
+
+func ActiveParams() (*Params, error) {
+	name := os.Getenv(NetworkEnv)
+	if name == "" {
+		name = MainNetParams.Name
+	}
+
+	params, err := ParamsByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := PowAlgorithmByName(params.PowAlgorithm); err != nil {
+		return nil, fmt.Errorf("network %s: %s", name, err)
+	}
+
+	return params.withConfig()
+}
@@ -0,0 +1,339 @@
+package BlockChain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"io/ioutil"
+	"strings"
+)
+
+type PartialInput struct {
+	PrevOutput   TXOutput
+	RedeemScript []byte
+	Signatures   map[string][]byte
+}
+
+type PartialTransaction struct {
+	Tx     Transaction
+	Inputs []PartialInput
+}
+
+func NewPartialTransaction(tx *Transaction, UTXO *UTXOSet, scripts map[string][]byte) *PartialTransaction {
+	ptx := PartialTransaction{Tx: *tx}
+
+	for _, in := range tx.Inputs {
+		outs, ok := UTXO.GetOutputs(in.ID)
+		prevOutput, unspent := outs.Outputs[in.Out]
+		if !ok || !unspent {
+			Handler.Handle(fmt.Errorf("output %x:%d is spent or does not exist", in.ID, in.Out))
+		}
+
+		partialIn := PartialInput{PrevOutput: prevOutput, Signatures: make(map[string][]byte)}
+
+		if ClassifyScript(prevOutput.ScriptPubKey) == ScriptHashScript {
+			redeemScript, ok := scripts[ScriptAddress(prevOutput.ScriptPubKey)]
+			if !ok {
+				Handler.Handle(fmt.Errorf("redeem script for %s is not in the wallet", ScriptAddress(prevOutput.ScriptPubKey)))
+			}
+			partialIn.RedeemScript = redeemScript
+		}
+
+		ptx.Inputs = append(ptx.Inputs, partialIn)
+	}
+
+	return &ptx
+}
+
+func (in PartialInput) signers() (int, [][]byte) {
+	switch ClassifyScript(in.PrevOutput.ScriptPubKey) {
+	case PubKeyHashScript, TimeLockScript:
+		return 1, nil
+	case ScriptHashScript:
+		required, pubKeys, err := ExtractMultiSigKeys(in.RedeemScript)
+		if err == nil {
+			return required, pubKeys
+		}
+	}
+
+	return 0, nil
+}
+
+func (in PartialInput) subScript() []byte {
+	if in.RedeemScript != nil {
+		return in.RedeemScript
+	}
+
+	return in.PrevOutput.ScriptPubKey
+}
+
+func (in PartialInput) canSign(pubKey []byte) bool {
+	required, pubKeys := in.signers()
+	if required == 0 {
+		return false
+	}
+
+	if pubKeys == nil {
+		_, hash := ExtractAddressHash(in.PrevOutput.ScriptPubKey)
+		return bytes.Equal(hash, Wallet.PublicKeyHash(pubKey))
+	}
+
+	for _, key := range pubKeys {
+		if bytes.Equal(key, pubKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ptx *PartialTransaction) Sign(w Wallet.Wallet) int {
+	signed := 0
+	pubKeyHex := hex.EncodeToString(w.PublicKey)
+
+	for inId, in := range ptx.Inputs {
+		if in.canSign(w.PublicKey) {
+			in.Signatures[pubKeyHex] = ptx.Tx.SignInput(inId, w.PrivateKey, in.subScript())
+			signed++
+		}
+	}
+
+	return signed
+}
+
+func (ptx *PartialTransaction) Combine(other *PartialTransaction) error {
+	if !bytes.Equal(ptx.Tx.Hash(), other.Tx.Hash()) || len(ptx.Inputs) != len(other.Inputs) {
+		return errors.New("partial transactions do not spend the same outputs")
+	}
+
+	for inId, in := range other.Inputs {
+		if !bytes.Equal(in.RedeemScript, ptx.Inputs[inId].RedeemScript) {
+			return fmt.Errorf("input %d has a different redeem script", inId)
+		}
+
+		for pubKey, signature := range in.Signatures {
+			ptx.Inputs[inId].Signatures[pubKey] = signature
+		}
+	}
+
+	return nil
+}
+
+func (ptx *PartialTransaction) Validate() error {
+	if !bytes.Equal(ptx.Tx.ID, ptx.Tx.Hash()) {
+		return errors.New("transaction does not match its ID")
+	}
+
+	if len(ptx.Inputs) != len(ptx.Tx.Inputs) {
+		return errors.New("partial inputs do not match the transaction inputs")
+	}
+
+	for inId, in := range ptx.Inputs {
+		if in.RedeemScript != nil && !bytes.Equal(ScriptHash(in.RedeemScript), prevScriptHash(in.PrevOutput)) {
+			return fmt.Errorf("input %d redeem script does not match the spent output", inId)
+		}
+
+		for pubKeyHex, signature := range in.Signatures {
+			pubKey, err := hex.DecodeString(pubKeyHex)
+			if err != nil || !in.canSign(pubKey) {
+				return fmt.Errorf("input %d has a signature from an unexpected key", inId)
+			}
+
+			engine := NewScriptEngine(&ptx.Tx, inId)
+			if !engine.checkSignature(signature, pubKey, in.subScript()) {
+				return fmt.Errorf("input %d has an invalid signature from %s", inId, pubKeyHex)
+			}
+		}
+	}
+
+	return nil
+}
+
+func prevScriptHash(out TXOutput) []byte {
+	version, hash := ExtractAddressHash(out.ScriptPubKey)
+	if version != Wallet.ScriptVersion {
+		return nil
+	}
+
+	return hash
+}
+
+func (ptx *PartialTransaction) Matches(original *PartialTransaction) error {
+	if !bytes.Equal(ptx.Tx.Hash(), original.Tx.Hash()) {
+		return errors.New("signed transaction differs from the created one")
+	}
+
+	for inId, in := range original.Inputs {
+		prev := ptx.Inputs[inId].PrevOutput
+		if prev.Value != in.PrevOutput.Value || !bytes.Equal(prev.ScriptPubKey, in.PrevOutput.ScriptPubKey) {
+			return fmt.Errorf("input %d spends a different output than the created one", inId)
+		}
+	}
+
+	return nil
+}
+
+func (ptx *PartialTransaction) CheckPrevOutputs(UTXO *UTXOSet) error {
+	for inId, in := range ptx.Tx.Inputs {
+		outs, ok := UTXO.GetOutputs(in.ID)
+		prevOutput, unspent := outs.Outputs[in.Out]
+		if !ok || !unspent {
+			return fmt.Errorf("input %d spends %x:%d which is spent or does not exist", inId, in.ID, in.Out)
+		}
+
+		expected := ptx.Inputs[inId].PrevOutput
+		if prevOutput.Value != expected.Value || !bytes.Equal(prevOutput.ScriptPubKey, expected.ScriptPubKey) {
+			return fmt.Errorf("input %d previous output does not match the chain", inId)
+		}
+	}
+
+	return nil
+}
+
+func (ptx *PartialTransaction) Fee() int {
+	fee := 0
+
+	for _, in := range ptx.Inputs {
+		fee += in.PrevOutput.Value
+	}
+
+	for _, out := range ptx.Tx.Outputs {
+		fee -= out.Value
+	}
+
+	return fee
+}
+
+func (ptx *PartialTransaction) IsComplete() bool {
+	for _, in := range ptx.Inputs {
+		required, _ := in.signers()
+		if required == 0 || len(in.Signatures) < required {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ptx *PartialTransaction) Finalize() (*Transaction, error) {
+	if err := ptx.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx := ptx.Tx
+
+	tx.Inputs = make([]TxInput, len(ptx.Tx.Inputs))
+	copy(tx.Inputs, ptx.Tx.Inputs)
+
+	for inId, in := range ptx.Inputs {
+		required, pubKeys := in.signers()
+		if required == 0 {
+			return nil, fmt.Errorf("input %d spends a %s output which cannot be signed", inId, ClassifyScript(in.PrevOutput.ScriptPubKey))
+		}
+
+		if len(in.Signatures) < required {
+			return nil, fmt.Errorf("input %d has %d of %d required signatures", inId, len(in.Signatures), required)
+		}
+
+		var builder *ScriptBuilder
+		if pubKeys == nil {
+			for pubKeyHex, signature := range in.Signatures {
+				pubKey, _ := hex.DecodeString(pubKeyHex)
+				builder = NewScriptBuilder().AddData(signature).AddData(pubKey)
+			}
+		} else {
+			builder = NewScriptBuilder().AddOp(Op0)
+			count := 0
+			for _, pubKey := range pubKeys {
+				signature, ok := in.Signatures[hex.EncodeToString(pubKey)]
+				if !ok || count == required {
+					continue
+				}
+
+				builder.AddData(signature)
+				count++
+			}
+			builder.AddData(in.RedeemScript)
+		}
+
+		scriptSig, err := builder.Script()
+		if err != nil {
+			return nil, err
+		}
+		tx.Inputs[inId].ScriptSig = scriptSig
+
+		if err := VerifyScript(scriptSig, in.PrevOutput.ScriptPubKey, &tx, inId); err != nil {
+			return nil, fmt.Errorf("input %d: %s", inId, err)
+		}
+	}
+
+	return &tx, nil
+}
+
+func (ptx PartialTransaction) String() string {
+	var lines []string
+
+	lines = append(lines, ptx.Tx.String())
+
+	for inId, in := range ptx.Inputs {
+		required, pubKeys := in.signers()
+		lines = append(lines, fmt.Sprintf("		Input %d spends:	%d from %s (%s)", inId, in.PrevOutput.Value, ScriptAddress(in.PrevOutput.ScriptPubKey), ClassifyScript(in.PrevOutput.ScriptPubKey)))
+
+		if pubKeys != nil {
+			lines = append(lines, fmt.Sprintf("		Signatures:	%d of %d (%d keys)", len(in.Signatures), required, len(pubKeys)))
+		} else {
+			lines = append(lines, fmt.Sprintf("		Signatures:	%d of %d", len(in.Signatures), required))
+		}
+
+		for pubKey := range in.Signatures {
+			lines = append(lines, fmt.Sprintf("		Signed by:	%s", pubKey))
+		}
+	}
+
+	lines = append(lines, fmt.Sprintf("		Fee:		%d", ptx.Fee()))
+	lines = append(lines, fmt.Sprintf("		Complete:	%t", ptx.IsComplete()))
+
+	return strings.Join(lines, "\n")
+}
+
+func (ptx PartialTransaction) Serialize() []byte {
+	var encoded bytes.Buffer
+
+	enc := gob.NewEncoder(&encoded)
+	err := enc.Encode(ptx)
+	Handler.Handle(err)
+
+	return encoded.Bytes()
+}
+
+func DeserializePartialTransaction(data []byte) *PartialTransaction {
+	var ptx PartialTransaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&ptx)
+	Handler.Handle(err)
+
+	for inId := range ptx.Inputs {
+		if ptx.Inputs[inId].Signatures == nil {
+			ptx.Inputs[inId].Signatures = make(map[string][]byte)
+		}
+	}
+
+	return &ptx
+}
+
+func (ptx PartialTransaction) SaveFile(path string) {
+	err := ioutil.WriteFile(path, ptx.Serialize(), 0644)
+	Handler.Handle(err)
+}
+
+func LoadPartialTransaction(path string) *PartialTransaction {
+	content, err := ioutil.ReadFile(path)
+	Handler.Handle(err)
+
+	return DeserializePartialTransaction(content)
+}
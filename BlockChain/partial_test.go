@@ -0,0 +1,138 @@
+package BlockChain
+
+import (
+	"encoding/hex"
+	"github.com/koushamad/blockchain/Wallet"
+	"testing"
+)
+
+// newPartialSpend locks amount in a 2 of 3 multisig output and returns the
+// signers with an unsigned partial transaction paying it on to to.
+func newPartialSpend(t *testing.T, chain *Chain, from *Wallet.Wallet, to string, amount, fee int) ([]*Wallet.Wallet, *PartialTransaction) {
+	t.Helper()
+
+	signers, redeemScript := newMultiSig(t, 2, 3)
+	address := ScriptAddress(NewPayToScriptHashScript(ScriptHash(redeemScript)))
+
+	lock := spend(chain, from, address, amount, TxOptions{Fee: 1})
+	mineTransactions(t, chain, string(from.Address()), lock)
+
+	tx := &Transaction{
+		Inputs:  []TxInput{{ID: lock.ID, Out: 0, Sequence: SequenceFinal}},
+		Outputs: []TXOutput{*NewTXOutput(amount-fee, to)},
+	}
+	tx.ID = tx.Hash()
+
+	UTXO := UTXOSet{Chain: chain}
+	return signers, NewPartialTransaction(tx, &UTXO, map[string][]byte{address: redeemScript})
+}
+
+// copyPartial passes a partial transaction through its file format the way
+// it travels between signers.
+func copyPartial(ptx *PartialTransaction) *PartialTransaction {
+	return DeserializePartialTransaction(ptx.Serialize())
+}
+
+func TestPartialTransactionSigning(t *testing.T) {
+	const amount, fee = 10, 2
+
+	alice, aliceAddress := newTestWallet()
+	_, bobAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+
+	signers, ptx := newPartialSpend(t, chain, alice, bobAddress, amount, fee)
+	if got := ptx.Fee(); got != fee {
+		t.Errorf("fee is %d, want %d", got, fee)
+	}
+	if signed := ptx.Sign(*alice); signed != 0 {
+		t.Errorf("a key outside the multisig signed %d inputs", signed)
+	}
+
+	first := copyPartial(ptx)
+	if signed := first.Sign(*signers[0]); signed != 1 {
+		t.Fatalf("first signer signed %d inputs", signed)
+	}
+	if first.IsComplete() {
+		t.Error("one of two signatures completes the transaction")
+	}
+	if _, err := first.Finalize(); err == nil {
+		t.Error("finalized with one of two signatures")
+	}
+
+	second := copyPartial(ptx)
+	second.Sign(*signers[2])
+	if err := first.Matches(ptx); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Combine(second); err != nil {
+		t.Fatal(err)
+	}
+	if !first.IsComplete() {
+		t.Fatal("two of two signatures do not complete the transaction")
+	}
+	UTXO := UTXOSet{Chain: chain}
+	if err := first.CheckPrevOutputs(&UTXO); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := first.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTransactions(t, chain, aliceAddress, tx)
+
+	if got := balance(chain, bobAddress); got != amount-fee {
+		t.Errorf("bob has %d, want %d", got, amount-fee)
+	}
+}
+
+func TestPartialTransactionErrors(t *testing.T) {
+	alice, aliceAddress := newTestWallet()
+	chain := newTestChain(t, aliceAddress)
+	signers, ptx := newPartialSpend(t, chain, alice, aliceAddress, 10, 1)
+
+	tests := []struct {
+		name  string
+		check func(ptx *PartialTransaction) error
+	}{
+		{"output changed after signing", func(ptx *PartialTransaction) error {
+			ptx.Sign(*signers[0])
+			ptx.Tx.Outputs[0].Value--
+			ptx.Tx.ID = ptx.Tx.Hash()
+			return ptx.Validate()
+		}},
+		{"transaction does not match its ID", func(ptx *PartialTransaction) error {
+			ptx.Tx.Outputs[0].Value--
+			return ptx.Validate()
+		}},
+		{"signature from a key outside the multisig", func(ptx *PartialTransaction) error {
+			ptx.Inputs[0].Signatures[hex.EncodeToString(alice.PublicKey)] = ptx.Tx.SignInput(0, alice.PrivateKey, ptx.Inputs[0].RedeemScript)
+			return ptx.Validate()
+		}},
+		{"another redeem script", func(ptx *PartialTransaction) error {
+			_, redeemScript := newMultiSig(t, 2, 3)
+			ptx.Inputs[0].RedeemScript = redeemScript
+			return ptx.Validate()
+		}},
+		{"combined with another transaction", func(ptx *PartialTransaction) error {
+			other := copyPartial(ptx)
+			other.Tx.Outputs[0].Value--
+			other.Tx.ID = other.Tx.Hash()
+			return ptx.Combine(other)
+		}},
+		{"changed before signing", func(ptx *PartialTransaction) error {
+			original := copyPartial(ptx)
+			ptx.Tx.Outputs[0].Value--
+			ptx.Tx.ID = ptx.Tx.Hash()
+			return ptx.Matches(original)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.check(copyPartial(ptx)); err == nil {
+				t.Error("check passed")
+			}
+		})
+	}
+}
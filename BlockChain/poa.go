@@ -0,0 +1,342 @@
+package BlockChain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/Wallet"
+	"math/big"
+	"sort"
+)
+
+const snapshotCacheSize = 128
+
+var ErrNoSignerKey = errors.New("no signer key is configured")
+
+var errUnknownHeader = errors.New("block is neither stored nor in the header index")
+
+// Vote proposes adding (Authorize) or removing a signer. Once more than half
+// of the current signers have voted for the same proposal it takes effect.
+type Vote struct {
+	Address   string
+	Authorize bool
+}
+
+type ProofOfAuthority struct {
+	Chain   *Chain
+	Signers []string
+	Key     *ecdsa.PrivateKey
+	Vote    Vote
+
+	snapshots map[string]*Snapshot
+}
+
+type Snapshot struct {
+	Hash    []byte
+	Height  int
+	Signers map[string]bool
+	Recent  []string
+	Tally   map[Vote]map[string]bool
+}
+
+func NewProofOfAuthority(chain *Chain, signers []string) *ProofOfAuthority {
+	return &ProofOfAuthority{Chain: chain, Signers: signers, snapshots: make(map[string]*Snapshot)}
+}
+
+func (b *Block) SealHash() []byte {
+	return b.Header().SealHash()
+}
+
+func (b *Block) SignerAddress() string {
+	return string(Wallet.EncodeAddress(Wallet.Version, Wallet.PublicKeyHash(b.Signer)))
+}
+
+func (poa *ProofOfAuthority) Seal(block *Block, quit <-chan struct{}) error {
+	if poa.Key == nil {
+		return ErrNoSignerKey
+	}
+
+	block.Signer = Wallet.PublicKeyBytes(poa.Key.PublicKey)
+	signer := block.SignerAddress()
+
+	snap, err := poa.Snapshot(block.PrevHash)
+	if err != nil {
+		return err
+	}
+
+	if err := snap.CanSign(signer); err != nil {
+		return err
+	}
+
+	block.Vote = Vote{}
+	if poa.Vote.Address != "" && snap.Signers[poa.Vote.Address] != poa.Vote.Authorize {
+		block.Vote = poa.Vote
+	}
+
+	block.Nonce = 0
+	block.Hash = block.SealHash()
+
+	r, s, err := ecdsa.Sign(rand.Reader, poa.Key, block.Hash)
+	if err != nil {
+		return err
+	}
+	block.Signature = append(Wallet.PaddedBytes(r), Wallet.PaddedBytes(s)...)
+
+	return nil
+}
+
+func (poa *ProofOfAuthority) Verify(block *Block) error {
+	if block.Height == 0 {
+		return ProofOfWorkConsensus{Algorithm: poa.Chain.Params.PowAlgorithm}.Verify(block)
+	}
+
+	header := block.Header()
+	if err := poa.verifySeal(header); err != nil {
+		return err
+	}
+
+	snap, err := poa.Snapshot(block.PrevHash)
+	if err != nil {
+		return err
+	}
+
+	return snap.apply(header)
+}
+
+// VerifyHeader checks the seal and, when the parent is a stored block or a
+// header of the header index, that the signer is an authority whose turn it
+// is. A header chain signed by any other key is rejected before its blocks
+// are downloaded.
+func (poa *ProofOfAuthority) VerifyHeader(header Header) error {
+	if header.Height == 0 {
+		return ProofOfWorkConsensus{Algorithm: poa.Chain.Params.PowAlgorithm}.VerifyHeader(header)
+	}
+
+	if err := poa.verifySeal(header); err != nil {
+		return err
+	}
+
+	snap, err := poa.Snapshot(header.PrevHash)
+	if err == errUnknownHeader {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := snap.apply(header); err != nil {
+		return err
+	}
+	poa.remember(snap)
+
+	return nil
+}
+
+func (poa *ProofOfAuthority) verifySeal(header Header) error {
+	if len(header.Signature) != SignatureSize {
+		return errors.New("block is not signed")
+	}
+
+	if !bytes.Equal(header.Hash, header.SealHash()) {
+		return errors.New("block hash does not match its seal")
+	}
+
+	publicKey, err := Wallet.ParsePublicKey(header.Signer)
+	if err != nil {
+		return err
+	}
+
+	r := new(big.Int).SetBytes(header.Signature[:Wallet.KeyLength])
+	s := new(big.Int).SetBytes(header.Signature[Wallet.KeyLength:])
+	if !ecdsa.Verify(publicKey, header.Hash, r, s) {
+		return errors.New("block has an invalid signature")
+	}
+
+	if header.Vote.Address != "" {
+		return validateSigner(header.Vote.Address)
+	}
+
+	return nil
+}
+
+// Snapshot returns the signer set and pending votes after the block with the
+// given hash, replaying headers back to the nearest cached snapshot. Headers
+// whose blocks are not stored yet come from the header index.
+func (poa *ProofOfAuthority) Snapshot(hash []byte) (*Snapshot, error) {
+	var headers []Header
+	var snap *Snapshot
+
+	for snap == nil {
+		if cached, ok := poa.snapshots[hex.EncodeToString(hash)]; ok {
+			snap = cached.copy()
+			break
+		}
+
+		header, err := poa.header(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Height == 0 {
+			snap = newSnapshot(header.Hash, poa.Signers)
+			break
+		}
+
+		headers = append(headers, header)
+		hash = header.PrevHash
+	}
+
+	for i := len(headers) - 1; i >= 0; i-- {
+		if err := snap.apply(headers[i]); err != nil {
+			return nil, fmt.Errorf("block %x: %s", headers[i].Hash, err)
+		}
+	}
+	poa.remember(snap)
+
+	return snap, nil
+}
+
+func (poa *ProofOfAuthority) header(hash []byte) (Header, error) {
+	if block, err := poa.Chain.GetBlock(hash); err == nil {
+		return block.Header(), nil
+	}
+
+	if poa.Chain.Headers != nil {
+		if header, ok := poa.Chain.Headers.Header(hash); ok {
+			return header, nil
+		}
+	}
+
+	return Header{}, errUnknownHeader
+}
+
+func (poa *ProofOfAuthority) remember(snap *Snapshot) {
+	if len(poa.snapshots) >= snapshotCacheSize {
+		poa.snapshots = make(map[string]*Snapshot)
+	}
+	poa.snapshots[hex.EncodeToString(snap.Hash)] = snap.copy()
+}
+
+func newSnapshot(hash []byte, signers []string) *Snapshot {
+	snap := &Snapshot{
+		Hash:    hash,
+		Signers: make(map[string]bool),
+		Tally:   make(map[Vote]map[string]bool),
+	}
+
+	for _, signer := range signers {
+		snap.Signers[signer] = true
+	}
+
+	return snap
+}
+
+func (s *Snapshot) copy() *Snapshot {
+	snap := &Snapshot{
+		Hash:    s.Hash,
+		Height:  s.Height,
+		Signers: make(map[string]bool),
+		Recent:  append([]string{}, s.Recent...),
+		Tally:   make(map[Vote]map[string]bool),
+	}
+
+	for signer := range s.Signers {
+		snap.Signers[signer] = true
+	}
+
+	for vote, voters := range s.Tally {
+		snap.Tally[vote] = make(map[string]bool)
+		for voter := range voters {
+			snap.Tally[vote][voter] = true
+		}
+	}
+
+	return snap
+}
+
+func (s *Snapshot) SignerList() []string {
+	var signers []string
+	for signer := range s.Signers {
+		signers = append(signers, signer)
+	}
+	sort.Strings(signers)
+
+	return signers
+}
+
+// CanSign enforces turn taking: with N signers, a signer has to wait for N/2
+// other signers before it may seal again.
+func (s *Snapshot) CanSign(signer string) error {
+	if !s.Signers[signer] {
+		return fmt.Errorf("%s is not an authorized signer", signer)
+	}
+
+	for _, recent := range s.Recent {
+		if recent == signer {
+			return fmt.Errorf("%s signed one of the last %d blocks", signer, len(s.Recent))
+		}
+	}
+
+	return nil
+}
+
+func (s *Snapshot) apply(header Header) error {
+	signer := header.SignerAddress()
+	if err := s.CanSign(signer); err != nil {
+		return err
+	}
+
+	s.Recent = append(s.Recent, signer)
+
+	vote := header.Vote
+	if vote.Address != "" && s.Signers[vote.Address] != vote.Authorize {
+		delete(s.Tally[Vote{vote.Address, !vote.Authorize}], signer)
+		if s.Tally[vote] == nil {
+			s.Tally[vote] = make(map[string]bool)
+		}
+		s.Tally[vote][signer] = true
+
+		if len(s.Tally[vote]) > len(s.Signers)/2 && (vote.Authorize || len(s.Signers) > 1) {
+			s.enact(vote)
+		}
+	}
+
+	if limit := len(s.Signers) / 2; len(s.Recent) > limit {
+		s.Recent = s.Recent[len(s.Recent)-limit:]
+	}
+
+	s.Hash = header.Hash
+	s.Height = header.Height
+
+	return nil
+}
+
+func (s *Snapshot) enact(vote Vote) {
+	delete(s.Tally, Vote{vote.Address, true})
+	delete(s.Tally, Vote{vote.Address, false})
+
+	if vote.Authorize {
+		s.Signers[vote.Address] = true
+		return
+	}
+
+	delete(s.Signers, vote.Address)
+
+	for proposal, voters := range s.Tally {
+		delete(voters, vote.Address)
+		if len(voters) == 0 {
+			delete(s.Tally, proposal)
+		}
+	}
+
+	var recent []string
+	for _, signer := range s.Recent {
+		if signer != vote.Address {
+			recent = append(recent, signer)
+		}
+	}
+	s.Recent = recent
+}
@@ -0,0 +1,272 @@
+package BlockChain
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"github.com/koushamad/blockchain/Wallet"
+	"testing"
+)
+
+// newPoAChain creates a proof of authority chain with n signers.
+func newPoAChain(t *testing.T, n int) (*Chain, []*Wallet.Wallet) {
+	t.Helper()
+
+	var signers []*Wallet.Wallet
+	var addresses []string
+	for i := 0; i < n; i++ {
+		w, address := newTestWallet()
+		signers = append(signers, w)
+		addresses = append(addresses, address)
+	}
+
+	params := TestNetParams
+	params.DBPath = t.TempDir()
+	params.CoinbaseMaturity = 0
+
+	chain := InitBlockChainWithConsensus(addresses[0], &params, ConsensusConfig{Engine: ProofOfAuthorityEngine, Signers: addresses})
+	t.Cleanup(func() { chain.Database.Close() })
+	UTXOSet{Chain: chain}.Reindex()
+
+	return chain, signers
+}
+
+func sealWith(chain *Chain, w *Wallet.Wallet, vote Vote) (*Block, error) {
+	poa := chain.Consensus.(*ProofOfAuthority)
+	poa.Key = &w.PrivateKey
+	poa.Vote = vote
+
+	return Miner{Chain: chain, RewardAddress: string(w.Address())}.MineBlock(nil)
+}
+
+func TestConsensusConfigValidate(t *testing.T) {
+	_, address := newTestWallet()
+	script := ScriptAddress(NewPayToScriptHashScript(ScriptHash([]byte{OpTrue})))
+
+	tests := []struct {
+		name   string
+		config ConsensusConfig
+		ok     bool
+	}{
+		{"proof of work", ConsensusConfig{Engine: ProofOfWorkEngine}, true},
+		{"proof of work with signers", ConsensusConfig{Engine: ProofOfWorkEngine, Signers: []string{address}}, false},
+		{"proof of authority", ConsensusConfig{Engine: ProofOfAuthorityEngine, Signers: []string{address}}, true},
+		{"proof of authority without signers", ConsensusConfig{Engine: ProofOfAuthorityEngine}, false},
+		{"signer listed twice", ConsensusConfig{Engine: ProofOfAuthorityEngine, Signers: []string{address, address}}, false},
+		{"script signer", ConsensusConfig{Engine: ProofOfAuthorityEngine, Signers: []string{script}}, false},
+		{"invalid signer", ConsensusConfig{Engine: ProofOfAuthorityEngine, Signers: []string{"signer"}}, false},
+		{"unknown engine", ConsensusConfig{Engine: "pos"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.ok != (err == nil) {
+				t.Errorf("got error %v, want success %t", err, test.ok)
+			}
+		})
+	}
+}
+
+func TestProofOfAuthorityTurns(t *testing.T) {
+	chain, signers := newPoAChain(t, 3)
+	outsider, _ := newTestWallet()
+
+	steps := []struct {
+		signer *Wallet.Wallet
+		ok     bool
+	}{
+		{signers[0], true},
+		{signers[0], false},
+		{signers[1], true},
+		{signers[1], false},
+		{signers[0], true},
+		{signers[2], true},
+		{outsider, false},
+	}
+
+	for i, step := range steps {
+		_, err := sealWith(chain, step.signer, Vote{})
+		if step.ok != (err == nil) {
+			t.Fatalf("step %d: got error %v, want success %t", i, err, step.ok)
+		}
+	}
+
+	if height := chain.GetBestHeight(); height != 4 {
+		t.Errorf("chain is at height %d, want 4", height)
+	}
+}
+
+func TestProofOfAuthorityVotes(t *testing.T) {
+	chain, signers := newPoAChain(t, 3)
+	poa := chain.Consensus.(*ProofOfAuthority)
+	newcomer, candidate := newTestWallet()
+	removed := string(signers[2].Address())
+
+	steps := []struct {
+		signer  *Wallet.Wallet
+		vote    Vote
+		members int
+		ok      bool
+	}{
+		{signers[0], Vote{candidate, true}, 3, true},
+		{signers[1], Vote{candidate, true}, 4, true},
+		{signers[2], Vote{removed, false}, 4, true},
+		{newcomer, Vote{removed, false}, 4, true},
+		{signers[0], Vote{removed, false}, 3, true},
+		{signers[2], Vote{}, 3, false},
+	}
+
+	for i, step := range steps {
+		block, err := sealWith(chain, step.signer, step.vote)
+		if step.ok != (err == nil) {
+			t.Fatalf("step %d: got error %v, want success %t", i, err, step.ok)
+		}
+		if !step.ok {
+			continue
+		}
+
+		snap, err := poa.Snapshot(block.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snap.Signers) != step.members {
+			t.Errorf("step %d: %d signers, want %d", i, len(snap.Signers), step.members)
+		}
+	}
+
+	snap, err := poa.Snapshot(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snap.Signers[candidate] || snap.Signers[removed] {
+		t.Errorf("signers are %v", snap.SignerList())
+	}
+}
+
+func TestProofOfAuthorityVerify(t *testing.T) {
+	chain, signers := newPoAChain(t, 2)
+	outsider, _ := newTestWallet()
+	genesis := chain.Iterator().Next()
+
+	signed := func(w *Wallet.Wallet) *Block {
+		block := NewBlock([]*Transaction{NewCoinbaseTX(string(w.Address()), "", BlockSubsidy)}, genesis.Hash, 1)
+		block.Signer = w.PublicKey
+		block.Hash = block.SealHash()
+
+		r, s, err := ecdsa.Sign(rand.Reader, &w.PrivateKey, block.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Signature = append(Wallet.PaddedBytes(r), Wallet.PaddedBytes(s)...)
+
+		return block
+	}
+
+	tests := []struct {
+		name  string
+		block func() *Block
+		ok    bool
+	}{
+		{"authorized signer", func() *Block { return signed(signers[1]) }, true},
+		{"outsider", func() *Block { return signed(outsider) }, false},
+		{"unsigned", func() *Block {
+			block := signed(signers[1])
+			block.Signature = nil
+			return block
+		}, false},
+		{"changed after sealing", func() *Block {
+			block := signed(signers[1])
+			block.Timestamp++
+			return block
+		}, false},
+		{"signature of another signer", func() *Block {
+			block := signed(signers[1])
+			block.Signer = signers[0].PublicKey
+			block.Hash = block.SealHash()
+			return block
+		}, false},
+		{"vote for an invalid signer", func() *Block {
+			block := signed(signers[1])
+			block.Vote = Vote{"signer", true}
+			block.Hash = block.SealHash()
+			r, s, _ := ecdsa.Sign(rand.Reader, &signers[1].PrivateKey, block.Hash)
+			block.Signature = append(Wallet.PaddedBytes(r), Wallet.PaddedBytes(s)...)
+			return block
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := chain.Consensus.Verify(test.block())
+			if test.ok != (err == nil) {
+				t.Errorf("got error %v, want success %t", err, test.ok)
+			}
+		})
+	}
+}
+
+type headerMap map[string]Header
+
+func (headers headerMap) HeaderHash(height int) ([]byte, bool) {
+	return nil, false
+}
+
+func (headers headerMap) Header(hash []byte) (Header, bool) {
+	header, ok := headers[string(hash)]
+	return header, ok
+}
+
+func TestProofOfAuthorityVerifyHeader(t *testing.T) {
+	chain, signers := newPoAChain(t, 3)
+	outsider, _ := newTestWallet()
+	genesis := chain.Iterator().Next().Header()
+
+	headers := make(headerMap)
+	chain.Headers = headers
+
+	signed := func(w *Wallet.Wallet, prev Header) Header {
+		header := Header{
+			PrevHash:   prev.Hash,
+			MerkleRoot: make([]byte, 32),
+			Height:     prev.Height + 1,
+			Timestamp:  prev.Timestamp + 1,
+			Signer:     w.PublicKey,
+		}
+		header.Hash = header.SealHash()
+
+		r, s, err := ecdsa.Sign(rand.Reader, &w.PrivateKey, header.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header.Signature = append(Wallet.PaddedBytes(r), Wallet.PaddedBytes(s)...)
+
+		return header
+	}
+
+	if err := chain.CheckHeader(signed(outsider, genesis), genesis); err == nil {
+		t.Error("accepted a header signed by an outsider")
+	}
+
+	first := signed(signers[0], genesis)
+	if err := chain.CheckHeader(first, genesis); err != nil {
+		t.Fatal(err)
+	}
+	headers[string(first.Hash)] = first
+
+	if err := chain.CheckHeader(signed(signers[0], first), first); err == nil {
+		t.Error("accepted a header from a signer whose turn it is not")
+	}
+	if err := chain.CheckHeader(signed(outsider, first), first); err == nil {
+		t.Error("accepted a header signed by an outsider on a header chain")
+	}
+
+	second := signed(signers[1], first)
+	if err := chain.CheckHeader(second, first); err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := Header{Hash: make([]byte, 32), Height: 5, Timestamp: genesis.Timestamp}
+	if err := chain.CheckHeader(signed(outsider, unknown), unknown); err != nil {
+		t.Errorf("header with an unknown parent: %s", err)
+	}
+}
@@ -0,0 +1,112 @@
+package BlockChain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+	"sort"
+)
+
+const (
+	SHA256Algorithm = "sha256"
+	ScryptAlgorithm = "scrypt"
+	Argon2Algorithm = "argon2id"
+
+	scryptN           = 1024
+	scryptR           = 8
+	argon2MemoryKiB   = 4096
+	memoryHardBits    = 10
+	powHashLength     = 32
+	argon2Parallelism = 1
+)
+
+// PowAlgorithm hashes block headers for proof of work. Memory-hard hashes
+// cost milliseconds each, so they come with a lower difficulty than SHA-256.
+type PowAlgorithm interface {
+	Name() string
+	Difficulty() int
+	Hash(data []byte) []byte
+}
+
+type sha256Pow struct{}
+
+func (sha256Pow) Name() string {
+	return SHA256Algorithm
+}
+
+func (sha256Pow) Difficulty() int {
+	return Difficulty
+}
+
+func (sha256Pow) Hash(data []byte) []byte {
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
+
+// scryptPow uses the header as password and salt like Litecoin, with r=8 so
+// every hash touches 1 MiB of memory.
+type scryptPow struct{}
+
+func (scryptPow) Name() string {
+	return ScryptAlgorithm
+}
+
+func (scryptPow) Difficulty() int {
+	return memoryHardBits
+}
+
+func (scryptPow) Hash(data []byte) []byte {
+	hash, err := scrypt.Key(data, data, scryptN, scryptR, 1, powHashLength)
+	if err != nil {
+		panic(err)
+	}
+
+	return hash
+}
+
+type argon2Pow struct{}
+
+func (argon2Pow) Name() string {
+	return Argon2Algorithm
+}
+
+func (argon2Pow) Difficulty() int {
+	return memoryHardBits
+}
+
+func (argon2Pow) Hash(data []byte) []byte {
+	return argon2.IDKey(data, data, 1, argon2MemoryKiB, argon2Parallelism, powHashLength)
+}
+
+var powAlgorithms = map[string]PowAlgorithm{
+	SHA256Algorithm: sha256Pow{},
+	ScryptAlgorithm: scryptPow{},
+	Argon2Algorithm: argon2Pow{},
+}
+
+// PowAlgorithmByName resolves the algorithm a block declares, blocks from
+// before algorithms were selectable declare none and use SHA-256.
+func PowAlgorithmByName(name string) (PowAlgorithm, error) {
+	if name == "" {
+		name = SHA256Algorithm
+	}
+
+	algorithm, ok := powAlgorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown proof of work algorithm %q", name)
+	}
+
+	return algorithm, nil
+}
+
+func PowAlgorithmNames() []string {
+	var names []string
+	for name := range powAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
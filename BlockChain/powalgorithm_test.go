@@ -0,0 +1,130 @@
+package BlockChain
+
+import (
+	"os"
+	"testing"
+)
+
+func benchmarkPow(b *testing.B, name string) {
+	algorithm, err := PowAlgorithmByName(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	_, address := newTestWallet()
+	block := NewBlock([]*Transaction{CoinbaseTX(address, "")}, make([]byte, 32), 1)
+	block.Algorithm = algorithm.Name()
+	pow := NewProof(block)
+
+	b.ResetTimer()
+	for nonce := 0; nonce < b.N; nonce++ {
+		block.Nonce = nonce
+		pow.Validate()
+	}
+}
+
+func BenchmarkSHA256(b *testing.B) {
+	benchmarkPow(b, SHA256Algorithm)
+}
+
+func BenchmarkScrypt(b *testing.B) {
+	benchmarkPow(b, ScryptAlgorithm)
+}
+
+func BenchmarkArgon2(b *testing.B) {
+	benchmarkPow(b, Argon2Algorithm)
+}
+
+func TestPowAlgorithmByName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"", SHA256Algorithm, true},
+		{SHA256Algorithm, SHA256Algorithm, true},
+		{ScryptAlgorithm, ScryptAlgorithm, true},
+		{Argon2Algorithm, Argon2Algorithm, true},
+		{"md5", "", false},
+	}
+
+	for _, test := range tests {
+		algorithm, err := PowAlgorithmByName(test.name)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%q: got %s, want an error", test.name, algorithm.Name())
+			}
+			continue
+		}
+		if err != nil || algorithm.Name() != test.want {
+			t.Errorf("%q: got %v %v, want %s", test.name, algorithm, err, test.want)
+		}
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	networks["broken"] = &Params{Name: "broken", PowAlgorithm: "md5"}
+	defer delete(networks, "broken")
+	os.Setenv(NetworkEnv, "broken")
+	defer os.Unsetenv(NetworkEnv)
+
+	if params, err := ActiveParams(); err == nil {
+		t.Errorf("loaded network %s with algorithm %q", params.Name, params.PowAlgorithm)
+	}
+
+	_, address := newTestWallet()
+	block := NewBlock([]*Transaction{CoinbaseTX(address, "")}, make([]byte, 32), 1)
+	block.Algorithm = "md5"
+	if _, _, ok := NewProof(block).RunUntil(nil); ok {
+		t.Error("sealed a block with an unknown algorithm")
+	}
+	if NewProof(block).Validate() {
+		t.Error("validated a block with an unknown algorithm")
+	}
+	if err := (ProofOfWorkConsensus{Algorithm: "md5"}).Seal(block, nil); err == nil {
+		t.Error("consensus sealed a block with an unknown algorithm")
+	}
+}
+
+func TestMemoryHardNetworks(t *testing.T) {
+	tests := []struct {
+		network   string
+		algorithm string
+	}{
+		{"scryptnet", ScryptAlgorithm},
+		{"argon2net", Argon2Algorithm},
+	}
+
+	for _, test := range tests {
+		t.Run(test.network, func(t *testing.T) {
+			network, err := ParamsByName(test.network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if network.PowAlgorithm != test.algorithm {
+				t.Fatalf("network uses %q, want %q", network.PowAlgorithm, test.algorithm)
+			}
+
+			params := *network
+			params.DBPath = t.TempDir()
+			_, address := newTestWallet()
+			chain := InitBlockChain(address, &params)
+			defer chain.Database.Close()
+			UTXOSet{Chain: chain}.Reindex()
+
+			block, err := Miner{Chain: chain, RewardAddress: address}.MineBlock(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block.Algorithm != test.algorithm {
+				t.Errorf("block declares %q, want %q", block.Algorithm, test.algorithm)
+			}
+
+			forged := *block
+			forged.Algorithm = SHA256Algorithm
+			if err := chain.Consensus.Verify(&forged); err == nil {
+				t.Error("accepted a block that declares another algorithm than the network")
+			}
+		})
+	}
+}
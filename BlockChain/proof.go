@@ -2,7 +2,6 @@ package BlockChain
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"github.com/koushamad/blockchain/Handler"
@@ -13,25 +12,44 @@ import (
 const Difficulty = 16
 
 type ProofOfWork struct {
-	Block  *Block
-	Target *big.Int
+	Block     *Block
+	Target    *big.Int
+	Algorithm PowAlgorithm
 }
 
+// NewProof dispatches on the algorithm the block declares, Algorithm is nil
+// when it is unknown and such a block never validates.
 func NewProof(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-Difficulty))
-	pow := &ProofOfWork{b, target}
+	algorithm, err := PowAlgorithmByName(b.Algorithm)
+	if err != nil {
+		return &ProofOfWork{b, Target(Difficulty), nil}
+	}
+
+	pow := &ProofOfWork{b, Target(algorithm.Difficulty()), algorithm}
 
 	return pow
 }
 
+func Target(difficulty int) *big.Int {
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-difficulty))
+
+	return target
+}
+
 func (pow ProofOfWork) InitData(nonce int) []byte {
+	return HeaderData(pow.Block.PrevHash, pow.Block.HashTransactions(), pow.Block.Timestamp, pow.Block.Height, nonce, pow.Algorithm.Difficulty())
+}
+
+func HeaderData(prevHash, merkleRoot []byte, timestamp int64, height int, nonce int, difficulty int) []byte {
 	data := bytes.Join(
 		[][]byte{
-			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
+			prevHash,
+			merkleRoot,
+			ToHex(timestamp),
+			ToHex(int64(height)),
 			ToHex(int64(nonce)),
-			ToHex(int64(Difficulty)),
+			ToHex(int64(difficulty)),
 		},
 		[]byte{},
 	)
@@ -40,16 +58,35 @@ func (pow ProofOfWork) InitData(nonce int) []byte {
 }
 
 func (pow *ProofOfWork) Run() (int, []byte) {
+	nonce, hash, _ := pow.RunUntil(nil)
+
+	return nonce, hash
+}
+
+// RunUntil gives up right away on a block with an unknown algorithm, it can
+// never be sealed.
+func (pow *ProofOfWork) RunUntil(quit <-chan struct{}) (int, []byte, bool) {
 	var intHash big.Int
-	var hash [32]byte
+	var hash []byte
 	nonce := 0
 
+	if pow.Algorithm == nil {
+		return nonce, hash, false
+	}
+
 	for nonce < math.MaxInt64 {
+		select {
+		case <-quit:
+			fmt.Println()
+			return nonce, hash, false
+		default:
+		}
+
 		data := pow.InitData(nonce)
-		hash = sha256.Sum256(data)
+		hash = pow.Algorithm.Hash(data)
 
 		fmt.Printf("\r%x", hash)
-		intHash.SetBytes(hash[:])
+		intHash.SetBytes(hash)
 
 		if intHash.Cmp(pow.Target) == -1 {
 			break
@@ -60,19 +97,25 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 	}
 	fmt.Println()
 
-	return nonce, hash[:]
+	return nonce, hash, true
 }
 
 func (pow ProofOfWork) Validate() bool {
 	var intHash big.Int
 
-	data := pow.InitData(pow.Block.Nonce)
-	hash := sha256.Sum256(data)
-	intHash.SetBytes(hash[:])
+	if pow.Algorithm == nil {
+		return false
+	}
+
+	intHash.SetBytes(pow.Hash())
 
 	return intHash.Cmp(pow.Target) == -1
 }
 
+func (pow ProofOfWork) Hash() []byte {
+	return pow.Algorithm.Hash(pow.InitData(pow.Block.Nonce))
+}
+
 func ToHex(num int64) []byte {
 	buff := new(bytes.Buffer)
 
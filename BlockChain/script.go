@@ -0,0 +1,583 @@
+package BlockChain
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"strings"
+)
+
+const (
+	Op0                   = byte(0x00)
+	OpFalse               = Op0
+	OpPushData1           = byte(0x4c)
+	OpPushData2           = byte(0x4d)
+	OpPushData4           = byte(0x4e)
+	Op1Negate             = byte(0x4f)
+	Op1                   = byte(0x51)
+	OpTrue                = Op1
+	Op16                  = byte(0x60)
+	OpNop                 = byte(0x61)
+	OpIf                  = byte(0x63)
+	OpNotIf               = byte(0x64)
+	OpElse                = byte(0x67)
+	OpEndIf               = byte(0x68)
+	OpVerify              = byte(0x69)
+	OpReturn              = byte(0x6a)
+	OpDrop                = byte(0x75)
+	OpDup                 = byte(0x76)
+	OpSwap                = byte(0x7c)
+	OpSize                = byte(0x82)
+	OpEqual               = byte(0x87)
+	OpEqualVerify         = byte(0x88)
+	OpSha256              = byte(0xa8)
+	OpHash160             = byte(0xa9)
+	OpCheckSig            = byte(0xac)
+	OpCheckSigVerify      = byte(0xad)
+	OpCheckMultiSig       = byte(0xae)
+	OpCheckMultiSigVerify = byte(0xaf)
+	OpCheckLockTimeVerify = byte(0xb1)
+	OpCheckSequenceVerify = byte(0xb2)
+)
+
+const (
+	MaxScriptSize      = 10000
+	MaxScriptElement   = 520
+	MaxMultiSigKeys    = 16
+	HashLength         = 20
+	MaxOpReturnPayload = 80
+)
+
+var opcodeNames = map[byte]string{
+	Op0:                   "OP_0",
+	OpPushData1:           "OP_PUSHDATA1",
+	OpPushData2:           "OP_PUSHDATA2",
+	OpPushData4:           "OP_PUSHDATA4",
+	Op1Negate:             "OP_1NEGATE",
+	OpNop:                 "OP_NOP",
+	OpIf:                  "OP_IF",
+	OpNotIf:               "OP_NOTIF",
+	OpElse:                "OP_ELSE",
+	OpEndIf:               "OP_ENDIF",
+	OpVerify:              "OP_VERIFY",
+	OpReturn:              "OP_RETURN",
+	OpDrop:                "OP_DROP",
+	OpDup:                 "OP_DUP",
+	OpSwap:                "OP_SWAP",
+	OpSize:                "OP_SIZE",
+	OpEqual:               "OP_EQUAL",
+	OpEqualVerify:         "OP_EQUALVERIFY",
+	OpSha256:              "OP_SHA256",
+	OpHash160:             "OP_HASH160",
+	OpCheckSig:            "OP_CHECKSIG",
+	OpCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	OpCheckMultiSig:       "OP_CHECKMULTISIG",
+	OpCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+	OpCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+	OpCheckSequenceVerify: "OP_CHECKSEQUENCEVERIFY",
+}
+
+type ScriptClass int
+
+const (
+	NonStandardScript ScriptClass = iota
+	PubKeyHashScript
+	ScriptHashScript
+	MultiSigScript
+	HashLockScript
+	NullDataScript
+	TimeLockScript
+	HTLCScript
+)
+
+var scriptClassNames = map[ScriptClass]string{
+	NonStandardScript: "nonstandard",
+	PubKeyHashScript:  "pubkeyhash",
+	ScriptHashScript:  "scripthash",
+	MultiSigScript:    "multisig",
+	HashLockScript:    "hashlock",
+	NullDataScript:    "nulldata",
+	TimeLockScript:    "timelock",
+	HTLCScript:        "htlc",
+}
+
+func (class ScriptClass) String() string {
+	return scriptClassNames[class]
+}
+
+type ScriptOp struct {
+	Opcode byte
+	Data   []byte
+}
+
+type ScriptBuilder struct {
+	script []byte
+	err    error
+}
+
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{}
+}
+
+func (b *ScriptBuilder) AddOp(opcode byte) *ScriptBuilder {
+	b.script = append(b.script, opcode)
+
+	return b
+}
+
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	if len(data) > MaxScriptElement {
+		b.err = fmt.Errorf("push of %d bytes exceeds the %d byte limit", len(data), MaxScriptElement)
+		return b
+	}
+
+	b.script = append(b.script, pushDataPrefix(len(data))...)
+	b.script = append(b.script, data...)
+
+	return b
+}
+
+func (b *ScriptBuilder) AddInt(num int64) *ScriptBuilder {
+	if num == 0 {
+		return b.AddOp(Op0)
+	}
+
+	if num == -1 || (num >= 1 && num <= 16) {
+		return b.AddOp(byte(int64(Op1-1) + num))
+	}
+
+	return b.AddData(encodeScriptNum(num))
+}
+
+func (b *ScriptBuilder) Script() ([]byte, error) {
+	return b.script, b.err
+}
+
+func pushDataPrefix(length int) []byte {
+	switch {
+	case length < int(OpPushData1):
+		return []byte{byte(length)}
+	case length <= 0xff:
+		return []byte{OpPushData1, byte(length)}
+	case length <= 0xffff:
+		prefix := []byte{OpPushData2, 0, 0}
+		binary.LittleEndian.PutUint16(prefix[1:], uint16(length))
+		return prefix
+	default:
+		prefix := []byte{OpPushData4, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(prefix[1:], uint32(length))
+		return prefix
+	}
+}
+
+func ParseScript(script []byte) ([]ScriptOp, error) {
+	var ops []ScriptOp
+
+	for i := 0; i < len(script); {
+		opcode := script[i]
+		i++
+
+		length := 0
+		switch {
+		case opcode > Op0 && opcode < OpPushData1:
+			length = int(opcode)
+		case opcode == OpPushData1:
+			if i+1 > len(script) {
+				return nil, errors.New("script truncated in OP_PUSHDATA1")
+			}
+			length = int(script[i])
+			i++
+		case opcode == OpPushData2:
+			if i+2 > len(script) {
+				return nil, errors.New("script truncated in OP_PUSHDATA2")
+			}
+			length = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		case opcode == OpPushData4:
+			if i+4 > len(script) {
+				return nil, errors.New("script truncated in OP_PUSHDATA4")
+			}
+			length = int(binary.LittleEndian.Uint32(script[i:]))
+			i += 4
+		}
+
+		if length < 0 || i+length > len(script) {
+			return nil, errors.New("script push exceeds script length")
+		}
+
+		op := ScriptOp{Opcode: opcode}
+		if isPushOp(opcode) && opcode != Op0 && opcode <= OpPushData4 {
+			op.Data = script[i : i+length]
+		}
+		i += length
+
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+func isPushOp(opcode byte) bool {
+	return opcode <= Op16 && opcode != byte(0x50)
+}
+
+func IsPushOnly(script []byte) bool {
+	ops, err := ParseScript(script)
+	if err != nil {
+		return false
+	}
+
+	for _, op := range ops {
+		if !isPushOp(op.Opcode) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func opcodeName(opcode byte) string {
+	if name, ok := opcodeNames[opcode]; ok {
+		return name
+	}
+
+	if opcode >= Op1 && opcode <= Op16 {
+		return fmt.Sprintf("OP_%d", opcode-Op1+1)
+	}
+
+	return fmt.Sprintf("OP_UNKNOWN%d", opcode)
+}
+
+func DisassembleScript(script []byte) string {
+	ops, err := ParseScript(script)
+	if err != nil {
+		return fmt.Sprintf("[error: %s] %x", err, script)
+	}
+
+	var parts []string
+	for _, op := range ops {
+		if op.Data != nil {
+			parts = append(parts, hex.EncodeToString(op.Data))
+		} else {
+			parts = append(parts, opcodeName(op.Opcode))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func mustScript(b *ScriptBuilder) []byte {
+	script, err := b.Script()
+	Handler.Handle(err)
+
+	return script
+}
+
+func NewPayToPubKeyHashScript(pubKeyHash []byte) []byte {
+	return mustScript(NewScriptBuilder().
+		AddOp(OpDup).
+		AddOp(OpHash160).
+		AddData(pubKeyHash).
+		AddOp(OpEqualVerify).
+		AddOp(OpCheckSig))
+}
+
+func NewPayToScriptHashScript(scriptHash []byte) []byte {
+	return mustScript(NewScriptBuilder().
+		AddOp(OpHash160).
+		AddData(scriptHash).
+		AddOp(OpEqual))
+}
+
+func NewMultiSigScript(required int, pubKeys [][]byte) ([]byte, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxMultiSigKeys {
+		return nil, fmt.Errorf("multisig needs between 1 and %d keys", MaxMultiSigKeys)
+	}
+
+	if required < 1 || required > len(pubKeys) {
+		return nil, fmt.Errorf("required signatures must be between 1 and %d", len(pubKeys))
+	}
+
+	builder := NewScriptBuilder().AddInt(int64(required))
+	for _, pubKey := range pubKeys {
+		if _, err := Wallet.ParsePublicKey(pubKey); err != nil {
+			return nil, err
+		}
+		builder.AddData(pubKey)
+	}
+	builder.AddInt(int64(len(pubKeys))).AddOp(OpCheckMultiSig)
+
+	return builder.Script()
+}
+
+func NewHashLockScript(hash []byte) []byte {
+	return mustScript(NewScriptBuilder().
+		AddOp(OpSha256).
+		AddData(hash).
+		AddOp(OpEqual))
+}
+
+func NewNullDataScript(data []byte) ([]byte, error) {
+	if len(data) > MaxOpReturnPayload {
+		return nil, fmt.Errorf("OP_RETURN payload is limited to %d bytes", MaxOpReturnPayload)
+	}
+
+	return NewScriptBuilder().AddOp(OpReturn).AddData(data).Script()
+}
+
+func NewTimeLockScript(lockOp byte, value int64, lockingScript []byte) []byte {
+	prefix := mustScript(NewScriptBuilder().
+		AddInt(value).
+		AddOp(lockOp).
+		AddOp(OpDrop))
+
+	return append(prefix, lockingScript...)
+}
+
+func SplitTimeLock(script []byte) (byte, int64, []byte) {
+	ops, err := ParseScript(script)
+	if err != nil || len(ops) < 4 || ops[2].Opcode != OpDrop {
+		return 0, 0, script
+	}
+
+	lockOp := ops[1].Opcode
+	if lockOp != OpCheckLockTimeVerify && lockOp != OpCheckSequenceVerify {
+		return 0, 0, script
+	}
+
+	value, ok := smallInt(ops[0].Opcode)
+	if ok {
+		return lockOp, int64(value), script[3:]
+	}
+
+	if ops[0].Data == nil {
+		return 0, 0, script
+	}
+
+	num, err := decodeScriptNum(ops[0].Data, 5)
+	if err != nil {
+		return 0, 0, script
+	}
+
+	prefixLength := len(pushDataPrefix(len(ops[0].Data))) + len(ops[0].Data) + 2
+
+	return lockOp, num, script[prefixLength:]
+}
+
+func ScriptHash(script []byte) []byte {
+	return Wallet.PublicKeyHash(script)
+}
+
+func ClassifyScript(script []byte) ScriptClass {
+	ops, err := ParseScript(script)
+	if err != nil {
+		return NonStandardScript
+	}
+
+	switch {
+	case isPayToPubKeyHash(ops):
+		return PubKeyHashScript
+	case isPayToScriptHash(ops):
+		return ScriptHashScript
+	case isMultiSig(ops):
+		return MultiSigScript
+	case isHashLock(ops):
+		return HashLockScript
+	case isHTLC(ops):
+		return HTLCScript
+	case len(ops) > 0 && ops[0].Opcode == OpReturn:
+		return NullDataScript
+	}
+
+	if lockOp, _, inner := SplitTimeLock(script); lockOp != 0 && ClassifyScript(inner) == PubKeyHashScript {
+		return TimeLockScript
+	}
+
+	return NonStandardScript
+}
+
+func isPayToPubKeyHash(ops []ScriptOp) bool {
+	return len(ops) == 5 &&
+		ops[0].Opcode == OpDup &&
+		ops[1].Opcode == OpHash160 &&
+		len(ops[2].Data) == HashLength &&
+		ops[3].Opcode == OpEqualVerify &&
+		ops[4].Opcode == OpCheckSig
+}
+
+func isPayToScriptHash(ops []ScriptOp) bool {
+	return len(ops) == 3 &&
+		ops[0].Opcode == OpHash160 &&
+		len(ops[1].Data) == HashLength &&
+		ops[2].Opcode == OpEqual
+}
+
+func isMultiSig(ops []ScriptOp) bool {
+	if len(ops) < 4 || ops[len(ops)-1].Opcode != OpCheckMultiSig {
+		return false
+	}
+
+	required, ok := smallInt(ops[0].Opcode)
+	total, ok2 := smallInt(ops[len(ops)-2].Opcode)
+	if !ok || !ok2 || total != len(ops)-3 || required < 1 || required > total {
+		return false
+	}
+
+	for _, op := range ops[1 : len(ops)-2] {
+		if op.Data == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isHashLock(ops []ScriptOp) bool {
+	return len(ops) == 3 &&
+		ops[0].Opcode == OpSha256 &&
+		len(ops[1].Data) == 32 &&
+		ops[2].Opcode == OpEqual
+}
+
+func smallInt(opcode byte) (int, bool) {
+	if opcode == Op0 {
+		return 0, true
+	}
+
+	if opcode >= Op1 && opcode <= Op16 {
+		return int(opcode-Op1) + 1, true
+	}
+
+	return 0, false
+}
+
+func ExtractAddressHash(script []byte) (byte, []byte) {
+	_, _, script = SplitTimeLock(script)
+
+	ops, err := ParseScript(script)
+	if err != nil {
+		return 0, nil
+	}
+
+	switch {
+	case isPayToPubKeyHash(ops):
+		return Wallet.Version, ops[2].Data
+	case isPayToScriptHash(ops):
+		return Wallet.ScriptVersion, ops[1].Data
+	}
+
+	return 0, nil
+}
+
+func ExtractMultiSigKeys(script []byte) (int, [][]byte, error) {
+	ops, err := ParseScript(script)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if !isMultiSig(ops) {
+		return 0, nil, errors.New("script is not a multisig script")
+	}
+
+	required, _ := smallInt(ops[0].Opcode)
+
+	var pubKeys [][]byte
+	for _, op := range ops[1 : len(ops)-2] {
+		pubKeys = append(pubKeys, op.Data)
+	}
+
+	return required, pubKeys, nil
+}
+
+func ScriptAddress(script []byte) string {
+	version, hash := ExtractAddressHash(script)
+	if hash == nil {
+		return ""
+	}
+
+	return string(Wallet.EncodeAddress(version, hash))
+}
+
+func LockingScript(address string) ([]byte, error) {
+	version, hash, err := Wallet.DecodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case Wallet.Version:
+		return NewPayToPubKeyHashScript(hash), nil
+	case Wallet.ScriptVersion:
+		return NewPayToScriptHashScript(hash), nil
+	}
+
+	return nil, fmt.Errorf("unknown address version %d", version)
+}
+
+func encodeScriptNum(num int64) []byte {
+	if num == 0 {
+		return nil
+	}
+
+	negative := num < 0
+	abs := num
+	if negative {
+		abs = -num
+	}
+
+	var result []byte
+	for abs > 0 {
+		result = append(result, byte(abs&0xff))
+		abs >>= 8
+	}
+
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+func decodeScriptNum(data []byte, maxLength int) (int64, error) {
+	if len(data) > maxLength {
+		return 0, fmt.Errorf("numeric value of %d bytes exceeds %d bytes", len(data), maxLength)
+	}
+
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var result int64
+	for i, b := range data {
+		result |= int64(b) << uint(8*i)
+	}
+
+	if data[len(data)-1]&0x80 != 0 {
+		result &= ^(int64(0x80) << uint(8*(len(data)-1)))
+		return -result, nil
+	}
+
+	return result, nil
+}
+
+func castToBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			if i == len(data)-1 && b == 0x80 {
+				return false
+			}
+			return true
+		}
+	}
+
+	return false
+}
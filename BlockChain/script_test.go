@@ -0,0 +1,123 @@
+package BlockChain
+
+import (
+	"github.com/koushamad/blockchain/Wallet"
+	"testing"
+)
+
+func newMultiSig(t *testing.T, required, total int) ([]*Wallet.Wallet, []byte) {
+	t.Helper()
+
+	var signers []*Wallet.Wallet
+	var pubKeys [][]byte
+	for i := 0; i < total; i++ {
+		w, _ := newTestWallet()
+		signers = append(signers, w)
+		pubKeys = append(pubKeys, w.PublicKey)
+	}
+
+	redeemScript, err := NewMultiSigScript(required, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signers, redeemScript
+}
+
+func TestNewMultiSigScript(t *testing.T) {
+	w, _ := newTestWallet()
+	keys := func(n int) [][]byte {
+		pubKeys := make([][]byte, n)
+		for i := range pubKeys {
+			pubKeys[i] = w.PublicKey
+		}
+		return pubKeys
+	}
+
+	tests := []struct {
+		name     string
+		required int
+		pubKeys  [][]byte
+		ok       bool
+	}{
+		{"1 of 1", 1, keys(1), true},
+		{"2 of 3", 2, keys(3), true},
+		{"16 of 16", MaxMultiSigKeys, keys(MaxMultiSigKeys), true},
+		{"no keys", 1, nil, false},
+		{"too many keys", 1, keys(MaxMultiSigKeys + 1), false},
+		{"no signatures required", 0, keys(2), false},
+		{"more signatures than keys", 3, keys(2), false},
+		{"invalid key", 1, [][]byte{[]byte("not a key")}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redeemScript, err := NewMultiSigScript(test.required, test.pubKeys)
+			if test.ok != (err == nil) {
+				t.Fatalf("got error %v, want success %t", err, test.ok)
+			}
+			if !test.ok {
+				return
+			}
+
+			if class := ClassifyScript(redeemScript); class != MultiSigScript {
+				t.Errorf("script classified as %s", class)
+			}
+			required, pubKeys, err := ExtractMultiSigKeys(redeemScript)
+			if err != nil || required != test.required || len(pubKeys) != len(test.pubKeys) {
+				t.Errorf("extracted %d of %d keys: %v", required, len(pubKeys), err)
+			}
+		})
+	}
+}
+
+func TestVerifyMultiSig(t *testing.T) {
+	signers, redeemScript := newMultiSig(t, 2, 3)
+	scriptPubKey := NewPayToScriptHashScript(ScriptHash(redeemScript))
+
+	tx := &Transaction{
+		Inputs:  []TxInput{{ID: []byte("previous"), Out: 0, Sequence: SequenceFinal}},
+		Outputs: []TXOutput{*NewTXOutput(5, string(signers[0].Address()))},
+	}
+	tx.ID = tx.Hash()
+
+	signatures := make([][]byte, len(signers))
+	for i, w := range signers {
+		signatures[i] = tx.SignInput(0, w.PrivateKey, redeemScript)
+	}
+
+	spend := func(dummy bool, sigs ...[]byte) []byte {
+		builder := NewScriptBuilder()
+		if dummy {
+			builder.AddOp(Op0)
+		}
+		for _, signature := range sigs {
+			builder.AddData(signature)
+		}
+		return script(t, builder.AddData(redeemScript))
+	}
+
+	tests := []struct {
+		name      string
+		scriptSig []byte
+		ok        bool
+	}{
+		{"first and second", spend(true, signatures[0], signatures[1]), true},
+		{"first and third", spend(true, signatures[0], signatures[2]), true},
+		{"second and third", spend(true, signatures[1], signatures[2]), true},
+		{"out of order", spend(true, signatures[1], signatures[0]), false},
+		{"same signature twice", spend(true, signatures[0], signatures[0]), false},
+		{"one signature", spend(true, signatures[0]), false},
+		{"missing dummy", spend(false, signatures[0], signatures[1]), false},
+		{"no redeem script", script(t, NewScriptBuilder().AddOp(Op0).AddData(signatures[0]).AddData(signatures[1])), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyScript(test.scriptSig, scriptPubKey, tx, 0)
+			if test.ok != (err == nil) {
+				t.Errorf("got error %v, want success %t", err, test.ok)
+			}
+		})
+	}
+}
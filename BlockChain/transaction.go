@@ -3,7 +3,6 @@ package BlockChain
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
@@ -12,30 +11,47 @@ import (
 	"fmt"
 	"github.com/koushamad/blockchain/Handler"
 	"github.com/koushamad/blockchain/Wallet"
-	"math/big"
 	"strings"
 )
 
+const (
+	BlockSubsidy                = 20
+	LockTimeThreshold           = 500000000
+	SequenceFinal               = uint32(0xffffffff)
+	SequenceReplaceable         = SequenceFinal - 2
+	SequenceLockTimeDisabled    = uint32(1 << 31)
+	SequenceLockTimeIsTime      = uint32(1 << 22)
+	SequenceLockTimeMask        = uint32(0x0000ffff)
+	SequenceLockTimeGranularity = 9
+)
+
 type Transaction struct {
-	ID      []byte
-	Inputs  []TxInput
-	Outputs []TXOutput
+	ID       []byte
+	Inputs   []TxInput
+	Outputs  []TXOutput
+	LockTime int64
 }
 
 type TXOutput struct {
-	Value      int
-	PupKeyHash []byte
+	Value        int
+	ScriptPubKey []byte
 }
 
+// TxOutputs are the unspent outputs of a transaction. MedianTime is the median
+// time past before its block, relative time locks count from there.
 type TxOutputs struct {
-	Outputs []TXOutput
+	Outputs    map[int]TXOutput
+	Height     int
+	Timestamp  int64
+	Coinbase   bool
+	MedianTime int64
 }
 
 type TxInput struct {
 	ID        []byte
 	Out       int
-	Signature []byte
-	PubKey    []byte
+	ScriptSig []byte
+	Sequence  uint32
 }
 
 func NewTXOutput(value int, address string) *TXOutput {
@@ -45,7 +61,35 @@ func NewTXOutput(value int, address string) *TXOutput {
 	return txo
 }
 
+func NewTimeLockedTXOutput(value int, address string, lockTime int64) *TXOutput {
+	txo := NewTXOutput(value, address)
+	txo.ScriptPubKey = NewTimeLockScript(OpCheckLockTimeVerify, lockTime, txo.ScriptPubKey)
+
+	return txo
+}
+
+func NewRelativeLockedTXOutput(value int, address string, blocks int64) *TXOutput {
+	if blocks < 0 || uint32(blocks) > SequenceLockTimeMask {
+		Handler.Handle(fmt.Errorf("relative lock must be between 0 and %d blocks", SequenceLockTimeMask))
+	}
+
+	txo := NewTXOutput(value, address)
+	txo.ScriptPubKey = NewTimeLockScript(OpCheckSequenceVerify, blocks, txo.ScriptPubKey)
+
+	return txo
+}
+
 func CoinbaseTX(to, data string) *Transaction {
+	return NewCoinbaseTX(to, data, BlockSubsidy)
+}
+
+func NewCoinbaseTX(to, data string, value int) *Transaction {
+	return NewPayoutCoinbaseTX([]Payment{{to, value}}, data)
+}
+
+func NewPayoutCoinbaseTX(payments []Payment, data string) *Transaction {
+	var outputs []TXOutput
+
 	if data == "" {
 		randData := make([]byte, 24)
 
@@ -55,9 +99,12 @@ func CoinbaseTX(to, data string) *Transaction {
 		data = fmt.Sprintf("%x", randData)
 	}
 
-	txin := TxInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(20, to)
-	tx := Transaction{nil, []TxInput{txin}, []TXOutput{*txout}}
+	for _, payment := range payments {
+		outputs = append(outputs, *NewTXOutput(payment.Amount, payment.Address))
+	}
+
+	txin := TxInput{[]byte{}, -1, []byte(data), SequenceFinal}
+	tx := Transaction{nil, []TxInput{txin}, outputs, 0}
 	tx.ID = tx.Hash()
 
 	return &tx
@@ -69,7 +116,7 @@ func (tx *Transaction) Hash() []byte {
 	txCopy := *tx
 	txCopy.ID = []byte{}
 
-	hash = sha256.Sum256(txCopy.Serialize())
+	hash = sha256.Sum256(txCopy.HashData())
 	return hash[:]
 }
 
@@ -78,18 +125,49 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 	var outputs []TXOutput
 
 	for _, in := range tx.Inputs {
-		inputs = append(inputs, TxInput{in.ID, in.Out, nil, nil})
+		inputs = append(inputs, TxInput{in.ID, in.Out, nil, in.Sequence})
 	}
 
 	for _, out := range tx.Outputs {
-		outputs = append(outputs, TXOutput{out.Value, out.PupKeyHash})
+		outputs = append(outputs, TXOutput{out.Value, out.ScriptPubKey})
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.ID, inputs, outputs, tx.LockTime}
 
 	return txCopy
 }
 
+// HashData is the encoding transaction IDs and merkle roots hash. Every field
+// is written in a fixed order with the length in front of each byte slice, so
+// unlike a gob stream it is the same in every process and every version.
+func (tx Transaction) HashData() []byte {
+	var data bytes.Buffer
+
+	writeBytes(&data, tx.ID)
+	data.Write(ToHex(int64(len(tx.Inputs))))
+	for _, in := range tx.Inputs {
+		writeBytes(&data, in.ID)
+		data.Write(ToHex(int64(in.Out)))
+		writeBytes(&data, in.ScriptSig)
+		data.Write(ToHex(int64(in.Sequence)))
+	}
+
+	data.Write(ToHex(int64(len(tx.Outputs))))
+	for _, out := range tx.Outputs {
+		data.Write(ToHex(int64(out.Value)))
+		writeBytes(&data, out.ScriptPubKey)
+	}
+
+	data.Write(ToHex(tx.LockTime))
+
+	return data.Bytes()
+}
+
+func writeBytes(data *bytes.Buffer, value []byte) {
+	data.Write(ToHex(int64(len(value))))
+	data.Write(value)
+}
+
 func (tx Transaction) Serialize() []byte {
 	var encoded bytes.Buffer
 
@@ -101,22 +179,134 @@ func (tx Transaction) Serialize() []byte {
 }
 
 func (tx *Transaction) SetID() {
-	var encoded bytes.Buffer
-	var hash [32]byte
-
-	encode := gob.NewEncoder(&encoded)
-	err := encode.Encode(tx)
-	Handler.Handle(err)
-
-	hash = sha256.Sum256(encoded.Bytes())
-	tx.ID = hash[:]
+	tx.ID = tx.Hash()
 }
 
 func (tx Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 1 && len(tx.Inputs[0].ID) == 0 && tx.Inputs[0].Out == -1
 }
 
+func (tx Transaction) Size() int {
+	return len(tx.Serialize())
+}
+
+func (tx Transaction) OutputValue() int {
+	value := 0
+	for _, out := range tx.Outputs {
+		value += out.Value
+	}
+
+	return value
+}
+
+// CheckSanity runs the checks that need nothing but the transaction itself,
+// the ID has to match the contents and an input listed twice or an output
+// that is not positive would let a transaction create coins out of thin air.
+func (tx Transaction) CheckSanity() error {
+	id := tx.Hash()
+	if !tx.IsCoinbase() {
+		unsigned := tx.TrimmedCopy()
+		id = unsigned.Hash()
+	}
+	if !bytes.Equal(tx.ID, id) {
+		return errors.New("transaction does not match its ID")
+	}
+
+	if len(tx.Inputs) == 0 {
+		return errors.New("transaction has no inputs")
+	}
+	if len(tx.Outputs) == 0 {
+		return errors.New("transaction has no outputs")
+	}
+
+	outPoints := make(map[string]bool)
+	for _, in := range tx.Inputs {
+		outPoint := OutPoint{in.ID, in.Out}.String()
+		if outPoints[outPoint] {
+			return fmt.Errorf("transaction spends %s twice", outPoint)
+		}
+		outPoints[outPoint] = true
+	}
+
+	total := 0
+	for i, out := range tx.Outputs {
+		if out.Value <= 0 {
+			return fmt.Errorf("output %d has a non-positive value %d", i, out.Value)
+		}
+		total += out.Value
+		if total < out.Value {
+			return errors.New("output values overflow")
+		}
+	}
+
+	return nil
+}
+
+func (tx Transaction) SignalsReplacement() bool {
+	for _, in := range tx.Inputs {
+		if in.Sequence <= SequenceReplaceable {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (tx Transaction) IsFinal(height int, blockTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+
+	limit := int64(height)
+	if tx.LockTime >= LockTimeThreshold {
+		limit = blockTime
+	}
+
+	if tx.LockTime < limit {
+		return true
+	}
+
+	for _, in := range tx.Inputs {
+		if in.Sequence != SequenceFinal {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (in TxInput) RelativeLock() (bool, int64) {
+	if in.Sequence&SequenceLockTimeDisabled != 0 {
+		return false, 0
+	}
+
+	value := int64(in.Sequence & SequenceLockTimeMask)
+	if in.Sequence&SequenceLockTimeIsTime != 0 {
+		return true, value << SequenceLockTimeGranularity
+	}
+
+	return false, value
+}
+
+func (tx *Transaction) SignatureHash(inputIdx int, subScript []byte) []byte {
+	txCopy := tx.TrimmedCopy()
+	txCopy.Inputs[inputIdx].ScriptSig = subScript
+
+	return txCopy.Hash()
+}
+
+func (tx *Transaction) SignInput(inputIdx int, priKey ecdsa.PrivateKey, subScript []byte) []byte {
+	r, s, err := ecdsa.Sign(rand.Reader, &priKey, tx.SignatureHash(inputIdx, subScript))
+	Handler.Handle(err)
+
+	return append(Wallet.PaddedBytes(r), Wallet.PaddedBytes(s)...)
+}
+
 func (tx *Transaction) Sigh(priKey ecdsa.PrivateKey, preTXs map[string]Transaction) {
+	tx.SighWithKeys([]ecdsa.PrivateKey{priKey}, preTXs)
+}
+
+func (tx *Transaction) SighWithKeys(keys []ecdsa.PrivateKey, preTXs map[string]Transaction) {
 	if tx.IsCoinbase() {
 		return
 	}
@@ -127,19 +317,34 @@ func (tx *Transaction) Sigh(priKey ecdsa.PrivateKey, preTXs map[string]Transacti
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
+	pubKeys := make(map[string][]byte)
+	privateKeys := make(map[string]ecdsa.PrivateKey)
+	for _, priKey := range keys {
+		pubKey := Wallet.PublicKeyBytes(priKey.PublicKey)
+		pubKeyHash := hex.EncodeToString(Wallet.PublicKeyHash(pubKey))
+		pubKeys[pubKeyHash] = pubKey
+		privateKeys[pubKeyHash] = priKey
+	}
 
-	for inId, in := range txCopy.Inputs {
+	for inId, in := range tx.Inputs {
 		preTX := preTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = preTX.Outputs[in.Out].PupKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
+		scriptPubKey := preTX.Outputs[in.Out].ScriptPubKey
 
-		r, s, err := ecdsa.Sign(rand.Reader, &priKey, txCopy.ID)
+		if class := ClassifyScript(scriptPubKey); class != PubKeyHashScript && class != TimeLockScript {
+			Handler.Handle(fmt.Errorf("input %d is not a pay-to-pubkey-hash output", inId))
+		}
+
+		_, hash := ExtractAddressHash(scriptPubKey)
+		pubKey, ok := pubKeys[hex.EncodeToString(hash)]
+		if !ok {
+			Handler.Handle(fmt.Errorf("no key to sign input %d", inId))
+		}
+
+		signature := tx.SignInput(inId, privateKeys[hex.EncodeToString(hash)], scriptPubKey)
+		scriptSig, err := NewScriptBuilder().AddData(signature).AddData(pubKey).Script()
 		Handler.Handle(err)
-		signature := append(r.Bytes(), s.Bytes()...)
-		tx.Inputs[inId].Signature = signature
+
+		tx.Inputs[inId].ScriptSig = scriptSig
 	}
 }
 
@@ -154,32 +359,13 @@ func (tx *Transaction) Verify(preTXs map[string]Transaction) bool {
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
-
 	for inId, in := range tx.Inputs {
 		preTx := preTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = preTx.Outputs[in.Out].PupKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(in.Signature)
-
-		r.SetBytes(in.Signature[:(sigLen / 2)])
-		s.SetBytes(in.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-
-		keyLen := len(in.PubKey)
-		x.SetBytes(in.PubKey[:(keyLen / 2)])
-		y.SetBytes(in.PubKey[(keyLen / 2):])
+		if in.Out < 0 || in.Out >= len(preTx.Outputs) {
+			return false
+		}
 
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
+		if err := VerifyScript(in.ScriptSig, preTx.Outputs[in.Out].ScriptPubKey, tx, inId); err != nil {
 			return false
 		}
 	}
@@ -191,38 +377,108 @@ func (tx Transaction) String() string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("	------	Transaction:	%x\n", tx.ID))
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("		LockTime:	%d", tx.LockTime))
+	}
 
 	for i, input := range tx.Inputs {
 		lines = append(lines, fmt.Sprintf("		Input:	 	%d", i))
 		lines = append(lines, fmt.Sprintf("		TXID: 		%x", input.ID))
 		lines = append(lines, fmt.Sprintf("		Out: 		%d", input.Out))
-		lines = append(lines, fmt.Sprintf("		Sixnature:	%x", input.Signature))
-		lines = append(lines, fmt.Sprintf("		PublicKey:	%x", input.PubKey))
+		if input.Sequence != SequenceFinal {
+			lines = append(lines, fmt.Sprintf("		Sequence:	%d", input.Sequence))
+		}
+
+		if tx.IsCoinbase() {
+			lines = append(lines, fmt.Sprintf("		Coinbase:	%x", input.ScriptSig))
+		} else {
+			lines = append(lines, fmt.Sprintf("		ScriptSig:	%s", DisassembleScript(input.ScriptSig)))
+		}
 	}
 
 	for i, output := range tx.Outputs {
 		lines = append(lines, fmt.Sprintf("		Output:		%d", i))
 		lines = append(lines, fmt.Sprintf("		Value:		%d", output.Value))
-		lines = append(lines, fmt.Sprintf("		Script:		%x\n", output.PupKeyHash))
+		lines = append(lines, fmt.Sprintf("		Type:		%s", ClassifyScript(output.ScriptPubKey)))
+		if address := ScriptAddress(output.ScriptPubKey); address != "" {
+			lines = append(lines, fmt.Sprintf("		Address:	%s", address))
+		}
+		lines = append(lines, fmt.Sprintf("		Script:		%s\n", DisassembleScript(output.ScriptPubKey)))
 	}
 
 	return strings.Join(lines, "\n")
 }
 
 func (in *TxInput) UsesKey(publicKeyHash []byte) bool {
-	lockingHash := Wallet.PublicKeyHash(in.PubKey)
+	ops, err := ParseScript(in.ScriptSig)
+	if err != nil || len(ops) == 0 {
+		return false
+	}
+
+	lockingHash := Wallet.PublicKeyHash(ops[len(ops)-1].Data)
 
 	return bytes.Compare(lockingHash, publicKeyHash) == 0
 }
 
 func (out *TXOutput) Lock(address []byte) {
-	pubKeyHash := Wallet.Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-Wallet.ChecksumLength]
-	out.PupKeyHash = pubKeyHash
+	script, err := LockingScript(string(address))
+	Handler.Handle(err)
+	out.ScriptPubKey = script
 }
 
 func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Compare(out.PupKeyHash, pubKeyHash) == 0
+	_, hash := ExtractAddressHash(out.ScriptPubKey)
+
+	return hash != nil && bytes.Compare(hash, pubKeyHash) == 0
+}
+
+// LockStart is the time relative time locks on the outputs count from, entries
+// stored before the median time was recorded fall back to the block time.
+func (outs TxOutputs) LockStart() int64 {
+	if outs.MedianTime == 0 {
+		return outs.Timestamp
+	}
+
+	return outs.MedianTime
+}
+
+func (outs TxOutputs) IsUnlocked(outIdx int, height int, blockTime int64, median int64) bool {
+	lockOp, value, _ := SplitTimeLock(outs.Outputs[outIdx].ScriptPubKey)
+
+	switch lockOp {
+	case OpCheckLockTimeVerify:
+		if value < LockTimeThreshold {
+			return value < int64(height)
+		}
+		return value < blockTime
+	case OpCheckSequenceVerify:
+		sequence := uint32(value)
+		if sequence&SequenceLockTimeDisabled != 0 {
+			return true
+		}
+		if sequence&SequenceLockTimeIsTime != 0 {
+			return median-outs.LockStart() >= int64(sequence&SequenceLockTimeMask)<<SequenceLockTimeGranularity
+		}
+		return int64(height-outs.Height) >= int64(sequence&SequenceLockTimeMask)
+	}
+
+	return true
+}
+
+// IsMature tells whether the outputs can be spent in a block at height. Every
+// entry records the height of its block, so a coinbase at height 0 is the
+// genesis coinbase. It is exempt, the address that created the chain could
+// always spend it right away and nothing else pays from before the first block.
+func (outs TxOutputs) IsMature(height int, maturity int) bool {
+	if !outs.Coinbase {
+		return true
+	}
+
+	if outs.Height == 0 {
+		return true
+	}
+
+	return height-outs.Height >= maturity
 }
 
 func (outs TxOutputs) Serialize() []byte {
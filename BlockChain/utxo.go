@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"github.com/dgraph-io/badger"
 	"github.com/koushamad/blockchain/Handler"
+	"time"
 )
 
 var (
@@ -16,6 +17,13 @@ type UTXOSet struct {
 	Chain *Chain
 }
 
+func utxoKey(txID []byte) []byte {
+	key := make([]byte, 0, PrefixLength+len(txID))
+	key = append(key, UTXOPrefix...)
+
+	return append(key, txID...)
+}
+
 func (u UTXOSet) Reindex() {
 	db := u.Chain.Database
 
@@ -29,9 +37,10 @@ func (u UTXOSet) Reindex() {
 				return err
 			}
 
-			key = append(UTXOPrefix, key...)
-			err = txn.Set(key, outs.Serialize())
-			return err
+			key = utxoKey(key)
+			if err = txn.Set(key, outs.Serialize()); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -40,46 +49,46 @@ func (u UTXOSet) Reindex() {
 
 func (u *UTXOSet) Update(block *Block) {
 	db := u.Chain.Database
-	err := db.Update(func(txn *badger.Txn) error {
+	median, err := u.Chain.medianTimeBefore(block)
+	Handler.Handle(err)
+
+	err = db.Update(func(txn *badger.Txn) error {
 		for _, tx := range block.Transactions {
-			if tx.IsCoinbase() {
+			if tx.IsCoinbase() == false {
 				for _, in := range tx.Inputs {
-					updateOuts := TxOutputs{}
-					inID := append(UTXOPrefix, in.ID...)
+					inID := utxoKey(in.ID)
 					item, err := txn.Get(inID)
 					if err != nil {
 						return err
 					}
 
 					var outs TxOutputs
-					_ = item.Value(func(val []byte) error {
+					if err := item.Value(func(val []byte) error {
 						outs = DeserializeOutputs(val)
 						return nil
-					})
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != in.Out {
-							updateOuts.Outputs = append(updateOuts.Outputs, out)
-						}
+					}); err != nil {
+						return err
 					}
-					if len(updateOuts.Outputs) == 0 {
+
+					delete(outs.Outputs, in.Out)
+					if len(outs.Outputs) == 0 {
 						if err := txn.Delete(inID); err != nil {
 							return err
 						}
 					} else {
-						if err := txn.Set(inID, updateOuts.Serialize()); err != nil {
+						if err := txn.Set(inID, outs.Serialize()); err != nil {
 							return err
 						}
 					}
 				}
 			}
 
-			newOutputs := TxOutputs{}
-			for _, out := range tx.Outputs {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
+			newOutputs := TxOutputs{make(map[int]TXOutput), block.Height, block.Timestamp, tx.IsCoinbase(), median}
+			for outIdx, out := range tx.Outputs {
+				newOutputs.Outputs[outIdx] = out
 			}
 
-			txID := append(UTXOPrefix, tx.ID...)
+			txID := utxoKey(tx.ID)
 			if err := txn.Set(txID, newOutputs.Serialize()); err != nil {
 				return err
 			}
@@ -128,12 +137,89 @@ func (u UTXOSet) FindUnspentTransactions(publicKeyHash []byte) []TXOutput {
 	return UTXOs
 }
 
+func (u UTXOSet) FindBalance(publicKeyHash []byte) (int, int) {
+	spendable, immature := 0, 0
+	height := u.Chain.GetBestHeight() + 1
+	maturity := u.Chain.Params.CoinbaseMaturity
+
+	err := u.Chain.Database.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(UTXOPrefix); it.ValidForPrefix(UTXOPrefix); it.Next() {
+			var outs TxOutputs
+
+			if err := it.Item().Value(func(val []byte) error {
+				outs = DeserializeOutputs(val)
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for _, out := range outs.Outputs {
+				if !out.IsLockedWithKey(publicKeyHash) {
+					continue
+				}
+
+				if outs.IsMature(height, maturity) {
+					spendable += out.Value
+				} else {
+					immature += out.Value
+				}
+			}
+		}
+
+		return nil
+	})
+
+	Handler.Handle(err)
+
+	return spendable, immature
+}
+
+func (u UTXOSet) GetOutputs(txID []byte) (TxOutputs, bool) {
+	var outs TxOutputs
+	var found bool
+
+	err := u.Chain.Database.View(func(txn *badger.Txn) error {
+		var err error
+		outs, found, err = outputsIn(txn, txID)
+		return err
+	})
+	Handler.Handle(err)
+
+	return outs, found
+}
+
+func outputsIn(txn *badger.Txn, txID []byte) (TxOutputs, bool, error) {
+	var outs TxOutputs
+
+	item, err := txn.Get(utxoKey(txID))
+	if err == badger.ErrKeyNotFound {
+		return outs, false, nil
+	} else if err != nil {
+		return outs, false, err
+	}
+
+	err = item.Value(func(val []byte) error {
+		outs = DeserializeOutputs(val)
+		return nil
+	})
+
+	return outs, err == nil, err
+}
+
 func (u UTXOSet) FindSpendableOutputs(publicKeyHash []byte, amount int) (int, map[string][]int) {
 	unspentOuts := make(map[string][]int)
 	accumulated := 0
 	db := u.Chain.Database
+	height := u.Chain.GetBestHeight() + 1
+	blockTime := time.Now().Unix()
+	median, err := u.Chain.MedianTimePast(u.Chain.LastHash)
+	Handler.Handle(err)
+	maturity := u.Chain.Params.CoinbaseMaturity
 
-	err := db.View(func(txn *badger.Txn) error {
+	err = db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		it := txn.NewIterator(opts)
 		defer it.Close()
@@ -150,11 +236,15 @@ func (u UTXOSet) FindSpendableOutputs(publicKeyHash []byte, amount int) (int, ma
 				return err
 			}
 
+			if !opts.IsMature(height, maturity) {
+				continue
+			}
+
 			k = bytes.TrimPrefix(k, UTXOPrefix)
 			txId := hex.EncodeToString(k)
 
 			for outIdx, out := range opts.Outputs {
-				if out.IsLockedWithKey(publicKeyHash) && accumulated < amount {
+				if out.IsLockedWithKey(publicKeyHash) && opts.IsUnlocked(outIdx, height, blockTime, median) && accumulated < amount {
 					accumulated += out.Value
 					unspentOuts[txId] = append(unspentOuts[txId], outIdx)
 				}
@@ -259,6 +349,7 @@ func (u UTXOSet) DeleteByPrefix(prefix []byte) {
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
 			key := it.Item().KeyCopy(nil)
 			keysForDelete = append(keysForDelete, key)
+			keysCollected++
 			if keysCollected == collectSize {
 				if err := deleteKeys(keysForDelete); err != nil {
 					return err
@@ -0,0 +1,126 @@
+package CommandLine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"sort"
+	"strings"
+)
+
+func parseSigners(value string) []string {
+	var signers []string
+
+	for _, signer := range strings.Split(value, ",") {
+		if signer = strings.TrimSpace(signer); signer != "" {
+			signers = append(signers, signer)
+		}
+	}
+
+	return signers
+}
+
+func parseVote(add, remove string) (BlockChain.Vote, error) {
+	if add != "" && remove != "" {
+		return BlockChain.Vote{}, errors.New("vote to add or to remove a signer, not both")
+	}
+
+	if add != "" {
+		return BlockChain.Vote{Address: add, Authorize: true}, nil
+	}
+
+	return BlockChain.Vote{Address: remove}, nil
+}
+
+// useSigner loads the key that seals the next block of a proof of authority
+// chain, picking the first wallet address whose turn it is when signer is empty.
+func (cli *CommandLine) useSigner(chain *BlockChain.Chain, signer string, vote BlockChain.Vote) error {
+	poa, ok := chain.Consensus.(*BlockChain.ProofOfAuthority)
+	if !ok {
+		if signer != "" || vote.Address != "" {
+			return errors.New("signers and votes need a proof of authority chain")
+		}
+		return nil
+	}
+
+	if vote.Address != "" && !Wallet.ValidateAddress(vote.Address) {
+		return errors.New("vote address is not valid")
+	}
+
+	snap, err := poa.Snapshot(chain.LastHash)
+	if err != nil {
+		return err
+	}
+
+	wallets, err := Wallet.CreateWallets()
+	if err != nil {
+		return err
+	}
+	keys := wallets.GetAllAddresses()
+
+	candidates := []string{signer}
+	if signer == "" {
+		candidates = snap.SignerList()
+	}
+
+	for _, address := range candidates {
+		w, ok := keys[address]
+		if !ok {
+			continue
+		}
+		if err := snap.CanSign(address); err != nil {
+			if signer != "" {
+				return err
+			}
+			continue
+		}
+
+		poa.Key = &w.PrivateKey
+		poa.Vote = vote
+		return nil
+	}
+
+	if signer != "" {
+		return fmt.Errorf("signer %s is not in the wallet", signer)
+	}
+
+	return errors.New("no wallet address may sign the next block")
+}
+
+func (cli *CommandLine) PoASigners() {
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	defer chain.Database.Close()
+
+	poa, ok := chain.Consensus.(*BlockChain.ProofOfAuthority)
+	if !ok {
+		Handler.Handle(errors.New("the chain does not use proof of authority"))
+	}
+
+	snap, err := poa.Snapshot(chain.LastHash)
+	Handler.Handle(err)
+
+	fmt.Printf("%d signers at height %d\n", len(snap.Signers), snap.Height)
+	for _, signer := range snap.SignerList() {
+		fmt.Println(signer)
+	}
+
+	if len(snap.Recent) > 0 {
+		fmt.Printf("Waiting for their turn: %s\n", strings.Join(snap.Recent, ", "))
+	}
+
+	var proposals []string
+	for vote, voters := range snap.Tally {
+		action := "remove"
+		if vote.Authorize {
+			action = "add"
+		}
+		proposals = append(proposals, fmt.Sprintf("%s %s: %d of %d votes", action, vote.Address, len(voters), len(snap.Signers)/2+1))
+	}
+	sort.Strings(proposals)
+
+	for _, proposal := range proposals {
+		fmt.Println(proposal)
+	}
+}
@@ -0,0 +1,47 @@
+package CommandLine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"math"
+	"time"
+)
+
+// PowBenchmark validates the same block with every proof of work algorithm
+// and estimates how long sealing takes at the algorithm's difficulty.
+func (cli *CommandLine) PowBenchmark(algorithm string, validations int) {
+	if validations < 1 {
+		Handler.Handle(errors.New("run at least one validation"))
+	}
+
+	names := BlockChain.PowAlgorithmNames()
+	if algorithm != "" {
+		names = []string{algorithm}
+	}
+
+	address := string(Wallet.MakeWallet().Address())
+	coinbase := BlockChain.CoinbaseTX(address, "")
+
+	fmt.Printf("%-10s %4s %14s %14s %14s\n", "algorithm", "bits", "validation", "hashes/s", "block time")
+	for _, name := range names {
+		pow, err := BlockChain.PowAlgorithmByName(name)
+		Handler.Handle(err)
+
+		block := BlockChain.NewBlock([]*BlockChain.Transaction{coinbase}, make([]byte, 32), 1)
+		block.Algorithm = pow.Name()
+
+		start := time.Now()
+		for nonce := 0; nonce < validations; nonce++ {
+			block.Nonce = nonce
+			BlockChain.NewProof(block).Validate()
+		}
+		perValidation := time.Since(start) / time.Duration(validations)
+		blockTime := time.Duration(float64(perValidation) * math.Pow(2, float64(pow.Difficulty())))
+
+		fmt.Printf("%-10s %4d %14s %14.0f %14s\n",
+			pow.Name(), pow.Difficulty(), perValidation, float64(time.Second)/float64(perValidation), blockTime.Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,49 @@
+package CommandLine
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+)
+
+func (cli *CommandLine) Checkpoints() {
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	defer chain.Database.Close()
+
+	checkpoints := append([]BlockChain.Checkpoint{}, chain.Params.Checkpoints...)
+	if chain.Params.AssumeValid != nil {
+		checkpoints = append(checkpoints, *chain.Params.AssumeValid)
+	}
+
+	if len(checkpoints) == 0 {
+		fmt.Printf("No checkpoints, set %s=HEIGHT:HASH,... or %s=HEIGHT:HASH\n", BlockChain.CheckpointsEnv, BlockChain.AssumeValidEnv)
+		return
+	}
+
+	hashes := make(map[int]string)
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		hashes[block.Height] = hex.EncodeToString(block.Hash)
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	for i, checkpoint := range checkpoints {
+		kind := "checkpoint"
+		if chain.Params.AssumeValid != nil && i == len(checkpoints)-1 {
+			kind = "assume-valid"
+		}
+
+		status := "not reached"
+		if hash, ok := hashes[checkpoint.Height]; ok {
+			status = "matches"
+			if hash != checkpoint.Hash {
+				status = fmt.Sprintf("conflicts with local block %s", hash)
+			}
+		}
+
+		fmt.Printf("%s	%s	%s\n", kind, checkpoint, status)
+	}
+}
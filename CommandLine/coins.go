@@ -0,0 +1,70 @@
+package CommandLine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"sort"
+	"strings"
+)
+
+func parseOutPoints(value string) ([]BlockChain.OutPoint, error) {
+	var outPoints []BlockChain.OutPoint
+
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		outPoint, err := BlockChain.ParseOutPoint(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		outPoints = append(outPoints, outPoint)
+	}
+
+	return outPoints, nil
+}
+
+func (cli *CommandLine) ListUnspent(address string) {
+	var addresses []string
+
+	if address != "" {
+		if !Wallet.ValidateAddress(address) {
+			Handler.Handle(errors.New("address is not valid"))
+		}
+		addresses = append(addresses, address)
+	} else {
+		wallets, err := Wallet.CreateWallets()
+		Handler.Handle(err)
+
+		for walletAddress := range wallets.GetAllAddresses() {
+			addresses = append(addresses, walletAddress)
+		}
+		for scriptAddress := range wallets.GetAllScripts() {
+			addresses = append(addresses, scriptAddress)
+		}
+		for watchAddress := range wallets.GetAllWatchOnly() {
+			addresses = append(addresses, watchAddress)
+		}
+		sort.Strings(addresses)
+	}
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	bestHeight := chain.GetBestHeight()
+
+	fmt.Println("TxID:Index	Value	Confirmations	Address")
+	for _, unspentAddress := range addresses {
+		_, pubKeyHash, err := Wallet.DecodeAddress(unspentAddress)
+		Handler.Handle(err)
+
+		for _, coin := range UTXOSet.FindUnspentOutputs(pubKeyHash) {
+			fmt.Printf("%s	%d	%d	%s\n", coin.OutPoint, coin.Output.Value, bestHeight-coin.Height+1, unspentAddress)
+		}
+	}
+}
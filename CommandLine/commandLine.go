@@ -1,28 +1,78 @@
 package CommandLine
 
 import (
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/koushamad/blockchain/BlockChain"
 	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Network"
+	"github.com/koushamad/blockchain/Stratum"
 	"github.com/koushamad/blockchain/Wallet"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
+	"time"
 )
 
-type CommandLine struct{}
+type CommandLine struct {
+	Params *BlockChain.Params
+}
+
+func (cli *CommandLine) params() *BlockChain.Params {
+	if cli.Params == nil {
+		params, err := BlockChain.ActiveParams()
+		Handler.Handle(err)
+		cli.Params = params
+	}
+
+	return cli.Params
+}
 
 func (cli *CommandLine) PrintUsage() {
 	fmt.Println("Usage:")
+	fmt.Printf("Set %s to select the network (mainnet, testnet, scryptnet, argon2net)\n", BlockChain.NetworkEnv)
+	fmt.Printf("Set %s=HEIGHT:HASH,... to add checkpoints and %s=HEIGHT:HASH to skip signature checks up to that block\n", BlockChain.CheckpointsEnv, BlockChain.AssumeValidEnv)
+	fmt.Printf("Set %s=HOST:PORT,... to add seed nodes the network node learns its first peers from\n", BlockChain.SeedsEnv)
 	fmt.Println("get-balance -address ADDRESS -get the balance for address")
-	fmt.Println("create-blockchain -address Address creates a blockchain")
+	fmt.Println("create-blockchain -address Address [-consensus pow|poa -signers ADDRESS,...] creates a blockchain, proof of authority chains are sealed by the signers in turn")
 	fmt.Println("print-chain - prints the block in the chain")
-	fmt.Println("send -from FROM -to TO -amount AMOUNT - Send amount")
-	fmt.Println("create-wallet Creates a new Wallet")
-	fmt.Println("list-address List the address in our wallet file")
+	fmt.Println("send -from FROM | -from-wallet -to TO -amount AMOUNT [-locktime HEIGHT|DATE] [-relative-locktime BLOCKS] [-strategy STRATEGY] [-coins TXID:INDEX,...] [-fee FEE | -target BLOCKS] [-rbf] [-mine=false] - Send amount, -from-wallet spends from every wallet address, the fee is estimated when -fee is omitted")
+	fmt.Println("send-many -from FROM -file FILE [-strategy STRATEGY] [-fee FEE | -target BLOCKS] [-rbf] [-mine=false] - Pays every address,amount pair of a CSV or JSON file in one transaction")
+	fmt.Println("list-unspent [-address ADDRESS] - Lists spendable outputs with their confirmations")
+	fmt.Println("print-mempool - Lists the transactions waiting to be mined")
+	fmt.Println("mine -address ADDRESS [-blocks N] [-signer ADDRESS] [-vote-add ADDRESS | -vote-remove ADDRESS] - Mines N blocks, or until interrupted when N is 0, paying the reward and fees to ADDRESS, proof of authority blocks are signed by -signer or the wallet signer whose turn it is")
+	fmt.Println("poa-signers - Lists the proof of authority signers and the open votes")
+	fmt.Println("start-node [-listen HOST:PORT] [-peers HOST:PORT,...] [-max-outbound N] [-max-inbound N] [-mine ADDRESS [-mine-interval DURATION]] - Runs a network node that syncs headers first and then downloads blocks from its peers in parallel, a node without a chain joins the network of its first peer, more peers are found through the address book, -mine mines on the node and relays the blocks as compact blocks")
+	fmt.Println("list-peers - Lists the address book of the node and the banned hosts")
+	fmt.Println("checkpoints - Shows the checkpoints and whether the local chain matches them")
+	fmt.Println("pow-benchmark [-algorithm NAME] [-validations N] - Measures block validation cost and expected block time of the proof of work algorithms")
+	fmt.Println("work-server -address ADDRESS [-listen HOST:PORT] [-share-difficulty BITS] [-pool [-pool-fee PERCENT] [-pplns-window SHARES]] - Serves mining work to external miners over a Stratum-like line protocol, -pool pays workers by PPLNS and ADDRESS the fee")
+	fmt.Println("work-miner -worker NAME [-server HOST:PORT] - Mines work from a work server and submits shares")
+	fmt.Println("pool-stats [-server HOST:PORT] - Shows shares, hashrate and pending and paid rewards per worker of a running pool")
+	fmt.Println("mine-mempool [-address ADDRESS] - Mines a block with the mempool transactions, highest package fee rate first, the reward goes to a new wallet change address when -address is omitted")
+	fmt.Println("estimate-fee [-blocks N] - Estimates the fee rate needed to confirm within N blocks from recent blocks and the mempool")
+	fmt.Println("bump-fee -txid TXID -fee FEE [-method rbf|cpfp] [-mine=false] - Raises the fee of a mempool transaction by replacement or with a child")
+	fmt.Println("create-wallet [-hd] Creates a new Wallet, -hd derives it from the wallet's extended key")
+	fmt.Println("list-address List the address in our wallet file, change addresses are listed after receiving ones")
 	fmt.Println("reindex-utxo Rebuilds the UTXO set")
+	fmt.Println("create-multisig -m M -keys KEY,KEY,... Creates an M-of-N multisig address from wallet addresses or hex public keys")
+	fmt.Println("create-tx -from FROM -to TO -amount AMOUNT -out FILE - Writes an unsigned transaction with the outputs it spends to FILE")
+	fmt.Println("sign-tx -in FILE -address ADDRESS [-out FILE] - Adds the signature of ADDRESS to a partially signed transaction, no chain needed")
+	fmt.Println("inspect-tx -in FILE - Shows a partially signed transaction and its signing progress")
+	fmt.Println("broadcast-tx -in FILE [-created FILE] - Validates a signed transaction, optionally against the created file, and mines it")
+	fmt.Println("combine-and-broadcast -in FILE,FILE,... - Combines partial signatures and mines the transaction")
+	fmt.Println("htlc-create -from FROM -to TO -amount AMOUNT -timeout HEIGHT|DATE [-hash HASH] [-refund ADDRESS] - Locks coins in a hash time-locked contract")
+	fmt.Println("htlc-redeem -txid TXID -index INDEX -preimage PREIMAGE -address ADDRESS [-to TO] [-fee FEE | -target BLOCKS] - Claims a contract by revealing the preimage, the fee comes out of the contract value")
+	fmt.Println("htlc-refund -txid TXID -index INDEX -address ADDRESS [-to TO] [-fee FEE | -target BLOCKS] - Reclaims a contract after its timeout")
+	fmt.Println("htlc-status -txid TXID -index INDEX - Shows a contract and the preimage once it was redeemed")
+	fmt.Println("import-watch -address ADDRESS | -pubkey HEX | -xpub XPUB [-gap N] - Watches addresses without their private keys, -xpub derives until N addresses in a row are unused")
+	fmt.Println("export-xpub - Prints the extended public key that create-wallet -hd addresses derive from")
+	fmt.Println("export-key -address ADDRESS [-format wif|pem] [-out FILE] - Exports the private key of a wallet address")
+	fmt.Println("import-key -wif KEY | -pem FILE [-rescan] - Imports a private key, -rescan rebuilds the UTXO set and lists its outputs")
+	fmt.Println("encrypt-wallet - Encrypts the wallet file with the passphrase of " + Wallet.NewPassphraseEnv + " or " + Wallet.PassphraseEnv + ", it stays locked unless " + Wallet.PassphraseEnv + " holds the passphrase")
 
 }
 
@@ -35,7 +85,7 @@ func (cli *CommandLine) ValidateArgs() {
 
 func (cli *CommandLine) PrintChain() {
 
-	chain := BlockChain.ContinueBlockChain("")
+	chain := BlockChain.ContinueBlockChain(cli.params())
 	defer chain.Database.Close()
 	iter := chain.Iterator()
 
@@ -43,11 +93,20 @@ func (cli *CommandLine) PrintChain() {
 
 	for {
 		block := iter.Next()
-		pow := BlockChain.NewProof(block)
 
+		fmt.Printf("Height:	%d\n", block.Height)
+		fmt.Printf("Time:	%s\n", time.Unix(block.Timestamp, 0).Format(time.RFC3339))
 		fmt.Printf("PrevHash:	%x\n", block.PrevHash)
 		fmt.Printf("Hash:	%x\n", block.Hash)
-		fmt.Printf("PoW:	%s\n", strconv.FormatBool(pow.Validate()))
+		if _, ok := chain.Consensus.(*BlockChain.ProofOfAuthority); ok && block.Height > 0 {
+			fmt.Printf("Signer:	%s\n", block.SignerAddress())
+			if block.Vote.Address != "" {
+				fmt.Printf("Vote:	%s %t\n", block.Vote.Address, block.Vote.Authorize)
+			}
+			fmt.Printf("Seal:	%s\n", strconv.FormatBool(chain.Consensus.Verify(block) == nil))
+		} else {
+			fmt.Printf("PoW:	%s\n", strconv.FormatBool(BlockChain.NewProof(block).Validate()))
+		}
 
 		for _, tx := range block.Transactions {
 			fmt.Println(tx)
@@ -61,14 +120,18 @@ func (cli *CommandLine) PrintChain() {
 	}
 }
 
-func (cli *CommandLine) CreateBlockChain(address string) {
+func (cli *CommandLine) CreateBlockChain(address string, consensus string, signers []string) {
 	if !Wallet.ValidateAddress(address) {
 		Handler.Handle(errors.New("address is not valid"))
 	}
 
-	chain := BlockChain.InitBlockChain(address)
-	chain.Database.Close()
-	UTOXSet := BlockChain.UTXOSet{chain}
+	config := BlockChain.ConsensusConfig{Engine: consensus, Signers: signers}
+	err := config.Validate()
+	Handler.Handle(err)
+
+	chain := BlockChain.InitBlockChainWithConsensus(address, cli.params(), config)
+	defer chain.Database.Close()
+	UTOXSet := BlockChain.UTXOSet{Chain: chain}
 	UTOXSet.Reindex()
 
 	fmt.Println("Finished!")
@@ -79,24 +142,22 @@ func (cli *CommandLine) GetBalance(address string) {
 		Handler.Handle(errors.New("address is not valid"))
 	}
 
-	chain := BlockChain.ContinueBlockChain(address)
+	chain := BlockChain.ContinueBlockChain(cli.params())
 	UTXOSet := BlockChain.UTXOSet{Chain: chain}
 	defer chain.Database.Close()
 
-	balance := 0
-	pubKeyHash := Wallet.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-Wallet.ChecksumLength]
-	UTXOs := UTXOSet.FindUnspentTransactions(pubKeyHash)
-
-	for _, out := range UTXOs {
-		balance += out.Value
-	}
+	_, pubKeyHash, err := Wallet.DecodeAddress(address)
+	Handler.Handle(err)
+	balance, immature := UTXOSet.FindBalance(pubKeyHash)
 
 	fmt.Printf(" Balance of %s: %d \n", address, balance)
+	if immature > 0 {
+		fmt.Printf(" Immature coinbase: %d, spendable after %d confirmations \n", immature, cli.params().CoinbaseMaturity)
+	}
 }
 
 func (cli *CommandLine) ReindexUTXO() {
-	chain := BlockChain.ContinueBlockChain("")
+	chain := BlockChain.ContinueBlockChain(cli.params())
 	defer chain.Database.Close()
 
 	UTXOSet := BlockChain.UTXOSet{Chain: chain}
@@ -110,23 +171,101 @@ func (cli *CommandLine) ListAddress() {
 	wallets, err := Wallet.CreateWallets()
 	Handler.Handle(err)
 
-	chain := BlockChain.ContinueBlockChain("")
+	chain := BlockChain.ContinueBlockChain(cli.params())
 	defer chain.Database.Close()
 	UTXOSet := BlockChain.UTXOSet{Chain: chain}
 	addresses := wallets.GetAllAddresses()
 
 	fmt.Println()
-	for address, wallet := range addresses {
+	for _, change := range []bool{false, true} {
+		label := "Wallet"
+		if change {
+			label = "Change"
+		}
 
-		pubKeyHash := Wallet.PublicKeyHash(wallet.PublicKey)
-		total, _ := UTXOSet.FindAllSpendableOutputs(pubKeyHash)
+		for address, wallet := range addresses {
+			if wallets.IsChange(address) != change {
+				continue
+			}
+
+			pubKeyHash := Wallet.PublicKeyHash(wallet.PublicKey)
+			total, _ := UTXOSet.FindAllSpendableOutputs(pubKeyHash)
+
+			fmt.Printf("%s 	address:		%s 			Value: 	%d\n 	Pulic Key Hash: 	%x\n 	Public Key: 		%x\n 	Private Key:		%x\n\n", label, address, total, Wallet.PublicKeyHash(wallet.PublicKey), wallet.PublicKey, wallet.PrivateKey)
+		}
+	}
+	for address, script := range wallets.GetAllScripts() {
+		_, scriptHash, err := Wallet.DecodeAddress(address)
+		Handler.Handle(err)
+		total, _ := UTXOSet.FindAllSpendableOutputs(scriptHash)
 
-		fmt.Printf("Wallet 	address:		%s 			Value: 	%d\n 	Pulic Key Hash: 	%x\n 	Public Key: 		%x\n 	Private Key:		%x\n\n", address, total, Wallet.PublicKeyHash(wallet.PublicKey), wallet.PublicKey, wallet.PrivateKey)
+		fmt.Printf("Script 	address:		%s 			Value: 	%d\n 	Redeem Script: 		%s\n\n", address, total, BlockChain.DisassembleScript(script))
 	}
+	cli.printWatchOnly(wallets, chain)
 	fmt.Println()
 }
 
-func (cli *CommandLine) Send(from, to string, amount int) {
+func (cli *CommandLine) CreateMultiSig(required int, keys []string) {
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	var pubKeys [][]byte
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+
+		if wallet, ok := wallets.Wallets[key]; ok {
+			pubKeys = append(pubKeys, wallet.PublicKey)
+			continue
+		}
+
+		pubKey, err := hex.DecodeString(key)
+		if err != nil {
+			Handler.Handle(fmt.Errorf("%s is neither a wallet address nor a hex public key", key))
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	redeemScript, err := BlockChain.NewMultiSigScript(required, pubKeys)
+	Handler.Handle(err)
+
+	address := wallets.AddScript(redeemScript)
+	wallets.SaveFile()
+
+	fmt.Printf("New multisig address is: %s\n", address)
+	fmt.Printf("Redeem script: %x\n", redeemScript)
+	fmt.Printf("Disassembled: %s\n", BlockChain.DisassembleScript(redeemScript))
+}
+
+func parseLockTime(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if lockTime, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return lockTime, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Unix(), nil
+		}
+	}
+
+	return 0, fmt.Errorf("lock time %s is neither a block height nor a date", value)
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
+
+func (cli *CommandLine) Send(from, to string, amount int, options BlockChain.TxOptions, mine bool) {
 	if !Wallet.ValidateAddress(from) {
 		Handler.Handle(errors.New("address is not valid"))
 	}
@@ -135,25 +274,55 @@ func (cli *CommandLine) Send(from, to string, amount int) {
 		Handler.Handle(errors.New("address is not valid"))
 	}
 
-	chain := BlockChain.ContinueBlockChain(from)
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	tx := BlockChain.NewTransactionWithOptions(wallets, from, to, amount, &UTXOSet, options)
+
+	cli.submit(chain, tx, mine)
+	fmt.Println("Success!")
+}
+
+func (cli *CommandLine) SendFromWallet(to string, amount int, options BlockChain.TxOptions, mine bool) {
+	if !Wallet.ValidateAddress(to) {
+		Handler.Handle(errors.New("address is not valid"))
+	}
+
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
 	UTXOSet := BlockChain.UTXOSet{Chain: chain}
 	defer chain.Database.Close()
 
-	tx := BlockChain.NewTransaction(from, to, amount, &UTXOSet)
+	output, err := BlockChain.NewPaymentOutput(to, amount, options)
+	Handler.Handle(err)
+
+	tx, sources, err := BlockChain.NewWalletTransaction(wallets, []BlockChain.TXOutput{*output}, &UTXOSet, options)
+	Handler.Handle(err)
 
-	//cbTx := BlockChain.CoinbaseTX("17C2p8mb5g12P17f5cCuxe4BU5GcrQ6djH", "")
-	var transactions []*BlockChain.Transaction
-	//transactions = append(transactions, cbTx)
-	transactions = append(transactions, tx)
-	block := chain.AddBlock(transactions)
-	UTXOSet.Update(block)
+	cli.submit(chain, tx, mine)
+
+	for _, source := range sources {
+		fmt.Printf("Drawn from: %s\n", source)
+	}
 	fmt.Println("Success!")
 }
 
-func (cli *CommandLine) CreateWallet() {
+func (cli *CommandLine) CreateWallet(hd bool) {
 	wallets, err := Wallet.CreateWallets()
 	Handler.Handle(err)
-	address := wallets.AddWallet()
+
+	var address string
+	if hd {
+		address = wallets.AddHDWallet()
+	} else {
+		address = wallets.AddWallet()
+	}
 	wallets.SaveFile()
 
 	fmt.Printf("New address is: %s\n", address)
@@ -169,12 +338,134 @@ func (cli *CommandLine) Run() {
 	createWalletCmd := flag.NewFlagSet("create-wallet", flag.ExitOnError)
 	listAddressCmd := flag.NewFlagSet("list-address", flag.ExitOnError)
 	reindexUTXOCmd := flag.NewFlagSet("reindex-utxo", flag.ExitOnError)
+	listUnspentCmd := flag.NewFlagSet("list-unspent", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("send-many", flag.ExitOnError)
+	printMempoolCmd := flag.NewFlagSet("print-mempool", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	poaSignersCmd := flag.NewFlagSet("poa-signers", flag.ExitOnError)
+	powBenchmarkCmd := flag.NewFlagSet("pow-benchmark", flag.ExitOnError)
+	checkpointsCmd := flag.NewFlagSet("checkpoints", flag.ExitOnError)
+	startNodeCmd := flag.NewFlagSet("start-node", flag.ExitOnError)
+	listPeersCmd := flag.NewFlagSet("list-peers", flag.ExitOnError)
+	workServerCmd := flag.NewFlagSet("work-server", flag.ExitOnError)
+	workMinerCmd := flag.NewFlagSet("work-miner", flag.ExitOnError)
+	poolStatsCmd := flag.NewFlagSet("pool-stats", flag.ExitOnError)
+	mineMempoolCmd := flag.NewFlagSet("mine-mempool", flag.ExitOnError)
+	estimateFeeCmd := flag.NewFlagSet("estimate-fee", flag.ExitOnError)
+	bumpFeeCmd := flag.NewFlagSet("bump-fee", flag.ExitOnError)
+	createMultiSigCmd := flag.NewFlagSet("create-multisig", flag.ExitOnError)
+	createTxCmd := flag.NewFlagSet("create-tx", flag.ExitOnError)
+	signTxCmd := flag.NewFlagSet("sign-tx", flag.ExitOnError)
+	inspectTxCmd := flag.NewFlagSet("inspect-tx", flag.ExitOnError)
+	broadcastTxCmd := flag.NewFlagSet("broadcast-tx", flag.ExitOnError)
+	combineCmd := flag.NewFlagSet("combine-and-broadcast", flag.ExitOnError)
+	htlcCreateCmd := flag.NewFlagSet("htlc-create", flag.ExitOnError)
+	htlcRedeemCmd := flag.NewFlagSet("htlc-redeem", flag.ExitOnError)
+	htlcRefundCmd := flag.NewFlagSet("htlc-refund", flag.ExitOnError)
+	htlcStatusCmd := flag.NewFlagSet("htlc-status", flag.ExitOnError)
+	importWatchCmd := flag.NewFlagSet("import-watch", flag.ExitOnError)
+	exportXPubCmd := flag.NewFlagSet("export-xpub", flag.ExitOnError)
+	exportKeyCmd := flag.NewFlagSet("export-key", flag.ExitOnError)
+	importKeyCmd := flag.NewFlagSet("import-key", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encrypt-wallet", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address wont to get balance")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address for create blockchain")
+	createBlockchainConsensus := createBlockchainCmd.String("consensus", BlockChain.ProofOfWorkEngine, "Consensus engine, pow or poa")
+	createBlockchainSigners := createBlockchainCmd.String("signers", "", "Comma separated addresses allowed to seal proof of authority blocks")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendLockTime := sendCmd.String("locktime", "", "Block height or date (YYYY-MM-DD or RFC3339) before which the payment cannot be spent")
+	sendRelativeLockTime := sendCmd.Int64("relative-locktime", 0, "Number of blocks the payment must be buried before it can be spent")
+	sendStrategy := sendCmd.String("strategy", BlockChain.DefaultCoinSelection, "Coin selection: largest-first, smallest-first, branch-and-bound or random-improve")
+	sendFromWallet := sendCmd.Bool("from-wallet", false, "Fund the payment from any address in the wallet")
+	sendCoins := sendCmd.String("coins", "", "Comma separated txid:index outputs to spend instead of selecting coins")
+	sendFee := sendCmd.Int("fee", 0, "Fee paid to the miner, estimated from recent blocks when omitted")
+	sendTarget := sendCmd.Int("target", BlockChain.DefaultConfirmationTarget, "Number of blocks the estimated fee should confirm within")
+	sendRBF := sendCmd.Bool("rbf", false, "Signal that the transaction can be replaced by one paying a higher fee")
+	sendMine := sendCmd.Bool("mine", true, "Mine a block right away instead of leaving the transaction in the mempool")
+	sendManyFrom := sendManyCmd.String("from", "", "Source wallet address")
+	sendManyFile := sendManyCmd.String("file", "", "CSV (address,amount) or JSON ([{\"address\", \"amount\"}]) payments file")
+	sendManyStrategy := sendManyCmd.String("strategy", BlockChain.DefaultCoinSelection, "Coin selection: largest-first, smallest-first, branch-and-bound or random-improve")
+	sendManyFee := sendManyCmd.Int("fee", 0, "Fee paid to the miner, estimated from recent blocks when omitted")
+	sendManyTarget := sendManyCmd.Int("target", BlockChain.DefaultConfirmationTarget, "Number of blocks the estimated fee should confirm within")
+	sendManyRBF := sendManyCmd.Bool("rbf", false, "Signal that the transaction can be replaced by one paying a higher fee")
+	sendManyMine := sendManyCmd.Bool("mine", true, "Mine a block right away instead of leaving the transaction in the mempool")
+	mineAddress := mineCmd.String("address", "", "Address the block reward and fees are paid to")
+	mineBlocks := mineCmd.Int("blocks", 1, "Number of blocks to mine, 0 mines until interrupted")
+	mineSigner := mineCmd.String("signer", "", "Wallet address that signs proof of authority blocks")
+	mineVoteAdd := mineCmd.String("vote-add", "", "Vote to authorize ADDRESS as a signer")
+	mineVoteRemove := mineCmd.String("vote-remove", "", "Vote to remove ADDRESS from the signers")
+	startNodeListen := startNodeCmd.String("listen", Network.DefaultAddress, "Address to accept peers on, empty to only connect out")
+	startNodePeers := startNodeCmd.String("peers", "", "Comma separated peer addresses to connect to")
+	startNodeMaxOutbound := startNodeCmd.Int("max-outbound", Network.MaxOutbound, "Number of peers to keep connections open to")
+	startNodeMaxInbound := startNodeCmd.Int("max-inbound", Network.MaxInbound, "Number of peers to accept connections from")
+	startNodeMine := startNodeCmd.String("mine", "", "Address to pay the rewards of blocks mined on the node to, no mining when empty")
+	startNodeMineInterval := startNodeCmd.Duration("mine-interval", 10*time.Second, "Time between blocks mined on the node")
+	powBenchmarkAlgorithm := powBenchmarkCmd.String("algorithm", "", "Algorithm to benchmark, all when empty")
+	powBenchmarkValidations := powBenchmarkCmd.Int("validations", 200, "Number of block validations to time per algorithm")
+	workServerAddress := workServerCmd.String("address", "", "Address the block reward and fees are paid to")
+	workServerListen := workServerCmd.String("listen", Stratum.DefaultAddress, "Address to accept miners on")
+	workServerShareDifficulty := workServerCmd.Int("share-difficulty", Stratum.DefaultShareDifficulty, "Leading zero bits a share needs, at most the block difficulty")
+	workServerPool := workServerCmd.Bool("pool", false, "Pay the reward to workers by their shares in the PPLNS window")
+	workServerPoolFee := workServerCmd.Float64("pool-fee", Stratum.DefaultPoolFee, "Percentage of each reward kept by -address")
+	workServerWindow := workServerCmd.Int("pplns-window", Stratum.DefaultPPLNSWindow, "Number of last shares rewards are split over")
+	poolStatsServer := poolStatsCmd.String("server", Stratum.DefaultAddress, "Pool work server to query")
+	workMinerServer := workMinerCmd.String("server", Stratum.DefaultAddress, "Work server to connect to")
+	workMinerWorker := workMinerCmd.String("worker", "", "Worker name shares are credited to")
+	mineMempoolAddress := mineMempoolCmd.String("address", "", "Address to pay the reward and fees to, a new wallet change address when omitted")
+	estimateFeeBlocks := estimateFeeCmd.Int("blocks", BlockChain.DefaultConfirmationTarget, "Number of blocks to confirm within")
+	bumpFeeTxID := bumpFeeCmd.String("txid", "", "Mempool transaction ID")
+	bumpFeeFee := bumpFeeCmd.Int("fee", 0, "New total fee for rbf, fee of the child for cpfp")
+	bumpFeeMethod := bumpFeeCmd.String("method", "rbf", "rbf replaces the transaction, cpfp spends its wallet output with a child")
+	bumpFeeMine := bumpFeeCmd.Bool("mine", true, "Mine a block right away instead of leaving the transaction in the mempool")
+	listUnspentAddress := listUnspentCmd.String("address", "", "Address to list, defaults to every wallet address")
+	multiSigRequired := createMultiSigCmd.Int("m", 0, "Number of signatures required")
+	multiSigKeys := createMultiSigCmd.String("keys", "", "Comma separated wallet addresses or hex public keys")
+	createTxFrom := createTxCmd.String("from", "", "Source wallet or multisig address")
+	createTxTo := createTxCmd.String("to", "", "Destination wallet address")
+	createTxAmount := createTxCmd.Int("amount", 0, "Amount to send")
+	createTxOut := createTxCmd.String("out", "", "File to write the unsigned transaction to")
+	signTxIn := signTxCmd.String("in", "", "Partially signed transaction file")
+	signTxAddress := signTxCmd.String("address", "", "Wallet address to sign with")
+	signTxOut := signTxCmd.String("out", "", "File to write the signed transaction to, defaults to -in")
+	inspectTxIn := inspectTxCmd.String("in", "", "Partially signed transaction file")
+	broadcastTxIn := broadcastTxCmd.String("in", "", "Signed transaction file")
+	broadcastTxCreated := broadcastTxCmd.String("created", "", "File written by create-tx to check the signed transaction against")
+	combineIn := combineCmd.String("in", "", "Comma separated partially signed transaction files")
+	htlcCreateFrom := htlcCreateCmd.String("from", "", "Source wallet address")
+	htlcCreateTo := htlcCreateCmd.String("to", "", "Address that can redeem with the preimage")
+	htlcCreateRefund := htlcCreateCmd.String("refund", "", "Address that can reclaim after the timeout, defaults to -from")
+	htlcCreateAmount := htlcCreateCmd.Int("amount", 0, "Amount to lock")
+	htlcCreateHash := htlcCreateCmd.String("hash", "", "Hex SHA-256 hash lock, a new preimage is generated when empty")
+	htlcCreateTimeout := htlcCreateCmd.String("timeout", "", "Block height or date after which the contract can be refunded")
+	htlcRedeemTxID := htlcRedeemCmd.String("txid", "", "Contract transaction ID")
+	htlcRedeemIndex := htlcRedeemCmd.Int("index", 0, "Contract output index")
+	htlcRedeemPreimage := htlcRedeemCmd.String("preimage", "", "Hex preimage of the hash lock")
+	htlcRedeemAddress := htlcRedeemCmd.String("address", "", "Recipient wallet address")
+	htlcRedeemTo := htlcRedeemCmd.String("to", "", "Address to pay the contract value to, defaults to -address")
+	htlcRedeemFee := htlcRedeemCmd.Int("fee", 0, "Fee paid to the miner, estimated from recent blocks when omitted")
+	htlcRedeemTarget := htlcRedeemCmd.Int("target", BlockChain.DefaultConfirmationTarget, "Number of blocks the estimated fee should confirm within")
+	htlcRefundTxID := htlcRefundCmd.String("txid", "", "Contract transaction ID")
+	htlcRefundIndex := htlcRefundCmd.Int("index", 0, "Contract output index")
+	htlcRefundAddress := htlcRefundCmd.String("address", "", "Refund wallet address")
+	htlcRefundTo := htlcRefundCmd.String("to", "", "Address to pay the contract value to, defaults to -address")
+	htlcRefundFee := htlcRefundCmd.Int("fee", 0, "Fee paid to the miner, estimated from recent blocks when omitted")
+	htlcRefundTarget := htlcRefundCmd.Int("target", BlockChain.DefaultConfirmationTarget, "Number of blocks the estimated fee should confirm within")
+	htlcStatusTxID := htlcStatusCmd.String("txid", "", "Contract transaction ID")
+	htlcStatusIndex := htlcStatusCmd.Int("index", 0, "Contract output index")
+	createWalletHD := createWalletCmd.Bool("hd", false, "Derive the wallet from the extended key")
+	importWatchAddress := importWatchCmd.String("address", "", "Address to watch")
+	importWatchPubKey := importWatchCmd.String("pubkey", "", "Hex public key to watch")
+	importWatchXPub := importWatchCmd.String("xpub", "", "Extended public key to derive watched addresses from")
+	importWatchGap := importWatchCmd.Int("gap", Wallet.DefaultGapLimit, "Number of unused addresses in a row after which -xpub derivation stops")
+	exportKeyAddress := exportKeyCmd.String("address", "", "Wallet address to export")
+	exportKeyFormat := exportKeyCmd.String("format", "wif", "Key format, wif or pem")
+	exportKeyOut := exportKeyCmd.String("out", "", "File to write the key to, printed when empty")
+	importKeyWIF := importKeyCmd.String("wif", "", "Private key in wallet import format")
+	importKeyPEM := importKeyCmd.String("pem", "", "File with a PKCS#8 PEM private key")
+	importKeyRescan := importKeyCmd.Bool("rescan", false, "Rescan the chain for outputs of the imported key")
 
 	switch os.Args[1] {
 	case "get-balance":
@@ -198,6 +489,96 @@ func (cli *CommandLine) Run() {
 	case "reindex-utxo":
 		err := reindexUTXOCmd.Parse(os.Args[2:])
 		Handler.Handle(err)
+	case "list-unspent":
+		err := listUnspentCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "send-many":
+		err := sendManyCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "print-mempool":
+		err := printMempoolCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "mine":
+		err := mineCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "poa-signers":
+		err := poaSignersCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "start-node":
+		err := startNodeCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "list-peers":
+		err := listPeersCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "checkpoints":
+		err := checkpointsCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "pow-benchmark":
+		err := powBenchmarkCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "work-server":
+		err := workServerCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "work-miner":
+		err := workMinerCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "pool-stats":
+		err := poolStatsCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "mine-mempool":
+		err := mineMempoolCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "estimate-fee":
+		err := estimateFeeCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "bump-fee":
+		err := bumpFeeCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "create-multisig":
+		err := createMultiSigCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "create-tx":
+		err := createTxCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "sign-tx":
+		err := signTxCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "inspect-tx":
+		err := inspectTxCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "broadcast-tx":
+		err := broadcastTxCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "combine-and-broadcast":
+		err := combineCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "htlc-create":
+		err := htlcCreateCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "htlc-redeem":
+		err := htlcRedeemCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "htlc-refund":
+		err := htlcRefundCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "htlc-status":
+		err := htlcStatusCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "import-watch":
+		err := importWatchCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "export-xpub":
+		err := exportXPubCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "export-key":
+		err := exportKeyCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "import-key":
+		err := importKeyCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
+	case "encrypt-wallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		Handler.Handle(err)
 	}
 
 	if getBalanceCmd.Parsed() {
@@ -211,21 +592,195 @@ func (cli *CommandLine) Run() {
 			getBalanceCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.CreateBlockChain(*createBlockchainAddress)
+		cli.CreateBlockChain(*createBlockchainAddress, *createBlockchainConsensus, parseSigners(*createBlockchainSigners))
 	} else if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount == 0 {
-			getBalanceCmd.Usage()
+		if (*sendFrom == "") == !*sendFromWallet || *sendTo == "" || *sendAmount == 0 {
+			sendCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.Send(*sendFrom, *sendTo, *sendAmount)
+		lockTime, err := parseLockTime(*sendLockTime)
+		Handler.Handle(err)
+		coins, err := parseOutPoints(*sendCoins)
+		Handler.Handle(err)
+		options := BlockChain.TxOptions{
+			LockTime:         lockTime,
+			RelativeLockTime: *sendRelativeLockTime,
+			CoinSelection:    *sendStrategy,
+			Coins:            coins,
+			Fee:              *sendFee,
+			Replaceable:      *sendRBF,
+		}
+		if !isFlagSet(sendCmd, "fee") {
+			options.FeeTarget = *sendTarget
+		}
+		if *sendFromWallet {
+			cli.SendFromWallet(*sendTo, *sendAmount, options, *sendMine)
+		} else {
+			cli.Send(*sendFrom, *sendTo, *sendAmount, options, *sendMine)
+		}
 	} else if printChainCmd.Parsed() {
 		cli.PrintChain()
 	} else if createWalletCmd.Parsed() {
-		cli.CreateWallet()
+		cli.CreateWallet(*createWalletHD)
 	} else if listAddressCmd.Parsed() {
 		cli.ListAddress()
 	} else if reindexUTXOCmd.Parsed() {
 		cli.ReindexUTXO()
+	} else if sendManyCmd.Parsed() {
+		if *sendManyFrom == "" || *sendManyFile == "" {
+			sendManyCmd.Usage()
+			runtime.Goexit()
+		}
+		options := BlockChain.TxOptions{CoinSelection: *sendManyStrategy, Fee: *sendManyFee, Replaceable: *sendManyRBF}
+		if !isFlagSet(sendManyCmd, "fee") {
+			options.FeeTarget = *sendManyTarget
+		}
+		cli.SendMany(*sendManyFrom, *sendManyFile, options, *sendManyMine)
+	} else if printMempoolCmd.Parsed() {
+		cli.PrintMempool()
+	} else if mineCmd.Parsed() {
+		if *mineAddress == "" || *mineBlocks < 0 {
+			mineCmd.Usage()
+			runtime.Goexit()
+		}
+		vote, err := parseVote(*mineVoteAdd, *mineVoteRemove)
+		Handler.Handle(err)
+		cli.Mine(*mineAddress, *mineBlocks, *mineSigner, vote)
+	} else if poaSignersCmd.Parsed() {
+		cli.PoASigners()
+	} else if startNodeCmd.Parsed() {
+		if *startNodeMaxOutbound < 0 || *startNodeMaxInbound < 0 || *startNodeMineInterval <= 0 {
+			startNodeCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.StartNode(*startNodeListen, parsePeers(*startNodePeers), *startNodeMaxOutbound, *startNodeMaxInbound, *startNodeMine, *startNodeMineInterval)
+	} else if listPeersCmd.Parsed() {
+		cli.ListPeers()
+	} else if checkpointsCmd.Parsed() {
+		cli.Checkpoints()
+	} else if powBenchmarkCmd.Parsed() {
+		cli.PowBenchmark(*powBenchmarkAlgorithm, *powBenchmarkValidations)
+	} else if workServerCmd.Parsed() {
+		if *workServerAddress == "" {
+			workServerCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.WorkServer(*workServerAddress, *workServerListen, *workServerShareDifficulty, *workServerPool, *workServerPoolFee, *workServerWindow)
+	} else if workMinerCmd.Parsed() {
+		if *workMinerWorker == "" {
+			workMinerCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.WorkMiner(*workMinerServer, *workMinerWorker)
+	} else if poolStatsCmd.Parsed() {
+		cli.PoolStats(*poolStatsServer)
+	} else if mineMempoolCmd.Parsed() {
+		cli.MineMempool(*mineMempoolAddress)
+	} else if estimateFeeCmd.Parsed() {
+		cli.EstimateFee(*estimateFeeBlocks)
+	} else if bumpFeeCmd.Parsed() {
+		if *bumpFeeTxID == "" || *bumpFeeFee <= 0 {
+			bumpFeeCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.BumpFee(*bumpFeeTxID, *bumpFeeFee, *bumpFeeMethod, *bumpFeeMine)
+	} else if listUnspentCmd.Parsed() {
+		cli.ListUnspent(*listUnspentAddress)
+	} else if createMultiSigCmd.Parsed() {
+		if *multiSigRequired == 0 || *multiSigKeys == "" {
+			createMultiSigCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.CreateMultiSig(*multiSigRequired, strings.Split(*multiSigKeys, ","))
+	} else if createTxCmd.Parsed() {
+		if *createTxFrom == "" || *createTxTo == "" || *createTxAmount == 0 || *createTxOut == "" {
+			createTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.CreateTransaction(*createTxFrom, *createTxTo, *createTxAmount, *createTxOut)
+	} else if signTxCmd.Parsed() {
+		if *signTxIn == "" || *signTxAddress == "" {
+			signTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.SignTransaction(*signTxIn, *signTxAddress, *signTxOut)
+	} else if inspectTxCmd.Parsed() {
+		if *inspectTxIn == "" {
+			inspectTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.InspectTransaction(*inspectTxIn)
+	} else if broadcastTxCmd.Parsed() {
+		if *broadcastTxIn == "" {
+			broadcastTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.BroadcastTransaction(*broadcastTxIn, *broadcastTxCreated)
+	} else if combineCmd.Parsed() {
+		if *combineIn == "" {
+			combineCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.CombineAndBroadcast(strings.Split(*combineIn, ","))
+	} else if htlcCreateCmd.Parsed() {
+		if *htlcCreateFrom == "" || *htlcCreateTo == "" || *htlcCreateAmount == 0 || *htlcCreateTimeout == "" {
+			htlcCreateCmd.Usage()
+			runtime.Goexit()
+		}
+		if *htlcCreateRefund == "" {
+			*htlcCreateRefund = *htlcCreateFrom
+		}
+		timeout, err := parseLockTime(*htlcCreateTimeout)
+		Handler.Handle(err)
+		cli.CreateHTLC(*htlcCreateFrom, *htlcCreateTo, *htlcCreateRefund, *htlcCreateAmount, *htlcCreateHash, timeout)
+	} else if htlcRedeemCmd.Parsed() {
+		if *htlcRedeemTxID == "" || *htlcRedeemPreimage == "" || *htlcRedeemAddress == "" {
+			htlcRedeemCmd.Usage()
+			runtime.Goexit()
+		}
+		options := BlockChain.TxOptions{Fee: *htlcRedeemFee}
+		if !isFlagSet(htlcRedeemCmd, "fee") {
+			options.FeeTarget = *htlcRedeemTarget
+		}
+		cli.RedeemHTLC(*htlcRedeemTxID, *htlcRedeemIndex, *htlcRedeemPreimage, *htlcRedeemAddress, *htlcRedeemTo, options)
+	} else if htlcRefundCmd.Parsed() {
+		if *htlcRefundTxID == "" || *htlcRefundAddress == "" {
+			htlcRefundCmd.Usage()
+			runtime.Goexit()
+		}
+		options := BlockChain.TxOptions{Fee: *htlcRefundFee}
+		if !isFlagSet(htlcRefundCmd, "fee") {
+			options.FeeTarget = *htlcRefundTarget
+		}
+		cli.RefundHTLC(*htlcRefundTxID, *htlcRefundIndex, *htlcRefundAddress, *htlcRefundTo, options)
+	} else if htlcStatusCmd.Parsed() {
+		if *htlcStatusTxID == "" {
+			htlcStatusCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.HTLCStatus(*htlcStatusTxID, *htlcStatusIndex)
+	} else if importWatchCmd.Parsed() {
+		if *importWatchAddress == "" && *importWatchPubKey == "" && *importWatchXPub == "" {
+			importWatchCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.ImportWatch(*importWatchAddress, *importWatchPubKey, *importWatchXPub, *importWatchGap)
+	} else if exportXPubCmd.Parsed() {
+		cli.ExportXPub()
+	} else if exportKeyCmd.Parsed() {
+		if *exportKeyAddress == "" {
+			exportKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.ExportKey(*exportKeyAddress, *exportKeyFormat, *exportKeyOut)
+	} else if importKeyCmd.Parsed() {
+		if *importKeyWIF == "" && *importKeyPEM == "" {
+			importKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.ImportKey(*importKeyWIF, *importKeyPEM, *importKeyRescan)
+	} else if encryptWalletCmd.Parsed() {
+		cli.EncryptWallet()
 	} else {
 		cli.PrintUsage()
 	}
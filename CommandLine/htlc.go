@@ -0,0 +1,144 @@
+package CommandLine
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+)
+
+func (cli *CommandLine) CreateHTLC(from, to, refund string, amount int, hashHex string, timeout int64) {
+	for _, address := range []string{from, to, refund} {
+		if !Wallet.ValidateAddress(address) {
+			Handler.Handle(errors.New("address is not valid"))
+		}
+	}
+
+	var preimage []byte
+	var hash []byte
+	var err error
+
+	if hashHex == "" {
+		preimage = make([]byte, BlockChain.PreimageLength)
+		_, err = rand.Read(preimage)
+		Handler.Handle(err)
+		digest := sha256.Sum256(preimage)
+		hash = digest[:]
+	} else {
+		hash, err = hex.DecodeString(hashHex)
+		Handler.Handle(err)
+	}
+
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	tx := BlockChain.NewHTLCTransaction(wallets, from, to, refund, amount, hash, timeout, &UTXOSet)
+	cli.submit(chain, tx, true)
+
+	fmt.Printf("Contract:	%x:0\n", tx.ID)
+	fmt.Printf("Hash:		%x\n", hash)
+	if preimage != nil {
+		fmt.Printf("Preimage:	%x (keep it secret until you redeem the counter contract)\n", preimage)
+	}
+	fmt.Printf("Refundable after:	%d\n", timeout)
+	fmt.Println("Success!")
+}
+
+func (cli *CommandLine) RedeemHTLC(txid string, index int, preimageHex, address, to string, options BlockChain.TxOptions) {
+	txID, err := hex.DecodeString(txid)
+	Handler.Handle(err)
+	preimage, err := hex.DecodeString(preimageHex)
+	Handler.Handle(err)
+
+	w := cli.walletFor(address)
+	if to == "" {
+		to = address
+	}
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	tx, err := BlockChain.NewHTLCRedeemTransaction(txID, index, preimage, w, to, &UTXOSet, options)
+	Handler.Handle(err)
+
+	cli.submit(chain, tx, true)
+	fmt.Printf("Contract redeemed by %x\n", tx.ID)
+	fmt.Println("Success!")
+}
+
+func (cli *CommandLine) RefundHTLC(txid string, index int, address, to string, options BlockChain.TxOptions) {
+	txID, err := hex.DecodeString(txid)
+	Handler.Handle(err)
+
+	w := cli.walletFor(address)
+	if to == "" {
+		to = address
+	}
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	tx, err := BlockChain.NewHTLCRefundTransaction(txID, index, w, to, &UTXOSet, options)
+	Handler.Handle(err)
+
+	cli.submit(chain, tx, true)
+	fmt.Printf("Contract refunded by %x\n", tx.ID)
+	fmt.Println("Success!")
+}
+
+func (cli *CommandLine) HTLCStatus(txid string, index int) {
+	txID, err := hex.DecodeString(txid)
+	Handler.Handle(err)
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	tx, err := chain.FindTransaction(txID)
+	Handler.Handle(err)
+	if index < 0 || index >= len(tx.Outputs) {
+		Handler.Handle(fmt.Errorf("transaction has no output %d", index))
+	}
+
+	htlc, err := BlockChain.ExtractHTLC(tx.Outputs[index].ScriptPubKey)
+	Handler.Handle(err)
+
+	fmt.Printf("Value:		%d\n", tx.Outputs[index].Value)
+	fmt.Printf("Hash:		%x\n", htlc.Hash)
+	fmt.Printf("Recipient:	%s\n", Wallet.EncodeAddress(Wallet.Version, htlc.RecipientHash))
+	fmt.Printf("Refund:		%s\n", Wallet.EncodeAddress(Wallet.Version, htlc.RefundHash))
+	fmt.Printf("Timeout:	%d\n", htlc.Timeout)
+
+	if outs, ok := UTXOSet.GetOutputs(txID); ok {
+		if _, unspent := outs.Outputs[index]; unspent {
+			fmt.Println("Status:		open")
+			return
+		}
+	}
+
+	preimage, err := chain.FindHTLCPreimage(txID, index)
+	if err != nil {
+		fmt.Printf("Status:		%s\n", err)
+		return
+	}
+
+	fmt.Println("Status:		redeemed")
+	fmt.Printf("Preimage:	%x\n", preimage)
+}
+
+func (cli *CommandLine) walletFor(address string) Wallet.Wallet {
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	return wallets.GetWallet(address)
+}
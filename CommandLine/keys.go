@@ -0,0 +1,121 @@
+package CommandLine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"io/ioutil"
+	"os"
+)
+
+// ExportKey refuses to export from a locked wallet, an encrypted wallet does
+// not load without its passphrase.
+func (cli *CommandLine) ExportKey(address, format, out string) {
+	w := cli.walletFor(address)
+
+	var content []byte
+	switch format {
+	case "wif":
+		content = []byte(w.WIF() + "\n")
+	case "pem":
+		pemKey, err := w.PEM()
+		Handler.Handle(err)
+		content = pemKey
+	default:
+		Handler.Handle(fmt.Errorf("unknown key format %s, use wif or pem", format))
+	}
+
+	if out == "" {
+		fmt.Print(string(content))
+		return
+	}
+
+	err := ioutil.WriteFile(out, content, 0600)
+	Handler.Handle(err)
+	fmt.Printf("Key of %s written to %s\n", address, out)
+}
+
+func (cli *CommandLine) ImportKey(wif, pemFile string, rescan bool) {
+	var w *Wallet.Wallet
+	var err error
+
+	switch {
+	case wif != "":
+		w, err = Wallet.DecodeWIF(wif)
+	case pemFile != "":
+		content, readErr := ioutil.ReadFile(pemFile)
+		Handler.Handle(readErr)
+		w, err = Wallet.DecodePEM(content)
+	default:
+		err = errors.New("one of -wif or -pem is required")
+	}
+	Handler.Handle(err)
+
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	address, err := wallets.ImportWallet(w)
+	Handler.Handle(err)
+	wallets.SaveFile()
+
+	fmt.Printf("Imported address: %s\n", address)
+
+	if rescan {
+		cli.rescan(address)
+	}
+}
+
+// EncryptWallet takes the passphrase from the environment and never from the
+// arguments, they end up in the shell history. A plain wallet is encrypted
+// with the passphrase it will be unlocked with, an encrypted one is unlocked
+// with PassphraseEnv and gets the passphrase of NewPassphraseEnv.
+func (cli *CommandLine) EncryptWallet() {
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	changed := wallets.Encrypted()
+	passphrase := os.Getenv(Wallet.NewPassphraseEnv)
+	if passphrase == "" && !changed {
+		passphrase = os.Getenv(Wallet.PassphraseEnv)
+	}
+	if passphrase == "" {
+		Handler.Handle(fmt.Errorf("set %s to the new passphrase of the wallet", Wallet.NewPassphraseEnv))
+	}
+
+	err = wallets.Encrypt(passphrase)
+	Handler.Handle(err)
+	wallets.SaveFile()
+
+	if changed {
+		fmt.Println("Wallet passphrase changed")
+	} else {
+		fmt.Println("Wallet encrypted")
+	}
+	fmt.Printf("Set %s to the passphrase to use the wallet\n", Wallet.PassphraseEnv)
+}
+
+func (cli *CommandLine) rescan(address string) {
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	UTXOSet.Reindex()
+
+	_, pubKeyHash, err := Wallet.DecodeAddress(address)
+	Handler.Handle(err)
+
+	history := chain.FindHistory(pubKeyHash)
+	for _, entry := range history {
+		fmt.Printf("Found:	%x	height %d	+%d -%d\n", entry.TxID, entry.Height, entry.Received, entry.Sent)
+	}
+
+	total, outputs := UTXOSet.FindAllSpendableOutputs(pubKeyHash)
+	count := 0
+	for _, outs := range outputs {
+		count += len(outs)
+	}
+
+	fmt.Printf("Rescan found %d transactions, %d unspent outputs worth %d\n", len(history), count, total)
+}
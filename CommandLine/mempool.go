@@ -0,0 +1,154 @@
+package CommandLine
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"sort"
+	"time"
+)
+
+func (cli *CommandLine) submit(chain *BlockChain.Chain, tx *BlockChain.Transaction, mine bool) {
+	mempool := BlockChain.Mempool{Chain: chain}
+
+	err := mempool.Add(tx)
+	Handler.Handle(err)
+
+	entry, _ := mempool.Get(tx.ID)
+	fmt.Printf("Transaction %x added to the mempool with fee %d\n", tx.ID, entry.Fee)
+
+	if mine {
+		cli.mineMempool(chain, cli.rewardAddress())
+	}
+}
+
+func (cli *CommandLine) mineMempool(chain *BlockChain.Chain, address string) {
+	err := cli.useSigner(chain, "", BlockChain.Vote{})
+	Handler.Handle(err)
+
+	block, err := BlockChain.Miner{Chain: chain, RewardAddress: address}.MineBlock(nil)
+	Handler.Handle(err)
+
+	fmt.Printf("\nMined block %x with %d transactions, reward %d to %s\n",
+		block.Hash, len(block.Transactions), block.Transactions[0].OutputValue(), address)
+}
+
+// rewardAddress pays the blocks mined along with a transaction to a new change
+// address of the wallet so the fees do not go to waste.
+func (cli *CommandLine) rewardAddress() string {
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	address := wallets.AddChangeWallet()
+	wallets.SaveFile()
+
+	return address
+}
+
+func (cli *CommandLine) MineMempool(address string) {
+	if address == "" {
+		address = cli.rewardAddress()
+	}
+	if !Wallet.ValidateAddress(address) {
+		Handler.Handle(errors.New("address is not valid"))
+	}
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	defer chain.Database.Close()
+
+	cli.mineMempool(chain, address)
+}
+
+func (cli *CommandLine) PrintMempool() {
+	var ids []string
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	defer chain.Database.Close()
+
+	entries := BlockChain.Mempool{Chain: chain}.Entries()
+	for txID := range entries {
+		ids = append(ids, txID)
+	}
+	sort.Strings(ids)
+
+	fmt.Printf("%d transactions in the mempool\n", len(entries))
+	for _, txID := range ids {
+		entry := entries[txID]
+		fmt.Printf("%s	fee %d	size %d	rate %.4f	replaceable %t	since %s\n",
+			txID, entry.Fee, entry.Size, entry.FeeRate(), entry.Tx.SignalsReplacement(), time.Unix(entry.Time, 0).Format(time.RFC3339))
+	}
+}
+
+func (cli *CommandLine) EstimateFee(blocks int) {
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	defer chain.Database.Close()
+
+	mempool := BlockChain.Mempool{Chain: chain}
+
+	rate, err := mempool.EstimateFeeRate(blocks)
+	Handler.Handle(err)
+
+	fmt.Printf("Estimated fee rate for confirmation within %d blocks: %.6f per byte\n", blocks, rate)
+	fmt.Printf("Based on %d confirmed and %d pending transactions\n", len(mempool.FeeRecords()), len(mempool.Entries()))
+}
+
+func (cli *CommandLine) BumpFee(txid string, fee int, method string, mine bool) {
+	txID, err := hex.DecodeString(txid)
+	Handler.Handle(err)
+
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	entry, ok := BlockChain.Mempool{Chain: chain}.Get(txID)
+	if !ok {
+		Handler.Handle(errors.New("transaction is not in the mempool"))
+	}
+
+	var tx *BlockChain.Transaction
+	switch method {
+	case "rbf":
+		tx, err = BlockChain.NewReplacement(wallets, entry, fee, &UTXOSet)
+		if err == nil {
+			fmt.Printf("Replacing %x, fee %d -> %d\n", entry.Tx.ID, entry.Fee, fee)
+		}
+	case "cpfp":
+		tx, err = cli.childPaysForParent(wallets, &UTXOSet, entry, fee)
+	default:
+		err = fmt.Errorf("unknown fee bump method %s, use rbf or cpfp", method)
+	}
+	Handler.Handle(err)
+
+	cli.submit(chain, tx, mine)
+	fmt.Println("Success!")
+}
+
+func (cli *CommandLine) childPaysForParent(wallets *Wallet.Wallets, UTXO *BlockChain.UTXOSet, entry BlockChain.MempoolEntry, fee int) (*BlockChain.Transaction, error) {
+	for outIdx, out := range entry.Tx.Outputs {
+		address := BlockChain.ScriptAddress(out.ScriptPubKey)
+		if _, ok := wallets.Wallets[address]; !ok || out.Value <= fee {
+			continue
+		}
+
+		options := BlockChain.TxOptions{
+			Coins: []BlockChain.OutPoint{{TxID: entry.Tx.ID, Index: outIdx}},
+			Fee:   fee,
+		}
+		tx, _, err := BlockChain.NewWalletTransaction(wallets, nil, UTXO, options)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Child %x spends %x:%d with fee %d\n", tx.ID, entry.Tx.ID, outIdx, fee)
+
+		return tx, nil
+	}
+
+	return nil, errors.New("transaction has no wallet output large enough to pay the fee")
+}
@@ -0,0 +1,56 @@
+package CommandLine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"os"
+	"os/signal"
+)
+
+func (cli *CommandLine) Mine(address string, blocks int, signer string, vote BlockChain.Vote) {
+	if !Wallet.ValidateAddress(address) {
+		Handler.Handle(errors.New("address is not valid"))
+	}
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	defer chain.Database.Close()
+
+	quit := interrupted()
+	miner := BlockChain.Miner{Chain: chain, RewardAddress: address}
+	mined := 0
+
+	for blocks == 0 || mined < blocks {
+		err := cli.useSigner(chain, signer, vote)
+		Handler.Handle(err)
+
+		block, err := miner.MineBlock(quit)
+		if err == BlockChain.ErrMiningInterrupted {
+			fmt.Println("Mining interrupted")
+			break
+		}
+		Handler.Handle(err)
+
+		mined++
+		fmt.Printf("Mined block %d %x with %d transactions, reward %d\n",
+			block.Height, block.Hash, len(block.Transactions), block.Transactions[0].OutputValue())
+	}
+
+	fmt.Printf("Mined %d blocks\n", mined)
+}
+
+func interrupted() <-chan struct{} {
+	quit := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		close(quit)
+	}()
+
+	return quit
+}
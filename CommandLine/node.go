@@ -0,0 +1,144 @@
+package CommandLine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Network"
+	"github.com/koushamad/blockchain/Wallet"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func parsePeers(value string) []string {
+	var peers []string
+
+	for _, peer := range strings.Split(value, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers
+}
+
+func addressBookPath(params *BlockChain.Params) string {
+	return filepath.Join(filepath.Dir(params.DBPath), "peers.data")
+}
+
+func (cli *CommandLine) StartNode(listen string, peers []string, maxOutbound, maxInbound int, mineAddress string, mineInterval time.Duration) {
+	if mineAddress != "" && !Wallet.ValidateAddress(mineAddress) {
+		Handler.Handle(errors.New("mine address is not valid"))
+	}
+
+	var chain *BlockChain.Chain
+	params := cli.params()
+
+	if BlockChain.DBExists(params) {
+		chain = BlockChain.ContinueBlockChain(params)
+	} else {
+		chain = joinNetwork(params, append(append([]string{}, peers...), params.Seeds...))
+	}
+	defer chain.Database.Close()
+
+	book, err := Network.LoadAddressBook(addressBookPath(params))
+	Handler.Handle(err)
+
+	node := Network.NewNode(chain, listen, book)
+	node.MaxOutbound = maxOutbound
+	node.MaxInbound = maxInbound
+
+	quit := interrupted()
+	if mineAddress != "" {
+		go cli.mineOnNode(node, mineAddress, mineInterval, quit)
+	}
+
+	err = node.Run(peers, quit)
+	Handler.Handle(err)
+}
+
+// mineOnNode mines a block every interval while the node is synced, the node
+// announces each one to its peers as a compact block.
+func (cli *CommandLine) mineOnNode(node *Network.Node, address string, interval time.Duration, quit <-chan struct{}) {
+	miner := BlockChain.Miner{Chain: node.Chain, RewardAddress: address}
+	prepare := func() error {
+		return cli.useSigner(node.Chain, "", BlockChain.Vote{})
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			block, err := node.Mine(miner, prepare)
+			if err == Network.ErrNotSynced {
+				continue
+			}
+			if err != nil {
+				fmt.Printf("Could not mine a block: %s\n", err)
+				continue
+			}
+
+			fmt.Printf("Mined block %d %x with %d transactions\n", block.Height, block.Hash, len(block.Transactions))
+		}
+	}
+}
+
+// joinNetwork creates the chain of a new node from the genesis block of the
+// first peer or seed that answers.
+func joinNetwork(params *BlockChain.Params, sources []string) *BlockChain.Chain {
+	if len(sources) == 0 {
+		Handler.Handle(fmt.Errorf("a new node needs -peers or %s to fetch the genesis block from", BlockChain.SeedsEnv))
+	}
+
+	for _, source := range sources {
+		genesis, config, err := Network.FetchGenesis(source)
+		if err != nil {
+			fmt.Printf("Could not fetch the genesis block from %s: %s\n", source, err)
+			continue
+		}
+
+		chain, err := BlockChain.InitBlockChainFromGenesis(genesis, params, config)
+		Handler.Handle(err)
+
+		UTXOSet := BlockChain.UTXOSet{Chain: chain}
+		UTXOSet.Reindex()
+
+		fmt.Printf("Joined %s with genesis block %x from %s\n", params.Name, genesis.Hash, source)
+
+		return chain
+	}
+
+	Handler.Handle(errors.New("no peer answered with a genesis block"))
+
+	return nil
+}
+
+func (cli *CommandLine) ListPeers() {
+	book, err := Network.LoadAddressBook(addressBookPath(cli.params()))
+	Handler.Handle(err)
+
+	known := book.List()
+	if len(known) == 0 {
+		fmt.Println("No known peers")
+	}
+
+	for _, address := range known {
+		lastSuccess := "never"
+		if !address.LastSuccess.IsZero() {
+			lastSuccess = address.LastSuccess.Format(time.RFC3339)
+		}
+
+		fmt.Printf("%s	source %s	last seen %s	last connected %s	failed attempts %d\n",
+			address.Address, address.Source, address.LastSeen.Format(time.RFC3339), lastSuccess, address.Attempts)
+	}
+
+	for host, until := range book.BanList() {
+		fmt.Printf("banned	%s	until %s\n", host, until.Format(time.RFC3339))
+	}
+}
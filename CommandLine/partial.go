@@ -0,0 +1,92 @@
+package CommandLine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+)
+
+func (cli *CommandLine) CreateTransaction(from, to string, amount int, out string) {
+	if !Wallet.ValidateAddress(from) || !Wallet.ValidateAddress(to) {
+		Handler.Handle(errors.New("address is not valid"))
+	}
+
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	tx := BlockChain.NewUnsignedTransaction(wallets, from, to, amount, &UTXOSet, BlockChain.TxOptions{})
+	ptx := BlockChain.NewPartialTransaction(tx, &UTXOSet, wallets.GetAllScripts())
+	ptx.SaveFile(out)
+
+	fmt.Printf("Unsigned transaction %x written to %s\n", ptx.Tx.ID, out)
+}
+
+func (cli *CommandLine) SignTransaction(in, address, out string) {
+	w := cli.walletFor(address)
+
+	ptx := BlockChain.LoadPartialTransaction(in)
+	signed := ptx.Sign(w)
+	if signed == 0 {
+		Handler.Handle(errors.New("address is not a signer of any input"))
+	}
+
+	if out == "" {
+		out = in
+	}
+	ptx.SaveFile(out)
+
+	fmt.Println(ptx)
+	fmt.Printf("Signed %d input(s), written to %s\n", signed, out)
+}
+
+func (cli *CommandLine) InspectTransaction(in string) {
+	ptx := BlockChain.LoadPartialTransaction(in)
+
+	fmt.Println(ptx)
+	if err := ptx.Validate(); err != nil {
+		fmt.Printf("		Invalid:	%s\n", err)
+	}
+}
+
+func (cli *CommandLine) BroadcastTransaction(in, created string) {
+	ptx := BlockChain.LoadPartialTransaction(in)
+
+	if created != "" {
+		err := ptx.Matches(BlockChain.LoadPartialTransaction(created))
+		Handler.Handle(err)
+	}
+
+	cli.broadcastPartial(ptx)
+}
+
+func (cli *CommandLine) CombineAndBroadcast(files []string) {
+	ptx := BlockChain.LoadPartialTransaction(files[0])
+	for _, file := range files[1:] {
+		err := ptx.Combine(BlockChain.LoadPartialTransaction(file))
+		Handler.Handle(err)
+	}
+
+	cli.broadcastPartial(ptx)
+}
+
+func (cli *CommandLine) broadcastPartial(ptx *BlockChain.PartialTransaction) {
+	tx, err := ptx.Finalize()
+	Handler.Handle(err)
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	err = ptx.CheckPrevOutputs(&UTXOSet)
+	Handler.Handle(err)
+
+	cli.submit(chain, tx, true)
+	fmt.Printf("Transaction %x broadcast\n", tx.ID)
+	fmt.Println("Success!")
+}
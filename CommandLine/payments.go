@@ -0,0 +1,105 @@
+package CommandLine
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type paymentEntry struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+func loadPayments(path string) ([]BlockChain.Payment, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		return parseJSONPayments(content)
+	}
+
+	return parseCSVPayments(content)
+}
+
+func parseJSONPayments(content []byte) ([]BlockChain.Payment, error) {
+	var entries []paymentEntry
+	var payments []BlockChain.Payment
+
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		payments = append(payments, BlockChain.Payment{Address: entry.Address, Amount: entry.Amount})
+	}
+
+	return payments, nil
+}
+
+func parseCSVPayments(content []byte) ([]BlockChain.Payment, error) {
+	var payments []BlockChain.Payment
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for line, record := range records {
+		amount, err := strconv.Atoi(record[1])
+		if err != nil {
+			if line == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d has an invalid amount %s", line+1, record[1])
+		}
+
+		payments = append(payments, BlockChain.Payment{Address: record[0], Amount: amount})
+	}
+
+	return payments, nil
+}
+
+func (cli *CommandLine) SendMany(from, file string, options BlockChain.TxOptions, mine bool) {
+	if !Wallet.ValidateAddress(from) {
+		Handler.Handle(errors.New("address is not valid"))
+	}
+
+	payments, err := loadPayments(file)
+	Handler.Handle(err)
+
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+	defer chain.Database.Close()
+
+	tx, err := BlockChain.NewPaymentTransaction(wallets, from, payments, &UTXOSet, options)
+	Handler.Handle(err)
+
+	total := 0
+	for _, payment := range payments {
+		total += payment.Amount
+	}
+
+	cli.submit(chain, tx, mine)
+
+	fmt.Printf("Transaction %x pays %d to %d recipients\n", tx.ID, total, len(payments))
+	fmt.Println("Success!")
+}
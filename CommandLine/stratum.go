@@ -0,0 +1,63 @@
+package CommandLine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Stratum"
+	"github.com/koushamad/blockchain/Wallet"
+	"sort"
+)
+
+func (cli *CommandLine) WorkServer(address, listen string, shareDifficulty int, pool bool, poolFee float64, window int) {
+	if !Wallet.ValidateAddress(address) {
+		Handler.Handle(errors.New("address is not valid"))
+	}
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	defer chain.Database.Close()
+
+	server := Stratum.NewServer(BlockChain.Miner{Chain: chain, RewardAddress: address}, shareDifficulty)
+	if pool {
+		var err error
+		server.Pool, err = Stratum.NewPool(chain, address, poolFee, window)
+		Handler.Handle(err)
+		fmt.Printf("Pool mode, %.2f%% fee, PPLNS window of %d shares\n", poolFee, window)
+	}
+
+	err := server.ListenAndServe(listen, interrupted())
+	Handler.Handle(err)
+
+	var workers []string
+	for worker := range server.Shares {
+		workers = append(workers, worker)
+	}
+	sort.Strings(workers)
+
+	fmt.Println("Accepted shares:")
+	for _, worker := range workers {
+		fmt.Printf("%s	%d\n", worker, server.Shares[worker])
+	}
+}
+
+func (cli *CommandLine) WorkMiner(server, worker string) {
+	client, err := Stratum.Dial(server, worker)
+	Handler.Handle(err)
+	defer client.Close()
+
+	err = client.Mine(interrupted())
+	Handler.Handle(err)
+
+	fmt.Println("Miner stopped")
+}
+
+func (cli *CommandLine) PoolStats(server string) {
+	stats, err := Stratum.QueryPoolStats(server)
+	Handler.Handle(err)
+
+	fmt.Println("Address	Shares	Hashrate	Pending	Paid")
+	for _, worker := range stats {
+		fmt.Printf("%s	%d	%.0f H/s	%d	%d\n", worker.Address, worker.Shares, worker.HashRate, worker.Pending, worker.Paid)
+	}
+}
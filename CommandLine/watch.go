@@ -0,0 +1,107 @@
+package CommandLine
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"time"
+)
+
+func (cli *CommandLine) ImportWatch(address, pubKeyHex, xpub string, gap int) {
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	var addresses []string
+
+	switch {
+	case address != "":
+		imported, err := wallets.AddWatchAddress(address)
+		Handler.Handle(err)
+		addresses = append(addresses, imported)
+	case pubKeyHex != "":
+		pubKey, err := hex.DecodeString(pubKeyHex)
+		Handler.Handle(err)
+		imported, err := wallets.AddWatchPublicKey(pubKey)
+		Handler.Handle(err)
+		addresses = append(addresses, imported)
+	case xpub != "":
+		used := cli.usedAddresses()
+		addresses, err = wallets.AddWatchExtendedKey(xpub, gap, func(address string) bool {
+			return used[address]
+		})
+		Handler.Handle(err)
+	default:
+		Handler.Handle(errors.New("one of -address, -pubkey or -xpub is required"))
+	}
+
+	wallets.SaveFile()
+
+	for _, imported := range addresses {
+		fmt.Printf("Watching address: %s\n", imported)
+	}
+}
+
+// usedAddresses collects every address an output of the chain pays to, none
+// are used before the chain is created.
+func (cli *CommandLine) usedAddresses() map[string]bool {
+	used := make(map[string]bool)
+	if !BlockChain.DBExists(cli.params()) {
+		return used
+	}
+
+	chain := BlockChain.ContinueBlockChain(cli.params())
+	defer chain.Database.Close()
+
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Outputs {
+				used[BlockChain.ScriptAddress(out.ScriptPubKey)] = true
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return used
+}
+
+func (cli *CommandLine) ExportXPub() {
+	wallets, err := Wallet.CreateWallets()
+	Handler.Handle(err)
+
+	account := wallets.Account()
+	wallets.SaveFile()
+
+	fmt.Printf("Extended public key: %s\n", account.Neuter())
+}
+
+func (cli *CommandLine) printWatchOnly(wallets *Wallet.Wallets, chain *BlockChain.Chain) {
+	UTXOSet := BlockChain.UTXOSet{Chain: chain}
+
+	for address, watch := range wallets.GetAllWatchOnly() {
+		_, pubKeyHash, err := Wallet.DecodeAddress(address)
+		Handler.Handle(err)
+		total, _ := UTXOSet.FindAllSpendableOutputs(pubKeyHash)
+
+		fmt.Printf("Watch 	address:		%s 			Value: 	%d\n", address, total)
+		if watch.PublicKey != nil {
+			fmt.Printf(" 	Public Key: 		%x\n", watch.PublicKey)
+		}
+		if watch.ExtendedKey != "" {
+			fmt.Printf(" 	Extended Key:		%s/%d/%d\n", watch.ExtendedKey, Wallet.ExternalChain, watch.Index)
+		}
+
+		for _, entry := range chain.FindHistory(pubKeyHash) {
+			fmt.Printf(" 	History:		%x	height %d	%s	+%d -%d\n", entry.TxID, entry.Height, time.Unix(entry.Timestamp, 0).Format(time.RFC3339), entry.Received, entry.Sent)
+		}
+		fmt.Println()
+	}
+}
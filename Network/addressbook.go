@@ -0,0 +1,312 @@
+package Network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type KnownAddress struct {
+	Address     string
+	Source      string
+	LastSeen    time.Time
+	LastAttempt time.Time
+	LastSuccess time.Time
+	Attempts    int
+}
+
+// AddressBook remembers the addresses peers can be reached at and the hosts
+// that are banned, it is saved next to the block database between runs.
+type AddressBook struct {
+	Addresses map[string]*KnownAddress
+	Bans      map[string]time.Time
+
+	path   string
+	mutex  sync.Mutex
+	random *rand.Rand
+	dirty  bool
+}
+
+func NewAddressBook(path string) *AddressBook {
+	return &AddressBook{
+		Addresses: make(map[string]*KnownAddress),
+		Bans:      make(map[string]time.Time),
+		path:      path,
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func LoadAddressBook(path string) (*AddressBook, error) {
+	book := NewAddressBook(path)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return book, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved AddressBook
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&saved); err != nil {
+		return nil, err
+	}
+
+	if saved.Addresses != nil {
+		book.Addresses = saved.Addresses
+	}
+	if saved.Bans != nil {
+		book.Bans = saved.Bans
+	}
+
+	return book, nil
+}
+
+func (ab *AddressBook) Save() error {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(ab); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(ab.path, content.Bytes(), 0644); err != nil {
+		return err
+	}
+	ab.dirty = false
+
+	return nil
+}
+
+func (ab *AddressBook) Dirty() bool {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	return ab.dirty
+}
+
+// Add records an address a peer told us about and reports whether it was new,
+// a full book makes room by forgetting the address that was seen last longest
+// ago.
+func (ab *AddressBook) Add(address, source string) bool {
+	if !ValidAddress(address) {
+		return false
+	}
+
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	if known, ok := ab.Addresses[address]; ok {
+		known.LastSeen = time.Now()
+		ab.dirty = true
+		return false
+	}
+
+	if len(ab.Addresses) >= MaxKnownAddresses {
+		var oldest *KnownAddress
+		for _, known := range ab.Addresses {
+			if oldest == nil || known.LastSeen.Before(oldest.LastSeen) {
+				oldest = known
+			}
+		}
+		delete(ab.Addresses, oldest.Address)
+	}
+
+	ab.Addresses[address] = &KnownAddress{Address: address, Source: source, LastSeen: time.Now()}
+	ab.dirty = true
+
+	return true
+}
+
+func (ab *AddressBook) Remove(address string) {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	if _, ok := ab.Addresses[address]; ok {
+		delete(ab.Addresses, address)
+		ab.dirty = true
+	}
+}
+
+func (ab *AddressBook) Attempt(address string) {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	if known, ok := ab.Addresses[address]; ok {
+		known.LastAttempt = time.Now()
+		known.Attempts++
+		ab.dirty = true
+	}
+}
+
+// Failed forgets an address after too many connection attempts in a row
+// failed.
+func (ab *AddressBook) Failed(address string) {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	if known, ok := ab.Addresses[address]; ok && known.Attempts >= MaxAttempts {
+		delete(ab.Addresses, address)
+		ab.dirty = true
+	}
+}
+
+func (ab *AddressBook) Good(address string) {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	if known, ok := ab.Addresses[address]; ok {
+		known.LastSeen = time.Now()
+		known.LastSuccess = known.LastSeen
+		known.Attempts = 0
+		ab.dirty = true
+	}
+}
+
+// Pick returns a random address to connect to that is not banned, not
+// skipped and not waiting out the back off after failed attempts, addresses
+// that were connected to before are preferred.
+func (ab *AddressBook) Pick(skip func(address string) bool) (string, bool) {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	var tried, fresh []string
+	for address, known := range ab.Addresses {
+		if skip(address) || ab.banned(hostOf(address)) {
+			continue
+		}
+
+		backOff := RetryInterval << uint(minInt(known.Attempts, 6))
+		if known.Attempts > 0 && time.Since(known.LastAttempt) < backOff {
+			continue
+		}
+
+		if known.LastSuccess.IsZero() {
+			fresh = append(fresh, address)
+		} else {
+			tried = append(tried, address)
+		}
+	}
+
+	if len(tried) > 0 && (len(fresh) == 0 || ab.random.Intn(2) == 0) {
+		return tried[ab.random.Intn(len(tried))], true
+	}
+	if len(fresh) > 0 {
+		return fresh[ab.random.Intn(len(fresh))], true
+	}
+
+	return "", false
+}
+
+// Sample returns up to count random addresses of hosts that are not banned.
+func (ab *AddressBook) Sample(count int) []string {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	var addresses []string
+	for address := range ab.Addresses {
+		if !ab.banned(hostOf(address)) {
+			addresses = append(addresses, address)
+		}
+	}
+
+	ab.random.Shuffle(len(addresses), func(i, j int) {
+		addresses[i], addresses[j] = addresses[j], addresses[i]
+	})
+	if len(addresses) > count {
+		addresses = addresses[:count]
+	}
+
+	return addresses
+}
+
+func (ab *AddressBook) List() []KnownAddress {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	var list []KnownAddress
+	for _, known := range ab.Addresses {
+		list = append(list, *known)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+
+	return list
+}
+
+func (ab *AddressBook) Ban(host string, duration time.Duration) {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	ab.Bans[host] = time.Now().Add(duration)
+	ab.dirty = true
+}
+
+func (ab *AddressBook) Banned(host string) bool {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	return ab.banned(host)
+}
+
+// BanList returns the hosts that are still banned with the end of their ban.
+func (ab *AddressBook) BanList() map[string]time.Time {
+	ab.mutex.Lock()
+	defer ab.mutex.Unlock()
+
+	bans := make(map[string]time.Time)
+	for host := range ab.Bans {
+		if ab.banned(host) {
+			bans[host] = ab.Bans[host]
+		}
+	}
+
+	return bans
+}
+
+func (ab *AddressBook) banned(host string) bool {
+	until, ok := ab.Bans[host]
+	if ok && time.Now().After(until) {
+		delete(ab.Bans, host)
+		ab.dirty = true
+		return false
+	}
+
+	return ok
+}
+
+func ValidAddress(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return false
+	}
+
+	number, err := strconv.Atoi(port)
+
+	return err == nil && number > 0 && number < 1<<16
+}
+
+func hostOf(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+
+	return host
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,217 @@
+package Network
+
+import (
+	"github.com/koushamad/blockchain/Wallet"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddressBook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.dat")
+	book := NewAddressBook(path)
+
+	if book.Add("localhost", "test") || book.Add("localhost:0", "test") {
+		t.Error("added an address without a valid port")
+	}
+	if !book.Add("10.0.0.1:4000", "test") || book.Add("10.0.0.1:4000", "test") {
+		t.Error("address was not added exactly once")
+	}
+	book.Add("10.0.0.2:4000", "test")
+
+	for i := 0; i < MaxAttempts; i++ {
+		book.Attempt("10.0.0.2:4000")
+	}
+	if address, _ := book.Pick(func(string) bool { return false }); address != "10.0.0.1:4000" {
+		t.Errorf("picked %q, want the address that does not back off", address)
+	}
+	book.Failed("10.0.0.2:4000")
+	if len(book.List()) != 1 {
+		t.Errorf("address was kept after %d failed attempts", MaxAttempts)
+	}
+	if _, ok := book.Pick(func(address string) bool { return address == "10.0.0.1:4000" }); ok {
+		t.Error("picked a skipped address")
+	}
+
+	book.Ban("10.0.0.1", time.Hour)
+	if _, ok := book.Pick(func(string) bool { return false }); ok || len(book.Sample(10)) != 0 {
+		t.Error("banned host is still picked or shared")
+	}
+
+	if err := book.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadAddressBook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.List()) != 1 || !loaded.Banned("10.0.0.1") {
+		t.Errorf("loaded %v with bans %v", loaded.List(), loaded.BanList())
+	}
+
+	loaded.Ban("10.0.0.1", -time.Second)
+	if loaded.Banned("10.0.0.1") || len(loaded.BanList()) != 0 {
+		t.Error("ban did not expire")
+	}
+}
+
+// handshake dials a node and completes the version handshake by hand, so the
+// test can send it whatever it likes.
+func handshake(t *testing.T, n *Node) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", n.ListenAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	n.mutex.Lock()
+	version := n.version()
+	n.mutex.Unlock()
+	version.Nonce = randomNonce()
+	version.ListenAddress = ""
+
+	if err := writeMessage(conn, Message{CommandVersion, encode(version)}); err != nil {
+		t.Fatal(err)
+	}
+	if message, err := readMessage(conn); err != nil || message.Command != CommandVersion {
+		t.Fatalf("got %v %v, want the version of the node", message.Command, err)
+	}
+
+	return conn
+}
+
+func TestAddressGossip(t *testing.T) {
+	alice := Wallet.MakeWallet()
+	chain := newTestChain(t, string(alice.Address()))
+	hub := startNode(t, chain)
+	listener := startNode(t, forkChain(t, chain))
+	joiner := startNode(t, forkChain(t, chain))
+	relayed := handshake(t, hub)
+
+	if err := listener.Connect(hub.ListenAddress); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, hub, "the hub to learn the listen address of its inbound peer", func() bool {
+		_, ok := hub.Book.Addresses[listener.ListenAddress]
+		return ok
+	})
+
+	relayed.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		message, err := readMessage(relayed)
+		if err != nil {
+			t.Fatalf("new address was not relayed: %s", err)
+		}
+		var addr Addr
+		if message.Command == CommandAddr && decode(message.Payload, &addr) == nil &&
+			len(addr.Addresses) == 1 && addr.Addresses[0] == listener.ListenAddress {
+			break
+		}
+	}
+
+	if err := joiner.Connect(hub.ListenAddress); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, joiner, "getaddr to return the address of the other peer", func() bool {
+		_, ok := joiner.Book.Addresses[listener.ListenAddress]
+		return ok
+	})
+	if _, ok := joiner.Book.Addresses[joiner.ListenAddress]; ok {
+		t.Error("node added its own address")
+	}
+}
+
+func TestFillOutbound(t *testing.T) {
+	alice := Wallet.MakeWallet()
+	chain := newTestChain(t, string(alice.Address()))
+	n := startNode(t, chain)
+	first := startNode(t, forkChain(t, chain))
+	second := startNode(t, forkChain(t, chain))
+
+	n.MaxOutbound = 1
+	n.Book.Add(n.ListenAddress, "test")
+	n.Book.Add(first.ListenAddress, "test")
+	n.Book.Add(second.ListenAddress, "test")
+
+	outbound := func(count int) func() bool {
+		return func() bool {
+			handshaked := 0
+			for peer := range n.peers {
+				if !peer.Inbound && peer.handshaked() {
+					handshaked++
+				}
+			}
+			return handshaked == count && len(n.dialing) == 0
+		}
+	}
+
+	n.fillOutbound()
+	waitFor(t, n, "one outbound peer", outbound(1))
+	n.fillOutbound()
+	waitFor(t, n, "the full slots to stay at one peer", outbound(1))
+
+	n.MaxOutbound = 3
+	n.fillOutbound()
+	waitFor(t, n, "both other nodes as outbound peers", outbound(2))
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for peer := range n.peers {
+		if peer.entry == n.ListenAddress {
+			t.Error("node dialed its own listen address")
+		}
+	}
+}
+
+func TestBanScore(t *testing.T) {
+	alice := Wallet.MakeWallet()
+	n := startNode(t, newTestChain(t, string(alice.Address())))
+	conn := handshake(t, n)
+
+	excessive := encode(Addr{make([]string, MaxAddresses+1)})
+	for i := 1; i < BanScore/ExcessiveScore; i++ {
+		if err := writeMessage(conn, Message{CommandAddr, excessive}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, n, "the misbehavior to be scored", func() bool {
+		for peer := range n.peers {
+			if peer.score == BanScore-ExcessiveScore {
+				return true
+			}
+		}
+		return false
+	})
+	if n.Book.Banned("127.0.0.1") {
+		t.Fatal("host was banned below the ban score")
+	}
+
+	if err := writeMessage(conn, Message{CommandAddr, excessive}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, err := readMessage(conn); err != nil {
+			break
+		}
+	}
+	if !n.Book.Banned("127.0.0.1") {
+		t.Fatal("host was not banned at the ban score")
+	}
+
+	banned, err := net.Dial("tcp", n.ListenAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer banned.Close()
+	banned.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := banned.Read(make([]byte, 1)); err == nil {
+		t.Error("banned host was not disconnected")
+	}
+
+	n.Book.Ban("127.0.0.1", -time.Second)
+	handshake(t, n)
+}
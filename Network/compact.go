@@ -0,0 +1,301 @@
+package Network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"time"
+)
+
+var errShortIDCollision = errors.New("a short ID matches several mempool transactions")
+
+type partialBlock struct {
+	header       BlockChain.Header
+	transactions []*BlockChain.Transaction
+	prefilled    int
+	missing      []int
+	peer         *Peer
+}
+
+// compactStats counts how compact blocks were turned back into blocks, from
+// the mempool alone, after asking the peer for the missing transactions or
+// not at all when the full block had to be downloaded.
+type compactStats struct {
+	received      int
+	reconstructed int
+	completed     int
+	failed        int
+	mempoolTxs    int
+	requestedTxs  int
+}
+
+func randomNonce() uint64 {
+	var nonce uint64
+	err := binary.Read(rand.Reader, binary.BigEndian, &nonce)
+	Handler.Handle(err)
+
+	return nonce
+}
+
+// shortID is salted with the block hash and a nonce chosen by the sender, so
+// transactions that collide in one block will not collide in the next.
+func shortID(hash []byte, nonce uint64, txID []byte) uint64 {
+	salt := make([]byte, 8)
+	binary.BigEndian.PutUint64(salt, nonce)
+	sum := sha256.Sum256(bytes.Join([][]byte{hash, salt, txID}, []byte{}))
+
+	id := uint64(0)
+	for _, b := range sum[:ShortIDBytes] {
+		id = id<<8 | uint64(b)
+	}
+
+	return id
+}
+
+func newCompactBlock(block *BlockChain.Block, nonce uint64) CompactBlock {
+	compact := CompactBlock{Header: block.Header(), Nonce: nonce}
+
+	for i, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			compact.Prefilled = append(compact.Prefilled, PrefilledTx{i, tx})
+			continue
+		}
+		compact.ShortIDs = append(compact.ShortIDs, shortID(block.Hash, nonce, tx.ID))
+	}
+
+	return compact
+}
+
+// announce sends a new tip as a compact block to the peers that are not known
+// to have it yet.
+func (n *Node) announce(block *BlockChain.Block, from *Peer) {
+	compact := newCompactBlock(block, randomNonce())
+
+	for peer := range n.peers {
+		if peer == from || !peer.handshaked() || peer.Version.Height >= block.Height {
+			continue
+		}
+
+		peer.Send(CommandCmpctBlock, compact)
+		peer.Version.Height = block.Height
+	}
+}
+
+func (n *Node) handleCompactBlock(peer *Peer, payload []byte) error {
+	var message CompactBlock
+	if err := decode(payload, &message); err != nil {
+		return err
+	}
+
+	header := message.Header
+	if known, ok := n.tree[hex.EncodeToString(header.Hash)]; ok && known.invalid {
+		return misbehaving(InvalidScore, "compact block %d is on an invalid chain", header.Height)
+	}
+	if _, ok := n.heights[hex.EncodeToString(header.Hash)]; ok {
+		return nil
+	}
+
+	if header.Height > peer.Version.Height {
+		peer.Version.Height = header.Height
+	}
+
+	tip := n.bestHeight()
+	if header.Height != tip+1 || !bytes.Equal(header.PrevHash, n.hashes[tip]) {
+		if header.Height > tip && n.connected == tip {
+			n.requestHeaders(peer)
+		}
+		return nil
+	}
+
+	if err := n.Chain.CheckHeader(header, n.bestTip().header); err != nil {
+		return misbehaving(InvalidScore, "invalid compact block header %d: %s", header.Height, err)
+	}
+	n.extend(n.addHeader(header))
+
+	if n.connected != tip {
+		n.schedule()
+		return nil
+	}
+	n.stats.received++
+
+	partial, err := n.reconstruct(peer, message)
+	if err == errShortIDCollision {
+		n.stats.failed++
+		fmt.Printf("Compact block %d from %s: %s, fetching the full block\n", header.Height, peer.Address, err)
+		n.schedule()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(partial.missing) == 0 {
+		if n.completeBlock(partial) {
+			n.stats.reconstructed++
+		}
+		return nil
+	}
+
+	n.partial[hex.EncodeToString(header.Hash)] = partial
+	n.requests[header.Height] = request{peer, time.Now()}
+	peer.inFlight++
+	n.stats.requestedTxs += len(partial.missing)
+
+	return peer.Send(CommandGetBlockTxn, GetBlockTxn{header.Hash, partial.missing})
+}
+
+// reconstruct fills in the transactions of a compact block from the prefilled
+// ones and the mempool, the indexes of the ones that were not found are left
+// for a getblocktxn.
+func (n *Node) reconstruct(peer *Peer, message CompactBlock) (*partialBlock, error) {
+	count := len(message.ShortIDs) + len(message.Prefilled)
+	if count == 0 || count > n.Chain.Params.MaxBlockTransactions {
+		return nil, misbehaving(MalformedScore, "compact block with %d transactions", count)
+	}
+
+	transactions := make([]*BlockChain.Transaction, count)
+	for _, prefilled := range message.Prefilled {
+		if prefilled.Index < 0 || prefilled.Index >= count || prefilled.Tx == nil || transactions[prefilled.Index] != nil {
+			return nil, misbehaving(MalformedScore, "compact block has an invalid prefilled transaction")
+		}
+		transactions[prefilled.Index] = prefilled.Tx
+	}
+
+	mempool := make(map[uint64]*BlockChain.Transaction)
+	collisions := make(map[uint64]bool)
+	for _, entry := range (BlockChain.Mempool{Chain: n.Chain}).Entries() {
+		tx := entry.Tx
+		id := shortID(message.Header.Hash, message.Nonce, tx.ID)
+		if _, ok := mempool[id]; ok {
+			collisions[id] = true
+		}
+		mempool[id] = &tx
+	}
+
+	partial := &partialBlock{header: message.Header, transactions: transactions, prefilled: len(message.Prefilled), peer: peer}
+	next := 0
+	for i := range transactions {
+		if transactions[i] != nil {
+			continue
+		}
+
+		id := message.ShortIDs[next]
+		next++
+
+		if collisions[id] {
+			return nil, errShortIDCollision
+		}
+		if tx, ok := mempool[id]; ok {
+			transactions[i] = tx
+			n.stats.mempoolTxs++
+			continue
+		}
+		partial.missing = append(partial.missing, i)
+	}
+
+	return partial, nil
+}
+
+// completeBlock checks the filled in transactions against the header before
+// the block is connected, a mismatch means a short ID matched the wrong
+// transaction and the full block is downloaded instead.
+func (n *Node) completeBlock(partial *partialBlock) bool {
+	block := partial.header.Block(partial.transactions)
+
+	if !n.matchesHeader(block) {
+		n.stats.failed++
+		fmt.Printf("Compact block %d from %s does not match its header, fetching the full block\n", block.Height, partial.peer.Address)
+		n.schedule()
+		return false
+	}
+
+	expected := len(block.Transactions) - partial.prefilled
+	fmt.Printf("Block %d from %s rebuilt from a compact block, %d of %d transactions were in the mempool\n",
+		block.Height, partial.peer.Address, expected-len(partial.missing), expected)
+
+	n.blocks[block.Height] = download{block, partial.peer}
+	n.connectBlocks()
+	n.schedule()
+
+	return true
+}
+
+func (n *Node) handleGetBlockTxn(peer *Peer, payload []byte) error {
+	var request GetBlockTxn
+	if err := decode(payload, &request); err != nil {
+		return err
+	}
+
+	height, ok := n.heights[hex.EncodeToString(request.Hash)]
+	if !ok || height > n.connected {
+		return peer.Send(CommandNotFound, NotFound{[][]byte{request.Hash}})
+	}
+
+	block, err := n.Chain.GetBlock(request.Hash)
+	if err != nil {
+		return err
+	}
+
+	var transactions []*BlockChain.Transaction
+	for _, index := range request.Indexes {
+		if index < 0 || index >= len(block.Transactions) {
+			return misbehaving(MalformedScore, "getblocktxn index %d is out of range", index)
+		}
+		transactions = append(transactions, block.Transactions[index])
+	}
+
+	return peer.Send(CommandBlockTxn, BlockTxn{request.Hash, transactions})
+}
+
+func (n *Node) handleBlockTxn(peer *Peer, payload []byte) error {
+	var message BlockTxn
+	if err := decode(payload, &message); err != nil {
+		return err
+	}
+
+	key := hex.EncodeToString(message.Hash)
+	partial, ok := n.partial[key]
+	if !ok || partial.peer != peer {
+		return nil
+	}
+	delete(n.partial, key)
+	n.finishRequest(partial.header.Height)
+
+	if len(message.Transactions) != len(partial.missing) {
+		n.stats.failed++
+		n.schedule()
+		return misbehaving(MalformedScore, "sent %d of %d missing transactions", len(message.Transactions), len(partial.missing))
+	}
+
+	for i, index := range partial.missing {
+		if message.Transactions[i] == nil {
+			n.stats.failed++
+			n.schedule()
+			return misbehaving(MalformedScore, "sent an empty transaction")
+		}
+		partial.transactions[index] = message.Transactions[i]
+	}
+
+	if n.completeBlock(partial) {
+		n.stats.completed++
+	}
+
+	return nil
+}
+
+func (n *Node) reportCompactStats() {
+	stats := n.stats
+	if stats.received == 0 {
+		return
+	}
+
+	fmt.Printf("Compact blocks: %d received, %d rebuilt from the mempool (%.1f%%), %d after requesting %d transactions, %d downloaded in full, %d transactions found in the mempool\n",
+		stats.received, stats.reconstructed, 100*float64(stats.reconstructed)/float64(stats.received),
+		stats.completed, stats.requestedTxs, stats.failed, stats.mempoolTxs)
+}
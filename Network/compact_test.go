@@ -0,0 +1,103 @@
+package Network
+
+import (
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Wallet"
+	"testing"
+)
+
+func newTestChain(t *testing.T, address string) *BlockChain.Chain {
+	t.Helper()
+
+	params := BlockChain.TestNetParams
+	params.DBPath = t.TempDir()
+	params.CoinbaseMaturity = 0
+
+	chain := BlockChain.InitBlockChain(address, &params)
+	t.Cleanup(func() { chain.Database.Close() })
+	BlockChain.UTXOSet{Chain: chain}.Reindex()
+
+	return chain
+}
+
+func payment(chain *BlockChain.Chain, from *Wallet.Wallet, amount int) *BlockChain.Transaction {
+	UTXO := BlockChain.UTXOSet{Chain: chain}
+	output := BlockChain.NewTXOutput(amount, string(from.Address()))
+	tx := BlockChain.FundTransaction(string(from.Address()), []BlockChain.TXOutput{*output}, &UTXO, BlockChain.TxOptions{Fee: 1})
+	chain.SignTransaction(tx, from.PrivateKey)
+
+	return tx
+}
+
+func TestShortID(t *testing.T) {
+	hash, txID := []byte("block"), []byte("transaction")
+
+	if shortID(hash, 1, txID) != shortID(hash, 1, txID) {
+		t.Error("short ID is not deterministic")
+	}
+	if shortID(hash, 1, txID) == shortID(hash, 2, txID) {
+		t.Error("short ID does not depend on the nonce")
+	}
+	if shortID(hash, 1, txID) == shortID([]byte("other"), 1, txID) {
+		t.Error("short ID does not depend on the block")
+	}
+	if id := shortID(hash, 1, txID); id>>(8*ShortIDBytes) != 0 {
+		t.Errorf("short ID %x is longer than %d bytes", id, ShortIDBytes)
+	}
+}
+
+func TestReconstructCompactBlock(t *testing.T) {
+	alice := Wallet.MakeWallet()
+	chain := newTestChain(t, string(alice.Address()))
+	n := NewNode(chain, "", nil)
+
+	known := payment(chain, alice, 5)
+	unknown := payment(chain, alice, 3)
+	if err := (BlockChain.Mempool{Chain: chain}).Add(known); err != nil {
+		t.Fatal(err)
+	}
+
+	coinbase := BlockChain.NewCoinbaseTX(string(alice.Address()), "", BlockChain.BlockSubsidy)
+	block := BlockChain.NewBlock([]*BlockChain.Transaction{coinbase, known, unknown}, chain.LastHash, 1)
+	block.Hash = block.SealHash()
+	compact := newCompactBlock(block, 7)
+
+	if len(compact.Prefilled) != 1 || compact.Prefilled[0].Index != 0 || len(compact.ShortIDs) != 2 {
+		t.Fatalf("compact block prefills %d and lists %d short IDs", len(compact.Prefilled), len(compact.ShortIDs))
+	}
+
+	partial, err := n.reconstruct(nil, compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partial.transactions[0] != coinbase || string(partial.transactions[1].ID) != string(known.ID) || partial.transactions[2] != nil {
+		t.Error("transactions were not filled in from the prefilled ones and the mempool")
+	}
+	if len(partial.missing) != 1 || partial.missing[0] != 2 {
+		t.Errorf("missing %v, want [2]", partial.missing)
+	}
+	if n.stats.mempoolTxs != 1 {
+		t.Errorf("%d transactions counted from the mempool", n.stats.mempoolTxs)
+	}
+
+	malformed := []struct {
+		name    string
+		compact CompactBlock
+	}{
+		{"no transactions", CompactBlock{Header: compact.Header}},
+		{"too many transactions", CompactBlock{Header: compact.Header, ShortIDs: make([]uint64, chain.Params.MaxBlockTransactions+1)}},
+		{"prefilled index out of range", CompactBlock{Header: compact.Header, Prefilled: []PrefilledTx{{1, coinbase}}}},
+		{"negative prefilled index", CompactBlock{Header: compact.Header, Prefilled: []PrefilledTx{{-1, coinbase}}, ShortIDs: []uint64{1}}},
+		{"empty prefilled transaction", CompactBlock{Header: compact.Header, Prefilled: []PrefilledTx{{0, nil}}}},
+		{"prefilled index twice", CompactBlock{Header: compact.Header, Prefilled: []PrefilledTx{{0, coinbase}, {0, coinbase}}}},
+	}
+
+	for _, test := range malformed {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := n.reconstruct(nil, test.compact)
+			if _, ok := err.(misbehavior); !ok {
+				t.Errorf("got error %v, want misbehavior", err)
+			}
+		})
+	}
+}
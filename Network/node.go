@@ -0,0 +1,743 @@
+package Network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotSynced = errors.New("node is still syncing")
+	errBanned    = errors.New("banned")
+)
+
+type Node struct {
+	Chain         *BlockChain.Chain
+	ListenAddress string
+	Book          *AddressBook
+	MaxOutbound   int
+	MaxInbound    int
+
+	mutex     sync.Mutex
+	listener  net.Listener
+	nonce     uint64
+	peers     map[*Peer]bool
+	dialing   map[string]bool
+	self      map[string]bool
+	hashes    [][]byte
+	heights   map[string]int
+	connected int
+	pending   *headerNode
+	tree      map[string]*headerNode
+	blocks    map[int]download
+	requests  map[int]request
+	stalled   map[int]*Peer
+	partial   map[string]*partialBlock
+	reported  progress
+	stats     compactStats
+
+	orphans    *orphanPool
+	txRequests map[string]time.Time
+	random     *rand.Rand
+}
+
+// NewNode indexes the best chain by height and its headers by hash, both grow
+// with the header chain during sync and blocks are connected up to
+// n.connected.
+func NewNode(chain *BlockChain.Chain, listenAddress string, book *AddressBook) *Node {
+	n := &Node{
+		Chain:         chain,
+		ListenAddress: listenAddress,
+		Book:          book,
+		MaxOutbound:   MaxOutbound,
+		MaxInbound:    MaxInbound,
+		peers:         make(map[*Peer]bool),
+		dialing:       make(map[string]bool),
+		self:          make(map[string]bool),
+		heights:       make(map[string]int),
+		tree:          make(map[string]*headerNode),
+		blocks:        make(map[int]download),
+		requests:      make(map[int]request),
+		stalled:       make(map[int]*Peer),
+		partial:       make(map[string]*partialBlock),
+		nonce:         randomNonce(),
+		orphans:       newOrphanPool(),
+		txRequests:    make(map[string]time.Time),
+		random:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	var headers []BlockChain.Header
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		headers = append(headers, block.Header())
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	for i := len(headers) - 1; i >= 0; i-- {
+		n.extend(n.addHeader(headers[i]))
+	}
+	n.connected = len(n.hashes) - 1
+	n.reported = progress{n.connected, n.connected}
+	chain.Headers = n
+
+	return n
+}
+
+// Run connects to the given addresses and keeps the outbound slots filled from
+// the address book, which starts out with the seeds of the network.
+func (n *Node) Run(addresses []string, quit <-chan struct{}) error {
+	for _, seed := range n.Chain.Params.Seeds {
+		n.Book.Add(seed, "seed")
+	}
+	for _, address := range addresses {
+		n.Book.Add(address, "config")
+	}
+
+	if n.ListenAddress != "" {
+		listener, err := net.Listen("tcp", n.ListenAddress)
+		if err != nil {
+			return err
+		}
+		n.listener = listener
+		fmt.Printf("Node listening on %s at height %d\n", listener.Addr(), n.connected)
+		go n.accept(listener)
+	}
+
+	for _, address := range addresses {
+		if err := n.Connect(address); err != nil {
+			fmt.Printf("Could not connect to %s: %s\n", address, err)
+		}
+	}
+	n.fillOutbound()
+
+	progressTicker := time.NewTicker(ProgressInterval)
+	defer progressTicker.Stop()
+	syncTicker := time.NewTicker(SyncInterval)
+	defer syncTicker.Stop()
+	connectTicker := time.NewTicker(ConnectInterval)
+	defer connectTicker.Stop()
+	saveTicker := time.NewTicker(SaveInterval)
+	defer saveTicker.Stop()
+	trickleTicker := time.NewTicker(TrickleTick)
+	defer trickleTicker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			n.shutdown()
+			n.saveBook()
+			n.reportCompactStats()
+			return nil
+		case <-progressTicker.C:
+			n.mutex.Lock()
+			n.checkStalls()
+			n.reportProgress()
+			n.expireTxRequests()
+			n.mutex.Unlock()
+		case <-trickleTicker.C:
+			n.mutex.Lock()
+			n.trickle()
+			n.mutex.Unlock()
+		case <-syncTicker.C:
+			n.mutex.Lock()
+			for peer := range n.peers {
+				if peer.handshaked() {
+					n.requestHeaders(peer)
+				}
+			}
+			n.mutex.Unlock()
+		case <-connectTicker.C:
+			n.fillOutbound()
+		case <-saveTicker.C:
+			n.saveBook()
+		}
+	}
+}
+
+func (n *Node) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		peer := newPeer(conn, true)
+		if n.Book.Banned(peer.host()) {
+			conn.Close()
+			continue
+		}
+		n.addPeer(peer)
+	}
+}
+
+func (n *Node) Connect(address string) error {
+	if n.Book.Banned(hostOf(address)) {
+		return errors.New("host is banned")
+	}
+
+	n.Book.Attempt(address)
+	conn, err := net.DialTimeout("tcp", address, DialTimeout)
+	if err != nil {
+		n.Book.Failed(address)
+		return err
+	}
+
+	peer := newPeer(conn, false)
+	peer.entry = address
+	if n.Book.Banned(peer.host()) {
+		conn.Close()
+		return errors.New("host is banned")
+	}
+	n.addPeer(peer)
+
+	return nil
+}
+
+// fillOutbound dials addresses from the book until the outbound slots are
+// taken, the dialing itself happens without holding the lock.
+func (n *Node) fillOutbound() {
+	var addresses []string
+
+	n.mutex.Lock()
+	for n.count(false)+len(n.dialing) < n.MaxOutbound {
+		address, ok := n.Book.Pick(n.skip)
+		if !ok {
+			break
+		}
+		n.dialing[address] = true
+		addresses = append(addresses, address)
+	}
+	n.mutex.Unlock()
+
+	for _, address := range addresses {
+		go func(address string) {
+			err := n.Connect(address)
+
+			n.mutex.Lock()
+			delete(n.dialing, address)
+			n.mutex.Unlock()
+
+			if err != nil {
+				fmt.Printf("Could not connect to %s: %s\n", address, err)
+			}
+		}(address)
+	}
+}
+
+func (n *Node) skip(address string) bool {
+	if address == n.ListenAddress || n.dialing[address] || n.self[address] {
+		return true
+	}
+
+	for peer := range n.peers {
+		if peer.entry == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *Node) count(inbound bool) int {
+	count := 0
+	for peer := range n.peers {
+		if peer.Inbound == inbound {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (n *Node) addPeer(peer *Peer) {
+	n.mutex.Lock()
+	if peer.Inbound && n.count(true) >= n.MaxInbound {
+		n.mutex.Unlock()
+		peer.Close()
+		return
+	}
+
+	n.peers[peer] = true
+	if !peer.Inbound {
+		peer.Send(CommandVersion, n.version())
+	}
+	n.mutex.Unlock()
+
+	go peer.write()
+	go n.serve(peer)
+}
+
+func (n *Node) serve(peer *Peer) {
+	for {
+		message, err := readMessage(peer.conn)
+		if _, malformed := err.(misbehavior); err != nil && !malformed {
+			break
+		}
+
+		if err == nil {
+			err = n.handle(peer, message)
+		} else {
+			n.mutex.Lock()
+			err = n.penalize(peer, err)
+			n.mutex.Unlock()
+		}
+
+		if err != nil {
+			if err != errBanned {
+				fmt.Printf("Disconnecting %s: %s\n", peer.Address, err)
+			}
+			break
+		}
+	}
+
+	n.removePeer(peer)
+}
+
+func (n *Node) removePeer(peer *Peer) {
+	peer.Close()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if !n.peers[peer] {
+		return
+	}
+	delete(n.peers, peer)
+
+	for height, req := range n.requests {
+		if req.peer == peer {
+			n.finishRequest(height)
+		}
+	}
+	for height, stalled := range n.stalled {
+		if stalled == peer {
+			delete(n.stalled, height)
+		}
+	}
+	for hash, partial := range n.partial {
+		if partial.peer == peer {
+			delete(n.partial, hash)
+		}
+	}
+
+	fmt.Printf("Peer %s disconnected\n", peer.Address)
+	n.schedule()
+}
+
+func (n *Node) shutdown() {
+	if n.listener != nil {
+		n.listener.Close()
+	}
+
+	n.mutex.Lock()
+	peers := n.peers
+	n.peers = make(map[*Peer]bool)
+	n.mutex.Unlock()
+
+	for peer := range peers {
+		peer.Close()
+	}
+}
+
+// Mine mines a block on the best chain once the node is synced and announces
+// it, prepare runs under the node lock before the block template is taken.
+func (n *Node) Mine(miner BlockChain.Miner, prepare func() error) (*BlockChain.Block, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.connected < n.bestHeight() {
+		return nil, ErrNotSynced
+	}
+
+	if prepare != nil {
+		if err := prepare(); err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := miner.MineBlock(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	n.extend(n.addHeader(block.Header()))
+	n.connected = block.Height
+	n.announce(block, nil)
+
+	return block, nil
+}
+
+func (n *Node) saveBook() {
+	if !n.Book.Dirty() {
+		return
+	}
+
+	if err := n.Book.Save(); err != nil {
+		fmt.Printf("Could not save the address book: %s\n", err)
+	}
+}
+
+// misbehave adds to the score of a peer and bans its host once the score
+// reaches BanScore, it reports whether the peer was banned.
+func (n *Node) misbehave(peer *Peer, score int, reason string) bool {
+	peer.score += score
+	if peer.score < BanScore {
+		fmt.Printf("Peer %s misbehaving, score %d: %s\n", peer.Address, peer.score, reason)
+		return false
+	}
+
+	fmt.Printf("Banning %s for %s: %s\n", peer.host(), BanDuration, reason)
+	n.Book.Ban(peer.host(), BanDuration)
+	if peer.entry != "" {
+		n.Book.Ban(hostOf(peer.entry), BanDuration)
+	}
+	peer.Close()
+
+	return true
+}
+
+func (n *Node) version() Version {
+	return Version{
+		Version:       ProtocolVersion,
+		Network:       n.Chain.Params.Name,
+		Genesis:       n.hashes[0],
+		Height:        n.connected,
+		BestHash:      n.hashes[n.connected],
+		ListenAddress: n.ListenAddress,
+		Nonce:         n.nonce,
+	}
+}
+
+func (n *Node) bestHeight() int {
+	return len(n.hashes) - 1
+}
+
+func (n *Node) handle(peer *Peer, message Message) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.penalize(peer, n.dispatch(peer, message))
+}
+
+// penalize turns a misbehavior into ban score, the connection is only dropped
+// for other errors or once the peer is banned.
+func (n *Node) penalize(peer *Peer, err error) error {
+	if m, ok := err.(misbehavior); ok {
+		if n.misbehave(peer, m.score, m.reason) {
+			return errBanned
+		}
+		return nil
+	}
+
+	return err
+}
+
+func (n *Node) dispatch(peer *Peer, message Message) error {
+	if !peer.handshaked() && message.Command != CommandVersion && message.Command != CommandGetGenesis {
+		return fmt.Errorf("%s before version", message.Command)
+	}
+
+	switch message.Command {
+	case CommandVersion:
+		return n.handleVersion(peer, message.Payload)
+	case CommandGetGenesis:
+		return n.handleGetGenesis(peer)
+	case CommandGetHeaders:
+		return n.handleGetHeaders(peer, message.Payload)
+	case CommandHeaders:
+		return n.handleHeaders(peer, message.Payload)
+	case CommandGetData:
+		return n.handleGetData(peer, message.Payload)
+	case CommandBlock:
+		return n.handleBlock(peer, message.Payload)
+	case CommandNotFound:
+		return n.handleNotFound(peer, message.Payload)
+	case CommandGetAddr:
+		return n.handleGetAddr(peer, message.Payload)
+	case CommandAddr:
+		return n.handleAddr(peer, message.Payload)
+	case CommandCmpctBlock:
+		return n.handleCompactBlock(peer, message.Payload)
+	case CommandGetBlockTxn:
+		return n.handleGetBlockTxn(peer, message.Payload)
+	case CommandBlockTxn:
+		return n.handleBlockTxn(peer, message.Payload)
+	case CommandInv:
+		return n.handleInv(peer, message.Payload)
+	case CommandGetTx:
+		return n.handleGetTx(peer, message.Payload)
+	case CommandTx:
+		return n.handleTx(peer, message.Payload)
+	}
+
+	return misbehaving(MalformedScore, "unknown command %s", message.Command)
+}
+
+func (n *Node) handleVersion(peer *Peer, payload []byte) error {
+	var version Version
+	if err := decode(payload, &version); err != nil {
+		return err
+	}
+
+	if peer.handshaked() {
+		return misbehaving(MalformedScore, "duplicate version")
+	}
+
+	if version.Nonce == n.nonce {
+		if !peer.Inbound {
+			n.self[peer.entry] = true
+			n.Book.Remove(peer.entry)
+		}
+		return errors.New("connected to self")
+	}
+
+	if version.Version < 1 {
+		return fmt.Errorf("unsupported protocol version %d", version.Version)
+	}
+
+	if version.Network != n.Chain.Params.Name {
+		n.Book.Remove(peer.entry)
+		return fmt.Errorf("peer is on %s", version.Network)
+	}
+
+	if !bytes.Equal(version.Genesis, n.hashes[0]) {
+		n.Book.Remove(peer.entry)
+		return errors.New("peer has a different genesis block")
+	}
+
+	peer.Version = version
+	if peer.Inbound {
+		peer.Send(CommandVersion, n.version())
+		if address := advertisedAddress(peer); address != "" {
+			peer.entry = address
+			if n.Book.Add(address, peer.Address) {
+				n.relayAddresses(peer, []string{address})
+			}
+		}
+	} else {
+		n.Book.Good(peer.entry)
+		peer.Send(CommandGetAddr, GetAddr{MaxAddresses})
+	}
+	fmt.Printf("Connected to %s at height %d\n", peer.Address, version.Height)
+
+	if version.Height > n.bestHeight() {
+		n.requestHeaders(peer)
+	}
+
+	for txID := range n.mempool().Entries() {
+		n.queueInventory(peer, txID)
+	}
+
+	return nil
+}
+
+func (n *Node) handleGetGenesis(peer *Peer) error {
+	genesis, err := n.Chain.GetBlock(n.hashes[0])
+	if err != nil {
+		return err
+	}
+
+	return peer.Send(CommandGenesis, Genesis{genesis.Serialize(), n.Chain.ConsensusConfig()})
+}
+
+func (n *Node) handleGetHeaders(peer *Peer, payload []byte) error {
+	var request GetHeaders
+	if err := decode(payload, &request); err != nil {
+		return err
+	}
+
+	start := 0
+	for _, hash := range request.Locator {
+		if height, ok := n.heights[hex.EncodeToString(hash)]; ok && height <= n.connected {
+			start = height
+			break
+		}
+	}
+
+	var headers []BlockChain.Header
+	for height := start + 1; height <= n.connected && len(headers) < MaxHeaders; height++ {
+		block, err := n.Chain.GetBlock(n.hashes[height])
+		if err != nil {
+			return err
+		}
+		headers = append(headers, block.Header())
+
+		if bytes.Equal(block.Hash, request.Stop) {
+			break
+		}
+	}
+
+	return peer.Send(CommandHeaders, Headers{headers})
+}
+
+// handleGetData queues every requested block at once, so a request is capped
+// at MaxGetData to fit the send queue of the peer, which would drop the peer
+// when full. A syncing node asks for at most MaxBlocksInFlight.
+func (n *Node) handleGetData(peer *Peer, payload []byte) error {
+	var request GetData
+	if err := decode(payload, &request); err != nil {
+		return err
+	}
+
+	if len(request.Hashes) > MaxGetData {
+		return misbehaving(ExcessiveScore, "getdata for %d blocks", len(request.Hashes))
+	}
+
+	var missing [][]byte
+	for _, hash := range request.Hashes {
+		height, ok := n.heights[hex.EncodeToString(hash)]
+		if !ok || height > n.connected {
+			missing = append(missing, hash)
+			continue
+		}
+
+		block, err := n.Chain.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+		if err := peer.Send(CommandBlock, BlockData{block.Serialize()}); err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		return peer.Send(CommandNotFound, NotFound{missing})
+	}
+
+	return nil
+}
+
+// handleGetAddr answers once per connection, so a peer can not walk the whole
+// address book by asking again.
+func (n *Node) handleGetAddr(peer *Peer, payload []byte) error {
+	var request GetAddr
+	if err := decode(payload, &request); err != nil {
+		return err
+	}
+
+	if peer.gossiped {
+		return nil
+	}
+	peer.gossiped = true
+
+	count := request.Count
+	if count <= 0 || count > MaxAddresses {
+		count = MaxAddresses
+	}
+
+	return peer.Send(CommandAddr, Addr{n.Book.Sample(count)})
+}
+
+func (n *Node) handleAddr(peer *Peer, payload []byte) error {
+	var message Addr
+	if err := decode(payload, &message); err != nil {
+		return err
+	}
+
+	if len(message.Addresses) > MaxAddresses {
+		return misbehaving(ExcessiveScore, "sent %d addresses", len(message.Addresses))
+	}
+
+	var fresh []string
+	for _, address := range message.Addresses {
+		if address == n.ListenAddress || n.self[address] {
+			continue
+		}
+		if n.Book.Add(address, peer.Address) {
+			fresh = append(fresh, address)
+		}
+	}
+
+	if len(fresh) > 0 && len(message.Addresses) <= RelayAddresses {
+		n.relayAddresses(peer, fresh)
+	}
+
+	return nil
+}
+
+// relayAddresses passes new addresses on to a few other peers, addresses are
+// only relayed when they were new so the gossip dies out.
+func (n *Node) relayAddresses(from *Peer, addresses []string) {
+	relayed := 0
+	for peer := range n.peers {
+		if relayed == RelayPeers {
+			return
+		}
+		if peer == from || !peer.handshaked() {
+			continue
+		}
+
+		peer.Send(CommandAddr, Addr{addresses})
+		relayed++
+	}
+}
+
+// advertisedAddress is where an inbound peer accepts connections, a listen
+// host that is unspecified or only reachable locally is replaced by the host
+// the peer connected from.
+func advertisedAddress(peer *Peer) string {
+	host, port, err := net.SplitHostPort(peer.Version.ListenAddress)
+	if err != nil {
+		return ""
+	}
+
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() || loopback(host) && !loopback(peer.host()) {
+		host = peer.host()
+	}
+
+	address := net.JoinHostPort(host, port)
+	if !ValidAddress(address) {
+		return ""
+	}
+
+	return address
+}
+
+func loopback(host string) bool {
+	ip := net.ParseIP(host)
+
+	return host == "localhost" || ip != nil && ip.IsLoopback()
+}
+
+func FetchGenesis(address string) (*BlockChain.Block, BlockChain.ConsensusConfig, error) {
+	var genesis Genesis
+	var block BlockChain.Block
+
+	conn, err := net.DialTimeout("tcp", address, DialTimeout)
+	if err != nil {
+		return nil, genesis.Consensus, err
+	}
+	defer conn.Close()
+
+	if err := writeMessage(conn, Message{Command: CommandGetGenesis}); err != nil {
+		return nil, genesis.Consensus, err
+	}
+
+	message, err := readMessage(conn)
+	if err != nil {
+		return nil, genesis.Consensus, err
+	}
+
+	if message.Command != CommandGenesis {
+		return nil, genesis.Consensus, fmt.Errorf("expected %s, got %s", CommandGenesis, message.Command)
+	}
+
+	if err := decode(message.Payload, &genesis); err != nil {
+		return nil, genesis.Consensus, err
+	}
+
+	if err := decode(genesis.Block, &block); err != nil {
+		return nil, genesis.Consensus, err
+	}
+
+	return &block, genesis.Consensus, nil
+}
@@ -0,0 +1,106 @@
+package Network
+
+import (
+	"encoding/hex"
+	"github.com/koushamad/blockchain/BlockChain"
+	"math/rand"
+	"time"
+)
+
+type orphan struct {
+	tx      *BlockChain.Transaction
+	peer    *Peer
+	expires time.Time
+}
+
+// orphanPool holds transactions whose parents are not known yet until the
+// parents arrive, the orphan expires or a random one is evicted to make room.
+type orphanPool struct {
+	orphans  map[string]*orphan
+	byParent map[string]map[string]bool
+	random   *rand.Rand
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		orphans:  make(map[string]*orphan),
+		byParent: make(map[string]map[string]bool),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (op *orphanPool) has(txID string) bool {
+	_, ok := op.orphans[txID]
+
+	return ok
+}
+
+func (op *orphanPool) add(tx *BlockChain.Transaction, peer *Peer) bool {
+	txID := hex.EncodeToString(tx.ID)
+	if op.has(txID) {
+		return false
+	}
+
+	if len(op.orphans) >= MaxOrphans {
+		evict := op.random.Intn(len(op.orphans))
+		for id := range op.orphans {
+			if evict == 0 {
+				op.remove(id)
+				break
+			}
+			evict--
+		}
+	}
+
+	op.orphans[txID] = &orphan{tx, peer, time.Now().Add(OrphanExpiry)}
+	for _, in := range tx.Inputs {
+		parentID := hex.EncodeToString(in.ID)
+		if op.byParent[parentID] == nil {
+			op.byParent[parentID] = make(map[string]bool)
+		}
+		op.byParent[parentID][txID] = true
+	}
+
+	return true
+}
+
+func (op *orphanPool) remove(txID string) {
+	orphan, ok := op.orphans[txID]
+	if !ok {
+		return
+	}
+	delete(op.orphans, txID)
+
+	for _, in := range orphan.tx.Inputs {
+		parentID := hex.EncodeToString(in.ID)
+		delete(op.byParent[parentID], txID)
+		if len(op.byParent[parentID]) == 0 {
+			delete(op.byParent, parentID)
+		}
+	}
+}
+
+func (op *orphanPool) children(parentID string) []*orphan {
+	var children []*orphan
+	for txID := range op.byParent[parentID] {
+		children = append(children, op.orphans[txID])
+	}
+
+	return children
+}
+
+// expire drops the orphans that waited too long for their parents and the
+// ones of peers that went away, it returns how many were dropped.
+func (op *orphanPool) expire(peers map[*Peer]bool) int {
+	now := time.Now()
+	expired := 0
+
+	for txID, orphan := range op.orphans {
+		if now.After(orphan.expires) || !peers[orphan.peer] {
+			op.remove(txID)
+			expired++
+		}
+	}
+
+	return expired
+}
@@ -0,0 +1,126 @@
+package Network
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Wallet"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestPeer(t *testing.T) *Peer {
+	local, remote := net.Pipe()
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+
+	return newPeer(local, false)
+}
+
+func orphanTx(parents ...string) *BlockChain.Transaction {
+	tx := &BlockChain.Transaction{Outputs: []BlockChain.TXOutput{{Value: 1}}}
+	for i, parent := range parents {
+		tx.Inputs = append(tx.Inputs, BlockChain.TxInput{ID: []byte(parent), Out: i})
+	}
+	tx.ID = tx.Hash()
+
+	return tx
+}
+
+func TestOrphanPool(t *testing.T) {
+	peer := newTestPeer(t)
+	gone := newTestPeer(t)
+	pool := newOrphanPool()
+
+	child := orphanTx("parent", "other")
+	if !pool.add(child, peer) || pool.add(child, peer) {
+		t.Fatal("orphan was not added exactly once")
+	}
+	if !pool.has(hex.EncodeToString(child.ID)) {
+		t.Fatal("pool does not have the orphan")
+	}
+	for _, parent := range []string{"parent", "other"} {
+		if children := pool.children(hex.EncodeToString([]byte(parent))); len(children) != 1 || children[0].tx != child {
+			t.Errorf("%s has %d children", parent, len(children))
+		}
+	}
+
+	pool.remove(hex.EncodeToString(child.ID))
+	if len(pool.orphans) != 0 || len(pool.byParent) != 0 {
+		t.Errorf("removing left %d orphans and %d parents", len(pool.orphans), len(pool.byParent))
+	}
+
+	for i := 0; i < MaxOrphans+10; i++ {
+		pool.add(orphanTx(fmt.Sprintf("parent %d", i)), peer)
+	}
+	if len(pool.orphans) != MaxOrphans {
+		t.Errorf("pool holds %d orphans, the limit is %d", len(pool.orphans), MaxOrphans)
+	}
+	if len(pool.byParent) != MaxOrphans {
+		t.Errorf("pool indexes %d parents for %d orphans", len(pool.byParent), len(pool.orphans))
+	}
+
+	old := orphanTx("old")
+	pool.add(old, peer)
+	pool.orphans[hex.EncodeToString(old.ID)].expires = time.Now().Add(-time.Second)
+	pool.add(orphanTx("gone"), gone)
+
+	before := len(pool.orphans)
+	if expired := pool.expire(map[*Peer]bool{peer: true}); expired != 2 || len(pool.orphans) != before-2 {
+		t.Errorf("expired %d orphans, want the expired one and the one of the gone peer", expired)
+	}
+}
+
+func TestHandleTxResolvesOrphans(t *testing.T) {
+	alice := Wallet.MakeWallet()
+	address := string(alice.Address())
+	chain := newTestChain(t, address)
+	n := NewNode(chain, "", nil)
+	peer := newTestPeer(t)
+	mempool := BlockChain.Mempool{Chain: chain}
+
+	parent := payment(chain, alice, 5)
+	if err := mempool.Add(parent); err != nil {
+		t.Fatal(err)
+	}
+	UTXO := BlockChain.UTXOSet{Chain: chain}
+	output := BlockChain.NewTXOutput(3, address)
+	child := BlockChain.FundTransaction(address, []BlockChain.TXOutput{*output}, &UTXO, BlockChain.TxOptions{Coins: []BlockChain.OutPoint{{TxID: parent.ID, Index: 0}}, Fee: 1})
+	chain.SignTransaction(child, alice.PrivateKey)
+	mempool.Clear()
+
+	send := func(tx *BlockChain.Transaction) {
+		if err := n.handleTx(peer, encode(TxData{tx.Serialize()})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	invalid := *parent
+	invalid.Outputs = []BlockChain.TXOutput{{Value: -1}}
+	unsigned := invalid.TrimmedCopy()
+	invalid.ID = unsigned.Hash()
+	if _, ok := n.handleTx(peer, encode(TxData{invalid.Serialize()})).(misbehavior); !ok {
+		t.Error("invalid transaction did not count as misbehavior")
+	}
+
+	send(child)
+	if !n.orphans.has(hex.EncodeToString(child.ID)) {
+		t.Fatal("child without its parent is not an orphan")
+	}
+	if _, ok := mempool.Get(child.ID); ok {
+		t.Fatal("orphan entered the mempool")
+	}
+
+	send(parent)
+	if len(n.orphans.orphans) != 0 {
+		t.Error("orphan was not resolved by its parent")
+	}
+	for _, tx := range []*BlockChain.Transaction{parent, child} {
+		if _, ok := mempool.Get(tx.ID); !ok {
+			t.Errorf("transaction %x is not in the mempool", tx.ID)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package Network
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type Peer struct {
+	Address string
+	Inbound bool
+	Version Version
+
+	conn     net.Conn
+	queue    chan Message
+	once     sync.Once
+	done     chan struct{}
+	inFlight int
+	stalls   int
+	score    int
+	entry    string
+	gossiped bool
+
+	inventory   map[string]bool
+	known       map[string]bool
+	nextTrickle time.Time
+}
+
+func newPeer(conn net.Conn, inbound bool) *Peer {
+	return &Peer{
+		Address: conn.RemoteAddr().String(),
+		Inbound: inbound,
+		conn:    conn,
+		queue:   make(chan Message, SendQueueSize),
+		done:    make(chan struct{}),
+
+		inventory: make(map[string]bool),
+		known:     make(map[string]bool),
+	}
+}
+
+// Send queues a message for the writer goroutine so a slow peer never blocks
+// the node, a peer that lets its queue fill up is disconnected.
+func (p *Peer) Send(command string, payload interface{}) error {
+	select {
+	case p.queue <- Message{command, encode(payload)}:
+		return nil
+	case <-p.done:
+		return errors.New("peer is disconnected")
+	default:
+		p.Close()
+		return errors.New("peer send queue is full")
+	}
+}
+
+func (p *Peer) write() {
+	for {
+		select {
+		case message := <-p.queue:
+			if err := writeMessage(p.conn, message); err != nil {
+				p.Close()
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *Peer) Close() {
+	p.once.Do(func() {
+		close(p.done)
+		p.conn.Close()
+	})
+}
+
+// host is what bans apply to, the port of an inbound peer changes with every
+// connection.
+func (p *Peer) host() string {
+	return hostOf(p.Address)
+}
+
+// know remembers that the peer has a transaction so it is not announced to it,
+// the set starts over when it grows too big.
+func (p *Peer) know(txID string) {
+	if len(p.known) >= MaxKnownInventory {
+		p.known = make(map[string]bool)
+	}
+
+	p.known[txID] = true
+	delete(p.inventory, txID)
+}
+
+func (p *Peer) handshaked() bool {
+	return p.Version.Version != 0
+}
@@ -0,0 +1,236 @@
+package Network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"io"
+	"time"
+)
+
+const (
+	ProtocolVersion = 1
+	DefaultAddress  = "localhost:4000"
+
+	MaxHeaders        = 2000
+	BlockWindow       = 128
+	MaxBlocksInFlight = 16
+	MaxStalls         = 3
+	SendQueueSize     = 256
+	MaxGetData        = SendQueueSize / 2
+	MaxMessageSize    = 4 << 20
+	MaxAddresses      = 1000
+	MaxKnownAddresses = 2000
+	MaxAttempts       = 10
+	MaxOutbound       = 8
+	MaxInbound        = 32
+	RelayAddresses    = 10
+	RelayPeers        = 2
+	ShortIDBytes      = 6
+	MaxInventory      = 1000
+	MaxKnownInventory = 5000
+	MaxOrphans        = 100
+
+	BanScore         = 100
+	InvalidScore     = BanScore
+	MalformedScore   = 20
+	ExcessiveScore   = 20
+	UnconnectedScore = 10
+
+	StallTimeout     = 2 * time.Second
+	BlockTimeout     = 10 * time.Second
+	SyncInterval     = 30 * time.Second
+	ProgressInterval = time.Second
+	DialTimeout      = 5 * time.Second
+	ConnectInterval  = 5 * time.Second
+	RetryInterval    = 10 * time.Second
+	SaveInterval     = time.Minute
+	BanDuration      = 24 * time.Hour
+
+	TrickleTick            = 100 * time.Millisecond
+	TrickleInterval        = 2 * time.Second
+	InboundTrickleInterval = 5 * time.Second
+	OrphanExpiry           = 20 * time.Minute
+	TxRequestTimeout       = 30 * time.Second
+)
+
+const (
+	CommandVersion     = "version"
+	CommandGetGenesis  = "getgenesis"
+	CommandGenesis     = "genesis"
+	CommandGetHeaders  = "getheaders"
+	CommandHeaders     = "headers"
+	CommandGetData     = "getdata"
+	CommandBlock       = "block"
+	CommandNotFound    = "notfound"
+	CommandGetAddr     = "getaddr"
+	CommandAddr        = "addr"
+	CommandCmpctBlock  = "cmpctblock"
+	CommandGetBlockTxn = "getblocktxn"
+	CommandBlockTxn    = "blocktxn"
+	CommandInv         = "inv"
+	CommandGetTx       = "gettx"
+	CommandTx          = "tx"
+)
+
+// Message is what peers exchange, gob encoded behind a four byte length so a
+// message that is too big is refused before it is read. The payload is the
+// gob encoding of the struct that belongs to the command.
+type Message struct {
+	Command string
+	Payload []byte
+}
+
+type Version struct {
+	Version       int
+	Network       string
+	Genesis       []byte
+	Height        int
+	BestHash      []byte
+	ListenAddress string
+	Nonce         uint64
+}
+
+type Genesis struct {
+	Block     []byte
+	Consensus BlockChain.ConsensusConfig
+}
+
+// GetHeaders asks for the headers after the first locator hash the peer has
+// on its best chain, up to Stop or MaxHeaders.
+type GetHeaders struct {
+	Locator [][]byte
+	Stop    []byte
+}
+
+type Headers struct {
+	Headers []BlockChain.Header
+}
+
+type GetData struct {
+	Hashes [][]byte
+}
+
+type BlockData struct {
+	Block []byte
+}
+
+type NotFound struct {
+	Hashes [][]byte
+}
+
+type GetAddr struct {
+	Count int
+}
+
+// Addr gossips addresses peers accept connections on, the answer to getaddr
+// carries up to MaxAddresses and a few new ones are relayed on.
+type Addr struct {
+	Addresses []string
+}
+
+// CompactBlock announces a new block with short IDs in place of the
+// transactions the receiver is expected to have in its mempool, the coinbase
+// is always sent in full.
+type CompactBlock struct {
+	Header    BlockChain.Header
+	Nonce     uint64
+	ShortIDs  []uint64
+	Prefilled []PrefilledTx
+}
+
+type PrefilledTx struct {
+	Index int
+	Tx    *BlockChain.Transaction
+}
+
+// GetBlockTxn asks for the transactions of a compact block that could not be
+// found in the mempool, by their index in the block.
+type GetBlockTxn struct {
+	Hash    []byte
+	Indexes []int
+}
+
+type BlockTxn struct {
+	Hash         []byte
+	Transactions []*BlockChain.Transaction
+}
+
+// Inv announces transaction IDs, peers ask for the ones they do not have with
+// gettx.
+type Inv struct {
+	TxIDs [][]byte
+}
+
+type GetTx struct {
+	TxIDs [][]byte
+}
+
+type TxData struct {
+	Tx []byte
+}
+
+// misbehavior is returned by message handlers when a peer breaks the
+// protocol, the score adds up towards a ban.
+type misbehavior struct {
+	score  int
+	reason string
+}
+
+func (m misbehavior) Error() string {
+	return m.reason
+}
+
+func misbehaving(score int, format string, args ...interface{}) error {
+	return misbehavior{score, fmt.Sprintf(format, args...)}
+}
+
+func writeMessage(w io.Writer, message Message) error {
+	data := encode(message)
+
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	_, err := w.Write(append(frame, data...))
+
+	return err
+}
+
+func readMessage(r io.Reader) (Message, error) {
+	var message Message
+
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return message, err
+	}
+
+	length := binary.BigEndian.Uint32(size)
+	if length > MaxMessageSize {
+		return message, misbehaving(BanScore, "sent a %d byte message", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return message, err
+	}
+
+	return message, decode(data, &message)
+}
+
+func encode(payload interface{}) []byte {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(payload)
+	Handler.Handle(err)
+
+	return buffer.Bytes()
+}
+
+func decode(data []byte, payload interface{}) error {
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(payload); err != nil {
+		return misbehaving(MalformedScore, "malformed message: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,571 @@
+package Network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"math/big"
+	"sort"
+	"time"
+)
+
+type request struct {
+	peer *Peer
+	time time.Time
+}
+
+type download struct {
+	block *BlockChain.Block
+	peer  *Peer
+}
+
+type progress struct {
+	connected int
+	headers   int
+}
+
+// locator lists best chain hashes from the tip back, dense at first and then
+// doubling the step, so a peer finds the fork point in a few hashes.
+func (n *Node) locator() [][]byte {
+	var locator [][]byte
+
+	step := 1
+	for height := n.bestHeight(); height > 0; height -= step {
+		locator = append(locator, n.hashes[height])
+		if len(locator) >= 10 {
+			step *= 2
+		}
+	}
+
+	return append(locator, n.hashes[0])
+}
+
+// headerNode is a header that connects to the genesis block with the work of
+// the chain up to it. Side branches are kept so the node can switch to one
+// once it has more work than the best chain.
+type headerNode struct {
+	header  BlockChain.Header
+	work    *big.Int
+	invalid bool
+}
+
+func (n *Node) addHeader(header BlockChain.Header) *headerNode {
+	work := header.Work()
+	if parent, ok := n.tree[hex.EncodeToString(header.PrevHash)]; ok {
+		work.Add(work, parent.work)
+	}
+
+	node := &headerNode{header: header, work: work}
+	n.tree[hex.EncodeToString(header.Hash)] = node
+
+	return node
+}
+
+// extend appends a header to the best chain.
+func (n *Node) extend(node *headerNode) {
+	n.hashes = append(n.hashes, node.header.Hash)
+	n.heights[hex.EncodeToString(node.header.Hash)] = node.header.Height
+}
+
+func (n *Node) onBestChain(header BlockChain.Header) bool {
+	return header.Height <= n.bestHeight() && bytes.Equal(n.hashes[header.Height], header.Hash)
+}
+
+func (n *Node) bestTip() *headerNode {
+	return n.tree[hex.EncodeToString(n.hashes[n.bestHeight()])]
+}
+
+// HeaderHash looks up the best header chain for the assumed valid check of
+// the chain, it is called while connecting blocks with the lock held.
+func (n *Node) HeaderHash(height int) ([]byte, bool) {
+	if height < 0 || height > n.bestHeight() {
+		return nil, false
+	}
+
+	return n.hashes[height], true
+}
+
+// Header looks up a header of any branch, the authority check of a header
+// replays the signers of the headers before it.
+func (n *Node) Header(hash []byte) (BlockChain.Header, bool) {
+	node, ok := n.tree[hex.EncodeToString(hash)]
+	if !ok {
+		return BlockChain.Header{}, false
+	}
+
+	return node.header, true
+}
+
+func (n *Node) requestHeaders(peer *Peer) {
+	peer.Send(CommandGetHeaders, GetHeaders{Locator: n.locator()})
+}
+
+// requestMoreHeaders continues after the last header a peer sent, which may
+// be on a branch the locator of the best chain does not lead to.
+func (n *Node) requestMoreHeaders(peer *Peer, last []byte) {
+	peer.Send(CommandGetHeaders, GetHeaders{Locator: append([][]byte{last}, n.locator()...)})
+}
+
+func (n *Node) handleHeaders(peer *Peer, payload []byte) error {
+	var message Headers
+	if err := decode(payload, &message); err != nil {
+		return err
+	}
+
+	if len(message.Headers) > MaxHeaders {
+		return misbehaving(ExcessiveScore, "sent %d headers", len(message.Headers))
+	}
+
+	best := n.bestTip()
+	for _, header := range message.Headers {
+		if known, ok := n.tree[hex.EncodeToString(header.Hash)]; ok {
+			if known.invalid {
+				return misbehaving(InvalidScore, "header %d is on an invalid chain", header.Height)
+			}
+			continue
+		}
+
+		parent, ok := n.tree[hex.EncodeToString(header.PrevHash)]
+		if !ok {
+			return misbehaving(UnconnectedScore, "header %d does not connect to the header chain", header.Height)
+		}
+		if parent.invalid {
+			return misbehaving(InvalidScore, "header %d extends an invalid chain", header.Height)
+		}
+
+		if err := n.Chain.CheckHeader(header, parent.header); err != nil {
+			return misbehaving(InvalidScore, "invalid header %d: %s", header.Height, err)
+		}
+
+		if node := n.addHeader(header); node.work.Cmp(best.work) > 0 {
+			best = node
+		}
+	}
+
+	if count := len(message.Headers); count > 0 {
+		if last := message.Headers[count-1].Height; last > peer.Version.Height {
+			peer.Version.Height = last
+		}
+	}
+
+	if best != n.bestTip() {
+		n.reorganize(best)
+	}
+
+	if count := len(message.Headers); count == MaxHeaders {
+		n.requestMoreHeaders(peer, message.Headers[count-1].Hash)
+	}
+
+	n.schedule()
+
+	return nil
+}
+
+// reorganize makes the chain ending in tip the best header chain. Connected
+// blocks above the fork point stay connected until switchBranch has the
+// blocks of the new branch, which are downloaded or read back from the
+// database when the node had them before.
+func (n *Node) reorganize(tip *headerNode) {
+	var branch []*headerNode
+
+	node := tip
+	for !n.onBestChain(node.header) {
+		branch = append(branch, node)
+		node = n.tree[hex.EncodeToString(node.header.PrevHash)]
+	}
+	fork := node.header.Height
+
+	if fork < n.connected {
+		if n.pending == nil {
+			n.pending = n.tree[hex.EncodeToString(n.hashes[n.connected])]
+		}
+		n.connected = fork
+	}
+
+	for height := fork + 1; height <= n.bestHeight(); height++ {
+		delete(n.heights, hex.EncodeToString(n.hashes[height]))
+		delete(n.blocks, height)
+		delete(n.stalled, height)
+		n.finishRequest(height)
+	}
+	n.hashes = n.hashes[:fork+1]
+
+	for hash, partial := range n.partial {
+		if partial.header.Height > fork {
+			delete(n.partial, hash)
+		}
+	}
+
+	for i := len(branch) - 1; i >= 0; i-- {
+		n.extend(branch[i])
+	}
+
+	if n.pending == nil {
+		return
+	}
+
+	if n.onBestChain(n.pending.header) {
+		n.connected = n.pending.header.Height
+		n.pending = nil
+		return
+	}
+
+	fmt.Printf("Reorganizing: downloading the branch from height %d to %d before disconnecting back to the fork\n",
+		n.connected, n.bestHeight())
+}
+
+// switchBranch disconnects the blocks above the fork point once the blocks
+// of the new branch are downloaded up to one with more work than the
+// connected tip and pass the checks that need no chain state. A header chain
+// without valid blocks behind it never costs the node its connected chain.
+func (n *Node) switchBranch() bool {
+	for height := n.connected + 1; ; height++ {
+		if height > n.bestHeight() {
+			return false
+		}
+
+		downloaded, ok := n.blocks[height]
+		if !ok {
+			return false
+		}
+
+		if err := n.Chain.CheckBlockBody(downloaded.block); err != nil {
+			delete(n.blocks, height)
+			n.reject(height, downloaded, err)
+			return false
+		}
+
+		if n.tree[hex.EncodeToString(n.hashes[height])].work.Cmp(n.pending.work) > 0 {
+			break
+		}
+	}
+
+	disconnected, err := n.Chain.Rollback(n.hashes[n.connected])
+	Handler.Handle(err)
+	n.mempool().Reorganize(disconnected)
+	n.pending = nil
+
+	fmt.Printf("Reorganizing: disconnected %d blocks back to height %d, the new best chain ends at height %d\n",
+		len(disconnected), n.connected, n.bestHeight())
+
+	return true
+}
+
+// invalidate marks a block whose body was rejected and every header built on
+// it, then falls back to the chain with the most work that is still valid.
+func (n *Node) invalidate(hash []byte) {
+	bad := n.tree[hex.EncodeToString(hash)]
+	bad.invalid = true
+
+	var later []*headerNode
+	for _, node := range n.tree {
+		if node.header.Height > bad.header.Height {
+			later = append(later, node)
+		}
+	}
+	sort.Slice(later, func(i, j int) bool { return later[i].header.Height < later[j].header.Height })
+
+	for _, node := range later {
+		if n.tree[hex.EncodeToString(node.header.PrevHash)].invalid {
+			node.invalid = true
+		}
+	}
+
+	best := n.tree[hex.EncodeToString(n.hashes[n.connected])]
+	if n.pending != nil {
+		best = n.pending
+	}
+	for _, node := range n.tree {
+		if !node.invalid && node.work.Cmp(best.work) > 0 {
+			best = node
+		}
+	}
+
+	n.reorganize(best)
+}
+
+// matchesHeader checks a block body against the validated header before it
+// is connected. A block that does not match, including one with a repeated
+// transaction that leaves the merkle root unchanged, says nothing about the
+// header, so only the peer that sent it is to blame.
+func (n *Node) matchesHeader(block *BlockChain.Block) bool {
+	node, ok := n.tree[hex.EncodeToString(block.Hash)]
+	if !ok || len(block.Transactions) == 0 {
+		return false
+	}
+
+	seen := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if tx == nil || seen[hex.EncodeToString(tx.ID)] {
+			return false
+		}
+		seen[hex.EncodeToString(tx.ID)] = true
+	}
+
+	header := block.Header()
+	expected := node.header
+
+	return bytes.Equal(header.PrevHash, expected.PrevHash) &&
+		bytes.Equal(header.MerkleRoot, expected.MerkleRoot) &&
+		header.Nonce == expected.Nonce &&
+		header.Height == expected.Height &&
+		header.Timestamp == expected.Timestamp &&
+		header.Algorithm == expected.Algorithm &&
+		bytes.Equal(header.Signer, expected.Signer) &&
+		bytes.Equal(header.Signature, expected.Signature) &&
+		header.Vote == expected.Vote
+}
+
+// schedule requests the missing blocks of a window that starts at the next
+// block to connect, spreading them over the peers with the fewest requests.
+// Blocks the node already stored, from before it switched to another branch,
+// are connected from the database.
+func (n *Node) schedule() {
+	for {
+		connected := n.connected
+		n.loadStoredBlocks()
+		n.connectBlocks()
+		if n.connected == connected {
+			break
+		}
+	}
+
+	batches := make(map[*Peer][][]byte)
+
+	for height := n.connected + 1; height <= n.window(); height++ {
+		if _, ok := n.blocks[height]; ok {
+			continue
+		}
+		if _, ok := n.requests[height]; ok {
+			continue
+		}
+
+		peer := n.pickPeer(height, n.stalled[height])
+		if peer == nil {
+			peer = n.pickPeer(height, nil)
+		}
+		if peer == nil {
+			break
+		}
+
+		n.requests[height] = request{peer, time.Now()}
+		peer.inFlight++
+		batches[peer] = append(batches[peer], n.hashes[height])
+	}
+
+	for peer, hashes := range batches {
+		peer.Send(CommandGetData, GetData{hashes})
+	}
+}
+
+// window is the last block to download. While the node waits to switch
+// branches it reaches at least the first block with more work than the
+// connected tip, however far back the fork is.
+func (n *Node) window() int {
+	end := n.connected + BlockWindow
+	if n.pending != nil {
+		for end < n.bestHeight() && n.tree[hex.EncodeToString(n.hashes[end])].work.Cmp(n.pending.work) <= 0 {
+			end++
+		}
+	}
+
+	if end > n.bestHeight() {
+		end = n.bestHeight()
+	}
+
+	return end
+}
+
+func (n *Node) loadStoredBlocks() {
+	for height := n.connected + 1; height <= n.window(); height++ {
+		if _, ok := n.blocks[height]; ok {
+			continue
+		}
+		if _, ok := n.requests[height]; ok {
+			continue
+		}
+
+		if block, err := n.Chain.GetBlock(n.hashes[height]); err == nil {
+			n.blocks[height] = download{&block, nil}
+		}
+	}
+}
+
+func (n *Node) pickPeer(height int, avoid *Peer) *Peer {
+	var best *Peer
+
+	for peer := range n.peers {
+		if peer == avoid || !peer.handshaked() || peer.Version.Height < height || peer.inFlight >= MaxBlocksInFlight {
+			continue
+		}
+		if best == nil || peer.inFlight < best.inFlight {
+			best = peer
+		}
+	}
+
+	return best
+}
+
+func (n *Node) finishRequest(height int) {
+	if req, ok := n.requests[height]; ok {
+		req.peer.inFlight--
+		delete(n.requests, height)
+	}
+}
+
+func (n *Node) handleBlock(peer *Peer, payload []byte) error {
+	var message BlockData
+	var block BlockChain.Block
+
+	if err := decode(payload, &message); err != nil {
+		return err
+	}
+	if err := decode(message.Block, &block); err != nil {
+		return err
+	}
+
+	height, ok := n.heights[hex.EncodeToString(block.Hash)]
+	if !ok || height <= n.connected {
+		return nil
+	}
+
+	if _, ok := n.blocks[height]; ok {
+		return nil
+	}
+
+	if !n.matchesHeader(&block) {
+		return misbehaving(InvalidScore, "block %d does not match its header", height)
+	}
+
+	n.finishRequest(height)
+	delete(n.stalled, height)
+	n.blocks[height] = download{&block, peer}
+
+	n.connectBlocks()
+	n.schedule()
+
+	return nil
+}
+
+func (n *Node) handleNotFound(peer *Peer, payload []byte) error {
+	var message NotFound
+	if err := decode(payload, &message); err != nil {
+		return err
+	}
+
+	for _, hash := range message.Hashes {
+		height, ok := n.heights[hex.EncodeToString(hash)]
+		if !ok {
+			continue
+		}
+
+		if req, ok := n.requests[height]; ok && req.peer == peer {
+			n.finishRequest(height)
+		}
+
+		if height-1 < peer.Version.Height {
+			peer.Version.Height = height - 1
+		}
+	}
+
+	n.schedule()
+
+	return nil
+}
+
+// connectBlocks connects the downloaded blocks that follow the tip, after
+// switching branches if the node waits for one. A block that is rejected
+// costs only the peer that sent it, its header and the ones built on it are
+// marked invalid and the node falls back to the best chain that is left.
+func (n *Node) connectBlocks() {
+	miner := BlockChain.Miner{Chain: n.Chain}
+
+	if n.pending != nil && !n.switchBranch() {
+		return
+	}
+
+	for {
+		next := n.connected + 1
+		downloaded, ok := n.blocks[next]
+		if !ok {
+			return
+		}
+		delete(n.blocks, next)
+
+		if err := miner.SubmitBlock(downloaded.block); err != nil {
+			n.reject(next, downloaded, err)
+			return
+		}
+
+		delete(n.partial, hex.EncodeToString(downloaded.block.Hash))
+		n.connected = next
+
+		if next == n.bestHeight() {
+			n.announce(downloaded.block, downloaded.peer)
+		}
+
+		var txIDs []string
+		for _, tx := range downloaded.block.Transactions {
+			txIDs = append(txIDs, hex.EncodeToString(tx.ID))
+		}
+		n.resolveOrphans(txIDs...)
+	}
+}
+
+func (n *Node) reject(height int, downloaded download, err error) {
+	reason := fmt.Sprintf("invalid block %d: %s", height, err)
+	if downloaded.peer != nil {
+		n.misbehave(downloaded.peer, InvalidScore, reason)
+	} else {
+		fmt.Printf("Stored %s\n", reason)
+	}
+	n.invalidate(downloaded.block.Hash)
+}
+
+// checkStalls re-requests blocks that did not arrive in time from another
+// peer. The next block to connect gets less time once later blocks are
+// waiting on it, a peer that keeps stalling is dropped.
+func (n *Node) checkStalls() {
+	now := time.Now()
+
+	for height, req := range n.requests {
+		timeout := BlockTimeout
+		if height == n.connected+1 && len(n.blocks) > 0 {
+			timeout = StallTimeout
+		}
+
+		if now.Sub(req.time) < timeout {
+			continue
+		}
+
+		fmt.Printf("Block %d from %s timed out, requesting it again\n", height, req.peer.Address)
+		n.finishRequest(height)
+		n.stalled[height] = req.peer
+
+		req.peer.stalls++
+		if req.peer.stalls >= MaxStalls && len(n.peers) > 1 {
+			fmt.Printf("Disconnecting stalling peer %s\n", req.peer.Address)
+			req.peer.Close()
+		}
+	}
+
+	n.schedule()
+}
+
+func (n *Node) reportProgress() {
+	current := progress{n.connected, n.bestHeight()}
+	if current == n.reported {
+		return
+	}
+	n.reported = current
+
+	if current.headers > current.connected {
+		fmt.Printf("Syncing: headers %d, blocks %d/%d (%.1f%%), %d peers, %d blocks in flight\n",
+			current.headers, current.connected, current.headers, 100*float64(current.connected)/float64(current.headers), len(n.peers), len(n.requests))
+		return
+	}
+
+	fmt.Printf("Synced to height %d with %d peers\n", current.connected, len(n.peers))
+}
@@ -0,0 +1,288 @@
+package Network
+
+import (
+	"bytes"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Wallet"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startNode listens on a free loopback port and accepts peers without the
+// tickers of Run, a test drives stalls and dialing itself.
+func startNode(t *testing.T, chain *BlockChain.Chain) *Node {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book := NewAddressBook(filepath.Join(t.TempDir(), "peers.dat"))
+	n := NewNode(chain, listener.Addr().String(), book)
+	n.listener = listener
+	go n.accept(listener)
+	t.Cleanup(n.shutdown)
+
+	return n
+}
+
+// waitFor polls check under the node lock until it holds.
+func waitFor(t *testing.T, n *Node, what string, check func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		n.mutex.Lock()
+		ok := check()
+		n.mutex.Unlock()
+		if ok {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// silentPeer accepts one connection, completes the handshake and answers
+// every getheaders with headers, but never sends a block.
+func silentPeer(t *testing.T, chain *BlockChain.Chain, headers []BlockChain.Header) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	tip := headers[len(headers)-1]
+	version := Version{
+		Version:  ProtocolVersion,
+		Network:  chain.Params.Name,
+		Genesis:  headers[0].PrevHash,
+		Height:   tip.Height,
+		BestHash: tip.Hash,
+		Nonce:    randomNonce(),
+	}
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			message, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+
+			switch message.Command {
+			case CommandVersion:
+				err = writeMessage(conn, Message{CommandVersion, encode(version)})
+			case CommandGetHeaders:
+				err = writeMessage(conn, Message{CommandHeaders, encode(Headers{headers})})
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// forkChain creates a second chain on the genesis block of chain.
+func forkChain(t *testing.T, chain *BlockChain.Chain) *BlockChain.Chain {
+	t.Helper()
+
+	iter := chain.Iterator()
+	genesis := iter.Next()
+	for len(genesis.PrevHash) > 0 {
+		genesis = iter.Next()
+	}
+
+	params := *chain.Params
+	params.DBPath = t.TempDir()
+
+	fork, err := BlockChain.InitBlockChainFromGenesis(genesis, &params, chain.ConsensusConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fork.Database.Close() })
+	BlockChain.UTXOSet{Chain: fork}.Reindex()
+
+	return fork
+}
+
+func mine(t *testing.T, chain *BlockChain.Chain, address string, count int) []*BlockChain.Block {
+	t.Helper()
+
+	var blocks []*BlockChain.Block
+	for i := 0; i < count; i++ {
+		block, err := BlockChain.Miner{Chain: chain, RewardAddress: address}.MineBlock(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+func TestReorganizeWaitsForBranchBlocks(t *testing.T) {
+	alice, bob := Wallet.MakeWallet(), Wallet.MakeWallet()
+	chain := newTestChain(t, string(alice.Address()))
+	other := forkChain(t, chain)
+
+	connected := mine(t, chain, string(alice.Address()), 1)[0]
+	branch := mine(t, other, string(bob.Address()), 2)
+
+	n := NewNode(chain, "", nil)
+	peer := newTestPeer(t)
+	peer.Version = Version{Version: ProtocolVersion, Height: 2}
+	n.peers[peer] = true
+
+	headers := Headers{[]BlockChain.Header{branch[0].Header(), branch[1].Header()}}
+	if err := n.handleHeaders(peer, encode(headers)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, connected.Hash) {
+		t.Fatal("the headers of a branch disconnected the chain before its blocks arrived")
+	}
+	if len(n.requests) != 2 {
+		t.Fatalf("%d blocks of the branch requested, want 2", len(n.requests))
+	}
+
+	if err := n.handleBlock(peer, encode(BlockData{branch[0].Serialize()})); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, connected.Hash) {
+		t.Fatal("switched to a branch without more work than the chain")
+	}
+
+	if err := n.handleBlock(peer, encode(BlockData{branch[1].Serialize()})); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, branch[1].Hash) || n.connected != 2 || n.pending != nil {
+		t.Errorf("chain is at %x, connected %d, want the branch at height 2", chain.LastHash, n.connected)
+	}
+	if _, err := chain.GetBlock(connected.Hash); err != nil {
+		t.Error("the disconnected block was not kept")
+	}
+}
+
+func TestSyncRerequestsStalledBlocks(t *testing.T) {
+	alice := Wallet.MakeWallet()
+	chain := newTestChain(t, string(alice.Address()))
+	other := forkChain(t, chain)
+	blocks := mine(t, other, string(alice.Address()), 2)
+
+	n := startNode(t, chain)
+	source := startNode(t, other)
+
+	staller := silentPeer(t, other, []BlockChain.Header{blocks[0].Header(), blocks[1].Header()})
+	if err := n.Connect(staller); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, n, "the blocks to be requested from the silent peer", func() bool {
+		return len(n.requests) == 2
+	})
+
+	if err := n.Connect(source.ListenAddress); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, n, "the handshake with the second peer", func() bool {
+		handshaked := 0
+		for peer := range n.peers {
+			if peer.handshaked() {
+				handshaked++
+			}
+		}
+		return handshaked == 2
+	})
+
+	n.mutex.Lock()
+	var silent *Peer
+	for height, req := range n.requests {
+		silent = req.peer
+		n.requests[height] = request{req.peer, time.Now().Add(-BlockTimeout)}
+	}
+	n.checkStalls()
+	n.mutex.Unlock()
+
+	waitFor(t, n, "the stalled blocks to arrive from the other peer", func() bool {
+		return n.connected == 2
+	})
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if !bytes.Equal(chain.LastHash, blocks[1].Hash) {
+		t.Errorf("chain is at %x, want %x", chain.LastHash, blocks[1].Hash)
+	}
+	if silent.stalls != 2 {
+		t.Errorf("silent peer has %d stalls, want 2", silent.stalls)
+	}
+	if !n.peers[silent] {
+		t.Error("peer was disconnected before it stalled MaxStalls times")
+	}
+}
+
+func TestSyncReorganizesToHeavierPeer(t *testing.T) {
+	alice, bob := Wallet.MakeWallet(), Wallet.MakeWallet()
+	chain := newTestChain(t, string(alice.Address()))
+	other := forkChain(t, chain)
+
+	connected := mine(t, chain, string(alice.Address()), 1)[0]
+	branch := mine(t, other, string(bob.Address()), 2)
+
+	n := startNode(t, chain)
+	source := startNode(t, other)
+
+	if err := n.Connect(source.ListenAddress); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, n, "the reorganization to the heavier branch", func() bool {
+		return bytes.Equal(chain.LastHash, branch[1].Hash)
+	})
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.connected != 2 || n.pending != nil {
+		t.Errorf("connected %d with pending tip %v, want 2 and none", n.connected, n.pending)
+	}
+	UTXO := BlockChain.UTXOSet{Chain: chain}
+	if _, ok := UTXO.GetOutputs(connected.Transactions[0].ID); ok {
+		t.Error("the coinbase of the disconnected block is still unspent")
+	}
+}
+
+func TestGetDataLimit(t *testing.T) {
+	alice := Wallet.MakeWallet()
+	n := NewNode(newTestChain(t, string(alice.Address())), "", nil)
+	peer := newTestPeer(t)
+
+	hashes := make([][]byte, MaxGetData+1)
+	for i := range hashes {
+		hashes[i] = []byte{byte(i), byte(i >> 8)}
+	}
+
+	if _, ok := n.handleGetData(peer, encode(GetData{hashes})).(misbehavior); !ok {
+		t.Error("getdata for more blocks than fit the send queue was not misbehavior")
+	}
+
+	if err := n.handleGetData(peer, encode(GetData{hashes[:MaxGetData]})); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-peer.done:
+		t.Error("peer was disconnected answering a getdata within the limit")
+	default:
+	}
+}
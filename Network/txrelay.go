@@ -0,0 +1,258 @@
+package Network
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"time"
+)
+
+func (n *Node) mempool() BlockChain.Mempool {
+	return BlockChain.Mempool{Chain: n.Chain}
+}
+
+// queueInventory adds transactions to the next announcement to a peer unless
+// the peer already knows them.
+func (n *Node) queueInventory(peer *Peer, txIDs ...string) {
+	for _, txID := range txIDs {
+		if !peer.known[txID] {
+			peer.inventory[txID] = true
+		}
+	}
+}
+
+func (n *Node) relayTx(txID string, from *Peer) {
+	for peer := range n.peers {
+		if peer != from && peer.handshaked() {
+			n.queueInventory(peer, txID)
+		}
+	}
+}
+
+// trickle announces the queued transactions of every peer whose timer ran
+// out. The delays are random and the batches shuffled so the peer that was
+// told first can not be pinned down as the origin of a transaction.
+func (n *Node) trickle() {
+	now := time.Now()
+
+	for peer := range n.peers {
+		if !peer.handshaked() || now.Before(peer.nextTrickle) {
+			continue
+		}
+
+		interval := TrickleInterval
+		if peer.Inbound {
+			interval = InboundTrickleInterval
+		}
+		peer.nextTrickle = now.Add(time.Duration(n.random.ExpFloat64() * float64(interval)))
+
+		if len(peer.inventory) == 0 {
+			continue
+		}
+
+		var txIDs [][]byte
+		for txID := range peer.inventory {
+			if len(txIDs) == MaxInventory {
+				break
+			}
+			id, _ := hex.DecodeString(txID)
+			txIDs = append(txIDs, id)
+			peer.know(txID)
+		}
+		n.random.Shuffle(len(txIDs), func(i, j int) {
+			txIDs[i], txIDs[j] = txIDs[j], txIDs[i]
+		})
+
+		peer.Send(CommandInv, Inv{txIDs})
+	}
+}
+
+func (n *Node) handleInv(peer *Peer, payload []byte) error {
+	var message Inv
+	if err := decode(payload, &message); err != nil {
+		return err
+	}
+
+	if len(message.TxIDs) > MaxInventory {
+		return misbehaving(ExcessiveScore, "announced %d transactions", len(message.TxIDs))
+	}
+
+	var wanted [][]byte
+	for _, id := range message.TxIDs {
+		txID := hex.EncodeToString(id)
+		peer.know(txID)
+
+		if n.knownTx(id) {
+			continue
+		}
+		if requested, ok := n.txRequests[txID]; ok && time.Since(requested) < TxRequestTimeout {
+			continue
+		}
+
+		n.txRequests[txID] = time.Now()
+		wanted = append(wanted, id)
+	}
+
+	if len(wanted) > 0 {
+		return peer.Send(CommandGetTx, GetTx{wanted})
+	}
+
+	return nil
+}
+
+// knownTx reports transactions in the orphan pool, the mempool or, as far as
+// they have unspent outputs, the chain.
+func (n *Node) knownTx(id []byte) bool {
+	if n.orphans.has(hex.EncodeToString(id)) {
+		return true
+	}
+
+	if _, ok := n.mempool().Get(id); ok {
+		return true
+	}
+
+	_, ok := BlockChain.UTXOSet{Chain: n.Chain}.GetOutputs(id)
+
+	return ok
+}
+
+// handleGetTx only serves transactions that were announced to the peer, so
+// a peer can not probe the mempool for transactions before they trickled out.
+func (n *Node) handleGetTx(peer *Peer, payload []byte) error {
+	var request GetTx
+	if err := decode(payload, &request); err != nil {
+		return err
+	}
+
+	if len(request.TxIDs) > MaxInventory {
+		return misbehaving(ExcessiveScore, "asked for %d transactions", len(request.TxIDs))
+	}
+
+	for _, id := range request.TxIDs {
+		if !peer.known[hex.EncodeToString(id)] {
+			continue
+		}
+
+		entry, ok := n.mempool().Get(id)
+		if !ok {
+			continue
+		}
+
+		if err := peer.Send(CommandTx, TxData{entry.Tx.Serialize()}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleTx bans a peer that relays a transaction breaking the consensus rules,
+// policy rejections cost nothing as other nodes may run other policies.
+func (n *Node) handleTx(peer *Peer, payload []byte) error {
+	var message TxData
+	var tx BlockChain.Transaction
+
+	if err := decode(payload, &message); err != nil {
+		return err
+	}
+	if err := decode(message.Tx, &tx); err != nil {
+		return err
+	}
+
+	txID := hex.EncodeToString(tx.ID)
+	delete(n.txRequests, txID)
+	peer.know(txID)
+
+	if n.knownTx(tx.ID) {
+		return nil
+	}
+
+	err := n.mempool().Add(&tx)
+	if err == BlockChain.ErrMissingInputs {
+		n.addOrphan(&tx, peer)
+		return nil
+	}
+	if _, ok := err.(BlockChain.InvalidTxError); ok {
+		return misbehaving(InvalidScore, "invalid transaction %s: %s", txID, err)
+	}
+	if err != nil {
+		fmt.Printf("Rejected transaction %s from %s: %s\n", txID, peer.Address, err)
+		return nil
+	}
+
+	fmt.Printf("Accepted transaction %s from %s\n", txID, peer.Address)
+	n.relayTx(txID, peer)
+	n.resolveOrphans(txID)
+
+	return nil
+}
+
+// addOrphan keeps a transaction until its parents arrive and asks the peer
+// that sent it for the parents, they are not marked as requested because the
+// peer only hands them out once they were announced to us.
+func (n *Node) addOrphan(tx *BlockChain.Transaction, peer *Peer) {
+	if !n.orphans.add(tx, peer) {
+		return
+	}
+	fmt.Printf("Transaction %x from %s is an orphan, %d orphans\n", tx.ID, peer.Address, len(n.orphans.orphans))
+
+	var parents [][]byte
+	for _, in := range tx.Inputs {
+		parentID := hex.EncodeToString(in.ID)
+		if _, ok := n.txRequests[parentID]; ok || n.knownTx(in.ID) {
+			continue
+		}
+		parents = append(parents, in.ID)
+	}
+
+	if len(parents) > 0 {
+		peer.Send(CommandGetTx, GetTx{parents})
+	}
+}
+
+// resolveOrphans retries the orphans that spend a transaction that just
+// entered the mempool or a block, and in turn the orphans of the ones that
+// are accepted.
+func (n *Node) resolveOrphans(parentIDs ...string) {
+	queue := append([]string{}, parentIDs...)
+
+	for len(queue) > 0 {
+		parentID := queue[0]
+		queue = queue[1:]
+
+		for _, child := range n.orphans.children(parentID) {
+			txID := hex.EncodeToString(child.tx.ID)
+
+			err := n.mempool().Add(child.tx)
+			if err == BlockChain.ErrMissingInputs {
+				continue
+			}
+			n.orphans.remove(txID)
+
+			if _, ok := err.(BlockChain.InvalidTxError); ok {
+				n.misbehave(child.peer, InvalidScore, fmt.Sprintf("invalid orphan transaction %s: %s", txID, err))
+				continue
+			}
+			if err != nil {
+				fmt.Printf("Rejected orphan transaction %s: %s\n", txID, err)
+				continue
+			}
+
+			fmt.Printf("Accepted orphan transaction %s from %s\n", txID, child.peer.Address)
+			n.relayTx(txID, child.peer)
+			queue = append(queue, txID)
+		}
+	}
+}
+
+func (n *Node) expireTxRequests() {
+	for txID, requested := range n.txRequests {
+		if time.Since(requested) >= TxRequestTimeout {
+			delete(n.txRequests, txID)
+		}
+	}
+
+	if expired := n.orphans.expire(n.peers); expired > 0 {
+		fmt.Printf("Dropped %d orphan transactions, %d left\n", expired, len(n.orphans.orphans))
+	}
+}
@@ -0,0 +1,284 @@
+package Stratum
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const noncesPerExtraNonce = 1 << 24
+
+type Client struct {
+	hashes uint64
+	Worker string
+
+	conn        net.Conn
+	mutex       sync.Mutex
+	encoder     *json.Encoder
+	nextID      int64
+	pending     map[int64]string
+	extraNonce1 []byte
+	jobs        chan Job
+}
+
+func Dial(address, worker string) (*Client, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Worker:  worker,
+		conn:    conn,
+		encoder: json.NewEncoder(conn),
+		pending: make(map[int64]string),
+		jobs:    make(chan Job, 1),
+	}
+
+	if err := c.call(MethodSubscribe, nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := c.call(MethodAuthorize, Authorization{worker}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Client) call(method string, params interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = method
+
+	message := Message{ID: &id, Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		message.Params = encoded
+	}
+
+	return c.encoder.Encode(message)
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) Mine(quit <-chan struct{}) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.read()
+	}()
+
+	go func() {
+		<-quit
+		c.conn.Close()
+	}()
+
+	go c.reportHashRate(quit)
+
+	var stop chan struct{}
+	for {
+		select {
+		case job := <-c.jobs:
+			if stop != nil {
+				close(stop)
+			}
+			stop = make(chan struct{})
+
+			work, err := job.Work()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Mining job %s at height %d\n", job.ID, job.Height)
+			go c.search(work, stop)
+		case err := <-done:
+			if stop != nil {
+				close(stop)
+			}
+			select {
+			case <-quit:
+				return nil
+			default:
+				return err
+			}
+		}
+	}
+}
+
+func (c *Client) read() error {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var message Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return err
+		}
+
+		if message.Method == MethodNotify {
+			var job Job
+			if err := json.Unmarshal(message.Params, &job); err != nil {
+				return err
+			}
+			select {
+			case <-c.jobs:
+			default:
+			}
+			c.jobs <- job
+			continue
+		}
+
+		if message.ID == nil {
+			continue
+		}
+
+		c.mutex.Lock()
+		method := c.pending[*message.ID]
+		delete(c.pending, *message.ID)
+		c.mutex.Unlock()
+
+		if err := c.handleResponse(method, message); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return errors.New("server closed the connection")
+}
+
+func (c *Client) handleResponse(method string, message Message) error {
+	switch method {
+	case MethodSubscribe:
+		if message.Error != "" {
+			return errors.New(message.Error)
+		}
+		var subscription Subscription
+		if err := json.Unmarshal(message.Result, &subscription); err != nil {
+			return err
+		}
+		if subscription.ExtraNonce2Size != ExtraNonce2Size {
+			return fmt.Errorf("server uses %d byte extranonce2", subscription.ExtraNonce2Size)
+		}
+		extraNonce1, err := hex.DecodeString(subscription.ExtraNonce1)
+		if err != nil {
+			return err
+		}
+		c.mutex.Lock()
+		c.extraNonce1 = extraNonce1
+		c.mutex.Unlock()
+	case MethodAuthorize:
+		if message.Error != "" {
+			return fmt.Errorf("authorization failed: %s", message.Error)
+		}
+		fmt.Printf("Authorized as %s\n", c.Worker)
+	case MethodSubmit:
+		if message.Error != "" {
+			fmt.Printf("Share rejected: %s\n", message.Error)
+			return nil
+		}
+		var result SubmitResult
+		if err := json.Unmarshal(message.Result, &result); err != nil {
+			return err
+		}
+		if result.Block != "" {
+			fmt.Printf("Share accepted, found block %s\n", result.Block)
+		} else {
+			fmt.Println("Share accepted")
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) search(work *Work, stop <-chan struct{}) {
+	c.mutex.Lock()
+	extraNonce1 := c.extraNonce1
+	c.mutex.Unlock()
+
+	for extraNonce2 := uint32(0); extraNonce2 < math.MaxUint32; extraNonce2++ {
+		extraNonce := extraNonceBytes(extraNonce2, ExtraNonce2Size)
+		merkleRoot := work.MerkleRoot(work.Coinbase(extraNonce1, extraNonce))
+
+		for nonce := 0; nonce < noncesPerExtraNonce; nonce++ {
+			if nonce%4096 == 0 {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+
+			hash := work.Hash(merkleRoot, nonce)
+			atomic.AddUint64(&c.hashes, 1)
+
+			if MeetsTarget(hash, work.ShareTarget) {
+				submission := Submission{c.Worker, work.Job.ID, hex.EncodeToString(extraNonce), nonce}
+				if err := c.call(MethodSubmit, submission); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *Client) reportHashRate(quit <-chan struct{}) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			hashes := atomic.SwapUint64(&c.hashes, 0)
+			fmt.Printf("Hash rate %.0f H/s\n", float64(hashes)/30)
+		}
+	}
+}
+
+func QueryPoolStats(address string) ([]WorkerStats, error) {
+	var stats []WorkerStats
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	id := int64(1)
+	if err := json.NewEncoder(conn).Encode(Message{ID: &id, Method: MethodPoolStats}); err != nil {
+		return nil, err
+	}
+
+	var response Message
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+
+	err = json.Unmarshal(response.Result, &stats)
+
+	return stats, err
+}
@@ -0,0 +1,334 @@
+package Stratum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"github.com/dgraph-io/badger"
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/koushamad/blockchain/Wallet"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPPLNSWindow = 1000
+	DefaultPoolFee     = 1.0
+	HashRateWindow     = 10 * time.Minute
+)
+
+var (
+	SharePrefix  = []byte("poolshare-")
+	PayoutPrefix = []byte("poolpaid-")
+)
+
+type Pool struct {
+	Chain    *BlockChain.Chain
+	Operator string
+	Fee      float64
+	Window   int
+
+	nextShare uint64
+}
+
+type Share struct {
+	Worker     string
+	Difficulty int
+	Height     int
+	Time       int64
+}
+
+type WorkerStats struct {
+	Address  string  `json:"address"`
+	Shares   int     `json:"shares"`
+	HashRate float64 `json:"hashrate"`
+	Pending  int     `json:"pending"`
+	Paid     int     `json:"paid"`
+}
+
+func NewPool(chain *BlockChain.Chain, operator string, fee float64, window int) (*Pool, error) {
+	if !Wallet.ValidateAddress(operator) {
+		return nil, errors.New("operator address is not valid")
+	}
+
+	if fee < 0 || fee > 100 {
+		return nil, errors.New("pool fee must be between 0 and 100 percent")
+	}
+
+	if window < 1 {
+		return nil, errors.New("PPLNS window must hold at least one share")
+	}
+
+	pool := &Pool{Chain: chain, Operator: operator, Fee: fee, Window: window}
+
+	shares := pool.lastShares(1)
+	if len(shares) > 0 {
+		pool.nextShare = shares[0].sequence + 1
+	}
+
+	return pool, nil
+}
+
+func PayoutAddress(worker string) string {
+	return strings.SplitN(worker, ".", 2)[0]
+}
+
+func (p *Pool) Authorize(worker string) error {
+	if !Wallet.ValidateAddress(PayoutAddress(worker)) {
+		return errors.New("pool workers must be named ADDRESS or ADDRESS.NAME")
+	}
+
+	return nil
+}
+
+func shareKey(sequence uint64) []byte {
+	key := make([]byte, len(SharePrefix)+8)
+	copy(key, SharePrefix)
+	binary.BigEndian.PutUint64(key[len(SharePrefix):], sequence)
+
+	return key
+}
+
+func (s Share) Serialize() []byte {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(s)
+	Handler.Handle(err)
+
+	return buffer.Bytes()
+}
+
+func DeserializeShare(data []byte) Share {
+	var share Share
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&share)
+	Handler.Handle(err)
+
+	return share
+}
+
+func (s Share) Work() float64 {
+	return math.Pow(2, float64(s.Difficulty))
+}
+
+func (p *Pool) AddShare(worker string, difficulty, height int) {
+	share := Share{PayoutAddress(worker), difficulty, height, time.Now().Unix()}
+
+	err := p.Chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(shareKey(p.nextShare), share.Serialize())
+	})
+	Handler.Handle(err)
+
+	p.nextShare++
+}
+
+type storedShare struct {
+	Share
+	sequence uint64
+}
+
+func (p *Pool) lastShares(count int) []storedShare {
+	var shares []storedShare
+
+	err := p.Chain.Database.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		end := append(append([]byte{}, SharePrefix...), 0xff)
+		for it.Seek(end); it.ValidForPrefix(SharePrefix) && len(shares) < count; it.Next() {
+			item := it.Item()
+			sequence := binary.BigEndian.Uint64(item.Key()[len(SharePrefix):])
+
+			if err := item.Value(func(val []byte) error {
+				shares = append(shares, storedShare{DeserializeShare(val), sequence})
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	Handler.Handle(err)
+
+	return shares
+}
+
+func (p *Pool) Payouts(reward int) []BlockChain.Payment {
+	var payments []BlockChain.Payment
+	var addresses []string
+
+	work := make(map[string]float64)
+	totalWork := 0.0
+	for _, share := range p.lastShares(p.Window) {
+		if _, ok := work[share.Worker]; !ok {
+			addresses = append(addresses, share.Worker)
+		}
+		work[share.Worker] += share.Work()
+		totalWork += share.Work()
+	}
+	sort.Strings(addresses)
+
+	distributable := int(float64(reward) * (100 - p.Fee) / 100)
+	paid := 0
+
+	for _, address := range addresses {
+		amount := int(float64(distributable) * work[address] / totalWork)
+		if amount == 0 {
+			continue
+		}
+		payments = append(payments, BlockChain.Payment{Address: address, Amount: amount})
+		paid += amount
+	}
+
+	if reward > paid {
+		payments = append(payments, BlockChain.Payment{Address: p.Operator, Amount: reward - paid})
+	}
+
+	return payments
+}
+
+func (p *Pool) Coinbase(fees int, data string) *BlockChain.Transaction {
+	return BlockChain.NewPayoutCoinbaseTX(p.Payouts(BlockChain.BlockSubsidy+fees), data)
+}
+
+func (p *Pool) BlockFound(block *BlockChain.Block) {
+	coinbase := block.Transactions[0]
+	paid := p.paid()
+
+	for _, out := range coinbase.Outputs {
+		address := BlockChain.ScriptAddress(out.ScriptPubKey)
+		paid[address] += out.Value
+	}
+
+	err := p.Chain.Database.Update(func(txn *badger.Txn) error {
+		for address, amount := range paid {
+			value := make([]byte, 8)
+			binary.BigEndian.PutUint64(value, uint64(amount))
+			if err := txn.Set(append(append([]byte{}, PayoutPrefix...), address...), value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	Handler.Handle(err)
+
+	p.prune()
+}
+
+func (p *Pool) paid() map[string]int {
+	paid := make(map[string]int)
+
+	err := p.Chain.Database.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(PayoutPrefix); it.ValidForPrefix(PayoutPrefix); it.Next() {
+			item := it.Item()
+			address := string(bytes.TrimPrefix(item.KeyCopy(nil), PayoutPrefix))
+
+			if err := item.Value(func(val []byte) error {
+				paid[address] = int(binary.BigEndian.Uint64(val))
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	Handler.Handle(err)
+
+	return paid
+}
+
+func (p *Pool) prune() {
+	shares := p.lastShares(p.Window)
+	if len(shares) < p.Window {
+		return
+	}
+	oldest := shares[len(shares)-1].sequence
+
+	err := p.Chain.Database.Update(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		var stale [][]byte
+		for it.Seek(SharePrefix); it.ValidForPrefix(SharePrefix); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if binary.BigEndian.Uint64(key[len(SharePrefix):]) >= oldest {
+				break
+			}
+			stale = append(stale, key)
+		}
+
+		for _, key := range stale {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	Handler.Handle(err)
+}
+
+func (p *Pool) Stats() []WorkerStats {
+	var stats []WorkerStats
+
+	workers := make(map[string]*WorkerStats)
+	worker := func(address string) *WorkerStats {
+		if _, ok := workers[address]; !ok {
+			workers[address] = &WorkerStats{Address: address}
+		}
+		return workers[address]
+	}
+
+	now := time.Now().Unix()
+	since := now - int64(HashRateWindow/time.Second)
+	first := now
+
+	for _, share := range p.lastShares(p.Window) {
+		w := worker(share.Worker)
+		w.Shares++
+
+		if share.Time >= since {
+			w.HashRate += share.Work()
+			if share.Time < first {
+				first = share.Time
+			}
+		}
+	}
+
+	elapsed := float64(now - first)
+	if elapsed < 1 {
+		elapsed = 1
+	}
+
+	for _, w := range workers {
+		w.HashRate /= elapsed
+	}
+
+	_, fees := BlockChain.Miner{Chain: p.Chain}.Template()
+	for _, payment := range p.Payouts(BlockChain.BlockSubsidy + fees) {
+		worker(payment.Address).Pending = payment.Amount
+	}
+
+	for address, amount := range p.paid() {
+		worker(address).Paid = amount
+	}
+
+	for _, w := range workers {
+		stats = append(stats, *w)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Address < stats[j].Address })
+
+	return stats
+}
@@ -0,0 +1,90 @@
+package Stratum
+
+import (
+	"fmt"
+	"github.com/koushamad/blockchain/Wallet"
+	"testing"
+)
+
+func TestPoolShares(t *testing.T) {
+	server := newTestServer(t)
+	operator := string(Wallet.MakeWallet().Address())
+	alice := string(Wallet.MakeWallet().Address())
+	bob := string(Wallet.MakeWallet().Address())
+
+	pool, err := NewPool(server.Miner.Chain, operator, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Pool = pool
+	c := &client{extraNonce1: []byte{0, 0, 0, 1}}
+
+	if err := server.newJob(true); err != nil {
+		t.Fatal(err)
+	}
+	first := server.job
+
+	share := func(job *serverJob, worker string, extraNonce2 byte) Submission {
+		return Submission{
+			Worker:      worker,
+			JobID:       job.work.Job.ID,
+			ExtraNonce2: fmt.Sprintf("%08x", extraNonce2),
+			Nonce:       shareNonce(job, c, []byte{0, 0, 0, extraNonce2}),
+		}
+	}
+
+	valid := []Submission{share(first, alice+".rig1", 1), share(first, alice+".rig2", 2), share(first, alice, 3), share(first, bob, 4)}
+	for i, submission := range valid {
+		if _, err := server.submit(c, submission); err != nil {
+			t.Fatalf("share %d rejected: %s", i, err)
+		}
+	}
+
+	if _, err := server.submit(c, valid[0]); err == nil || err.Error() != "duplicate share" {
+		t.Errorf("resubmitted share gave %v, want a duplicate share", err)
+	}
+	if err := server.newJob(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.submit(c, share(first, bob, 5)); err == nil || err.Error() != "stale job" {
+		t.Errorf("share for a replaced job gave %v, want a stale job", err)
+	}
+	if shares := len(pool.lastShares(100)); shares != len(valid) {
+		t.Errorf("pool stored %d shares, want %d", shares, len(valid))
+	}
+
+	// Only the last three shares are in the window, alice has two and bob one
+	// of them, and the operator keeps the 10% fee and the rounding.
+	payouts := make(map[string]int)
+	for _, payment := range pool.Payouts(100) {
+		payouts[payment.Address] += payment.Amount
+	}
+	for address, amount := range map[string]int{alice: 60, bob: 30, operator: 10} {
+		if payouts[address] != amount {
+			t.Errorf("%s gets %d of the reward, want %d", address, payouts[address], amount)
+		}
+	}
+
+	job := server.job
+	extraNonce2 := []byte{0, 0, 0, 6}
+	root := job.work.MerkleRoot(job.work.Coinbase(c.extraNonce1, extraNonce2))
+	nonce := 0
+	for !MeetsTarget(job.work.Hash(root, nonce), job.work.Target) {
+		nonce++
+	}
+
+	result, err := server.submit(c, Submission{Worker: bob, JobID: job.work.Job.ID, ExtraNonce2: "00000006", Nonce: nonce})
+	if err != nil || result.Block == "" {
+		t.Fatalf("solved share gave %+v %v, want a block", result, err)
+	}
+
+	paid := pool.paid()
+	for address, amount := range map[string]int{alice: 12, bob: 6, operator: 2} {
+		if paid[address] != amount {
+			t.Errorf("%s was paid %d, want %d", address, paid[address], amount)
+		}
+	}
+	if shares := len(pool.lastShares(100)); shares != pool.Window {
+		t.Errorf("pool kept %d shares after the block, want the window of %d", shares, pool.Window)
+	}
+}
@@ -0,0 +1,149 @@
+package Stratum
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/koushamad/blockchain/BlockChain"
+	"math/big"
+	"time"
+)
+
+const (
+	ExtraNonce1Size        = 4
+	ExtraNonce2Size        = 4
+	DefaultShareDifficulty = 12
+	DefaultAddress         = "localhost:3333"
+	JobRefreshInterval     = 30 * time.Second
+	MaxActiveJobs          = 4
+
+	MethodSubscribe = "mining.subscribe"
+	MethodAuthorize = "mining.authorize"
+	MethodNotify    = "mining.notify"
+	MethodSubmit    = "mining.submit"
+	MethodPoolStats = "pool.stats"
+)
+
+type Message struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type Subscription struct {
+	ExtraNonce1     string `json:"extranonce1"`
+	ExtraNonce2Size int    `json:"extranonce2_size"`
+}
+
+type Authorization struct {
+	Worker string `json:"worker"`
+}
+
+type Submission struct {
+	Worker      string `json:"worker"`
+	JobID       string `json:"job_id"`
+	ExtraNonce2 string `json:"extranonce2"`
+	Nonce       int    `json:"nonce"`
+}
+
+type SubmitResult struct {
+	Accepted bool   `json:"accepted"`
+	Block    string `json:"block,omitempty"`
+}
+
+type Job struct {
+	ID              string   `json:"job_id"`
+	PrevHash        string   `json:"prev_hash"`
+	Coinbase        string   `json:"coinbase"`
+	MerkleBranch    []string `json:"merkle_branch"`
+	Height          int      `json:"height"`
+	Timestamp       int64    `json:"timestamp"`
+	Algorithm       string   `json:"algorithm"`
+	Difficulty      int      `json:"difficulty"`
+	ShareDifficulty int      `json:"share_difficulty"`
+	Clean           bool     `json:"clean"`
+}
+
+type Work struct {
+	Job         Job
+	PrevHash    []byte
+	Branch      [][]byte
+	Target      *big.Int
+	ShareTarget *big.Int
+	Algorithm   BlockChain.PowAlgorithm
+	coinbase    BlockChain.Transaction
+}
+
+func (j Job) Work() (*Work, error) {
+	work := &Work{
+		Job:         j,
+		Target:      BlockChain.Target(j.Difficulty),
+		ShareTarget: BlockChain.Target(j.ShareDifficulty),
+	}
+
+	algorithm, err := BlockChain.PowAlgorithmByName(j.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	work.Algorithm = algorithm
+
+	prevHash, err := hex.DecodeString(j.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	work.PrevHash = prevHash
+
+	coinbase, err := hex.DecodeString(j.Coinbase)
+	if err != nil {
+		return nil, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(coinbase)).Decode(&work.coinbase); err != nil {
+		return nil, err
+	}
+
+	for _, node := range j.MerkleBranch {
+		hash, err := hex.DecodeString(node)
+		if err != nil {
+			return nil, err
+		}
+		work.Branch = append(work.Branch, hash)
+	}
+
+	return work, nil
+}
+
+func (w *Work) Coinbase(extraNonce1, extraNonce2 []byte) *BlockChain.Transaction {
+	coinbase := w.coinbase
+	input := coinbase.Inputs[0]
+
+	input.ScriptSig = append(append(append([]byte{}, input.ScriptSig...), extraNonce1...), extraNonce2...)
+	coinbase.Inputs = []BlockChain.TxInput{input}
+	coinbase.ID = coinbase.Hash()
+
+	return &coinbase
+}
+
+func (w *Work) MerkleRoot(coinbase *BlockChain.Transaction) []byte {
+	return BlockChain.MerkleRootFromBranch(coinbase.HashData(), 0, w.Branch)
+}
+
+func (w *Work) Hash(merkleRoot []byte, nonce int) []byte {
+	return w.Algorithm.Hash(BlockChain.HeaderData(w.PrevHash, merkleRoot, w.Job.Timestamp, w.Job.Height, nonce, w.Job.Difficulty))
+}
+
+func MeetsTarget(hash []byte, target *big.Int) bool {
+	return new(big.Int).SetBytes(hash).Cmp(target) == -1
+}
+
+func extraNonceBytes(value uint32, size int) []byte {
+	data := make([]byte, size)
+	for i := size - 1; i >= 0 && value > 0; i-- {
+		data[i] = byte(value)
+		value >>= 8
+	}
+
+	return data
+}
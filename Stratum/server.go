@@ -0,0 +1,384 @@
+package Stratum
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/koushamad/blockchain/BlockChain"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Server struct {
+	Miner           BlockChain.Miner
+	ShareDifficulty int
+	Shares          map[string]int
+	Pool            *Pool
+
+	mutex          sync.Mutex
+	listener       net.Listener
+	clients        map[*client]bool
+	jobs           map[string]*serverJob
+	jobOrder       []string
+	job            *serverJob
+	nextJob        uint64
+	nextExtraNonce uint32
+	algorithm      BlockChain.PowAlgorithm
+}
+
+// serverJob remembers the shares submitted for it, they go away with the job
+// once it is retired.
+type serverJob struct {
+	work         *Work
+	transactions []*BlockChain.Transaction
+	seen         map[string]bool
+}
+
+type client struct {
+	conn        net.Conn
+	mutex       sync.Mutex
+	encoder     *json.Encoder
+	extraNonce1 []byte
+	workers     map[string]bool
+}
+
+func NewServer(miner BlockChain.Miner, shareDifficulty int) *Server {
+	return &Server{
+		Miner:           miner,
+		ShareDifficulty: shareDifficulty,
+		Shares:          make(map[string]int),
+		clients:         make(map[*client]bool),
+		jobs:            make(map[string]*serverJob),
+	}
+}
+
+func (s *Server) ListenAndServe(address string, quit <-chan struct{}) error {
+	pow, ok := s.Miner.Chain.Consensus.(BlockChain.ProofOfWorkConsensus)
+	if !ok {
+		return errors.New("the work server needs a proof of work chain")
+	}
+
+	algorithm, err := pow.PowAlgorithm()
+	if err != nil {
+		return err
+	}
+	s.algorithm = algorithm
+
+	if s.ShareDifficulty > algorithm.Difficulty() {
+		return fmt.Errorf("share difficulty %d is above the block difficulty %d", s.ShareDifficulty, algorithm.Difficulty())
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.listener = listener
+	err = s.newJob(true)
+	s.mutex.Unlock()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	fmt.Printf("Work server listening on %s\n", listener.Addr())
+
+	go func() {
+		<-quit
+		listener.Close()
+	}()
+
+	if s.Pool != nil {
+		go s.refreshJobs(quit)
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-quit:
+				s.closeClients()
+				return nil
+			default:
+				return err
+			}
+		}
+
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) closeClients() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for c := range s.clients {
+		c.conn.Close()
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	c := &client{conn: conn, encoder: json.NewEncoder(conn), workers: make(map[string]bool)}
+
+	s.mutex.Lock()
+	s.nextExtraNonce++
+	c.extraNonce1 = extraNonceBytes(s.nextExtraNonce, ExtraNonce1Size)
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.clients, c)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	fmt.Printf("Miner connected from %s\n", conn.RemoteAddr())
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var request Message
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			c.send(Message{Error: "malformed message"})
+			continue
+		}
+
+		result, err := s.handle(c, request)
+		response := Message{ID: request.ID}
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Result, _ = json.Marshal(result)
+		}
+		c.send(response)
+
+		if request.Method == MethodSubscribe && err == nil {
+			s.mutex.Lock()
+			s.clients[c] = true
+			job := s.job.work.Job
+			s.mutex.Unlock()
+			c.notify(job)
+		}
+	}
+
+	fmt.Printf("Miner %s disconnected\n", conn.RemoteAddr())
+}
+
+func (s *Server) handle(c *client, request Message) (interface{}, error) {
+	switch request.Method {
+	case MethodSubscribe:
+		return Subscription{hex.EncodeToString(c.extraNonce1), ExtraNonce2Size}, nil
+	case MethodAuthorize:
+		var auth Authorization
+		if err := json.Unmarshal(request.Params, &auth); err != nil || auth.Worker == "" {
+			return nil, errors.New("authorize needs a worker name")
+		}
+		if s.Pool != nil {
+			if err := s.Pool.Authorize(auth.Worker); err != nil {
+				return nil, err
+			}
+		}
+		c.workers[auth.Worker] = true
+		return true, nil
+	case MethodSubmit:
+		var submission Submission
+		if err := json.Unmarshal(request.Params, &submission); err != nil {
+			return nil, errors.New("malformed submission")
+		}
+		if !c.workers[submission.Worker] {
+			return nil, errors.New("worker is not authorized")
+		}
+		return s.submit(c, submission)
+	case MethodPoolStats:
+		if s.Pool == nil {
+			return nil, errors.New("server is not running a pool")
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return s.Pool.Stats(), nil
+	}
+
+	return nil, fmt.Errorf("unknown method %s", request.Method)
+}
+
+func (s *Server) submit(c *client, submission Submission) (SubmitResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[submission.JobID]
+	if !ok {
+		return SubmitResult{}, errors.New("stale job")
+	}
+
+	extraNonce2, err := hex.DecodeString(submission.ExtraNonce2)
+	if err != nil || len(extraNonce2) != ExtraNonce2Size {
+		return SubmitResult{}, fmt.Errorf("extranonce2 must be %d hex bytes", ExtraNonce2Size)
+	}
+
+	share := fmt.Sprintf("%x:%x:%d", c.extraNonce1, extraNonce2, submission.Nonce)
+	if job.seen[share] {
+		return SubmitResult{}, errors.New("duplicate share")
+	}
+
+	coinbase := job.work.Coinbase(c.extraNonce1, extraNonce2)
+	hash := job.work.Hash(job.work.MerkleRoot(coinbase), submission.Nonce)
+
+	if !MeetsTarget(hash, job.work.ShareTarget) {
+		return SubmitResult{}, errors.New("share is above the target")
+	}
+
+	job.seen[share] = true
+	s.Shares[submission.Worker]++
+	if s.Pool != nil {
+		s.Pool.AddShare(submission.Worker, job.work.Job.ShareDifficulty, job.work.Job.Height)
+	}
+	result := SubmitResult{Accepted: true}
+
+	if !MeetsTarget(hash, job.work.Target) {
+		return result, nil
+	}
+
+	block := &BlockChain.Block{
+		Hash:         hash,
+		Transactions: append([]*BlockChain.Transaction{coinbase}, job.transactions...),
+		PrevHash:     job.work.PrevHash,
+		Nonce:        submission.Nonce,
+		Height:       job.work.Job.Height,
+		Timestamp:    job.work.Job.Timestamp,
+		Algorithm:    job.work.Algorithm.Name(),
+	}
+
+	if err := s.Miner.SubmitBlock(block); err != nil {
+		return result, fmt.Errorf("share accepted but block rejected: %s", err)
+	}
+
+	fmt.Printf("Block %d %x found by %s\n", block.Height, block.Hash, submission.Worker)
+	result.Block = hex.EncodeToString(block.Hash)
+
+	if s.Pool != nil {
+		s.Pool.BlockFound(block)
+	}
+
+	if err := s.newJob(true); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (s *Server) refreshJobs(quit <-chan struct{}) {
+	ticker := time.NewTicker(JobRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			s.mutex.Lock()
+			err := s.newJob(false)
+			s.mutex.Unlock()
+			if err != nil {
+				fmt.Printf("Could not refresh the job: %s\n", err)
+			}
+		}
+	}
+}
+
+func (s *Server) coinbase(fees, height int) (*BlockChain.Transaction, error) {
+	data := fmt.Sprintf("height %d ", height)
+
+	if s.Pool != nil {
+		return s.Pool.Coinbase(fees, data), nil
+	}
+
+	return s.Miner.Coinbase(fees, data)
+}
+
+func (s *Server) newJob(clean bool) error {
+	transactions, fees := s.Miner.Template()
+	height := s.Miner.Chain.GetBestHeight() + 1
+
+	coinbase, err := s.coinbase(fees, height)
+	if err != nil {
+		return err
+	}
+
+	timestamp, err := s.Miner.Chain.NextBlockTime(s.Miner.Chain.LastHash)
+	if err != nil {
+		return err
+	}
+
+	leaves := [][]byte{coinbase.HashData()}
+	for _, tx := range transactions {
+		leaves = append(leaves, tx.HashData())
+	}
+
+	var branch []string
+	for _, node := range BlockChain.MerkleBranch(leaves, 0) {
+		branch = append(branch, hex.EncodeToString(node))
+	}
+
+	s.nextJob++
+	job := Job{
+		ID:              strconv.FormatUint(s.nextJob, 16),
+		PrevHash:        hex.EncodeToString(s.Miner.Chain.LastHash),
+		Coinbase:        hex.EncodeToString(coinbase.Serialize()),
+		MerkleBranch:    branch,
+		Height:          height,
+		Timestamp:       timestamp,
+		Algorithm:       s.algorithm.Name(),
+		Difficulty:      s.algorithm.Difficulty(),
+		ShareDifficulty: s.ShareDifficulty,
+		Clean:           clean,
+	}
+
+	work, err := job.Work()
+	if err != nil {
+		return err
+	}
+
+	s.job = &serverJob{work, transactions, make(map[string]bool)}
+	if clean {
+		s.jobs = make(map[string]*serverJob)
+		s.jobOrder = nil
+	}
+	s.jobs[job.ID] = s.job
+	s.jobOrder = append(s.jobOrder, job.ID)
+	s.retireJobs()
+
+	fmt.Printf("New job %s at height %d with %d transactions\n", job.ID, height, len(transactions))
+
+	for c := range s.clients {
+		go c.notify(job)
+	}
+
+	return nil
+}
+
+// retireJobs forgets the oldest jobs beyond MaxActiveJobs along with their
+// shares, shares for them are stale from then on.
+func (s *Server) retireJobs() {
+	for len(s.jobOrder) > MaxActiveJobs {
+		delete(s.jobs, s.jobOrder[0])
+		s.jobOrder = s.jobOrder[1:]
+	}
+}
+
+func (c *client) send(message Message) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.encoder.Encode(message); err != nil {
+		c.conn.Close()
+	}
+}
+
+func (c *client) notify(job Job) {
+	params, _ := json.Marshal(job)
+	c.send(Message{Method: MethodNotify, Params: params})
+}
@@ -0,0 +1,105 @@
+package Stratum
+
+import (
+	"github.com/koushamad/blockchain/BlockChain"
+	"github.com/koushamad/blockchain/Wallet"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	params := BlockChain.TestNetParams
+	params.DBPath = t.TempDir()
+
+	address := string(Wallet.MakeWallet().Address())
+	chain := BlockChain.InitBlockChain(address, &params)
+	t.Cleanup(func() { chain.Database.Close() })
+	BlockChain.UTXOSet{Chain: chain}.Reindex()
+
+	server := NewServer(BlockChain.Miner{Chain: chain, RewardAddress: address}, 1)
+	algorithm, err := BlockChain.PowAlgorithmByName(params.PowAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.algorithm = algorithm
+
+	return server
+}
+
+// shareNonce finds a nonce that makes a share of the job without solving
+// the block, so submitting it does not start a new job.
+func shareNonce(job *serverJob, c *client, extraNonce2 []byte) int {
+	root := job.work.MerkleRoot(job.work.Coinbase(c.extraNonce1, extraNonce2))
+
+	for nonce := 0; ; nonce++ {
+		hash := job.work.Hash(root, nonce)
+		if MeetsTarget(hash, job.work.ShareTarget) && !MeetsTarget(hash, job.work.Target) {
+			return nonce
+		}
+	}
+}
+
+func TestServerRetiresJobs(t *testing.T) {
+	server := newTestServer(t)
+	c := &client{extraNonce1: []byte{0, 0, 0, 1}}
+	extraNonce2 := []byte{0, 0, 0, 0}
+
+	if err := server.newJob(true); err != nil {
+		t.Fatal(err)
+	}
+	first := server.job
+	submission := Submission{Worker: "worker", JobID: first.work.Job.ID, ExtraNonce2: "00000000", Nonce: shareNonce(first, c, extraNonce2)}
+
+	if _, err := server.submit(c, submission); err != nil {
+		t.Fatalf("first share rejected: %s", err)
+	}
+	if _, err := server.submit(c, submission); err == nil || err.Error() != "duplicate share" {
+		t.Fatalf("resubmitted share gave %v, want a duplicate share", err)
+	}
+
+	for i := 0; i < 2*MaxActiveJobs; i++ {
+		if err := server.newJob(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(server.jobs) != MaxActiveJobs || len(server.jobOrder) != MaxActiveJobs {
+		t.Errorf("server keeps %d jobs in order of %d, want %d", len(server.jobs), len(server.jobOrder), MaxActiveJobs)
+	}
+	if _, err := server.submit(c, submission); err == nil || err.Error() != "stale job" {
+		t.Errorf("share for a retired job gave %v, want a stale job", err)
+	}
+
+	if err := server.newJob(true); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.jobs) != 1 || len(server.jobOrder) != 1 {
+		t.Errorf("clean job left %d jobs", len(server.jobs))
+	}
+}
+
+func TestServerSubmitsBlocks(t *testing.T) {
+	server := newTestServer(t)
+	c := &client{extraNonce1: []byte{0, 0, 0, 1}}
+	extraNonce2 := []byte{0, 0, 0, 0}
+
+	if err := server.newJob(true); err != nil {
+		t.Fatal(err)
+	}
+	job := server.job
+	root := job.work.MerkleRoot(job.work.Coinbase(c.extraNonce1, extraNonce2))
+
+	nonce := 0
+	for !MeetsTarget(job.work.Hash(root, nonce), job.work.Target) {
+		nonce++
+	}
+
+	result, err := server.submit(c, Submission{Worker: "worker", JobID: job.work.Job.ID, ExtraNonce2: "00000000", Nonce: nonce})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Block == "" || server.Miner.Chain.GetBestHeight() != 1 {
+		t.Errorf("solved share gave %+v at height %d, want a block at height 1", result, server.Miner.Chain.GetBestHeight())
+	}
+}
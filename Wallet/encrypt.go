@@ -0,0 +1,113 @@
+package Wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"golang.org/x/crypto/scrypt"
+	"os"
+)
+
+const (
+	PassphraseEnv    = "BLOCKCHAIN_WALLET_PASSPHRASE"
+	NewPassphraseEnv = "BLOCKCHAIN_WALLET_NEW_PASSPHRASE"
+	saltLength       = 16
+	passphraseN      = 32768
+	passphraseR      = 8
+)
+
+var (
+	ErrWalletLocked = errors.New("wallet is encrypted and locked, set " + PassphraseEnv + " to unlock it")
+	encryptedMagic  = []byte("encrypted wallet\n")
+)
+
+type encryptedWallets struct {
+	Salt  []byte
+	Nonce []byte
+	Data  []byte
+}
+
+// Encrypt protects the wallet file with a passphrase from the next save on.
+// A locked wallet can not be loaded at all, so without the passphrase no key
+// can be exported or used to sign.
+func (ws *Wallets) Encrypt(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("passphrase is empty")
+	}
+	ws.passphrase = passphrase
+
+	return nil
+}
+
+func (ws *Wallets) Encrypted() bool {
+	return ws.passphrase != ""
+}
+
+func walletCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, passphraseN, passphraseR, 1, KeyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encryptWallets(content []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := walletCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.NewBuffer(append([]byte{}, encryptedMagic...))
+	err = gob.NewEncoder(buffer).Encode(encryptedWallets{salt, nonce, aead.Seal(nil, nonce, content, encryptedMagic)})
+
+	return buffer.Bytes(), err
+}
+
+// decryptWallets returns the content of an unencrypted wallet file as it is,
+// an encrypted one is unlocked with the passphrase from PassphraseEnv.
+func decryptWallets(content []byte) ([]byte, string, error) {
+	if !bytes.HasPrefix(content, encryptedMagic) {
+		return content, "", nil
+	}
+
+	passphrase := os.Getenv(PassphraseEnv)
+	if passphrase == "" {
+		return nil, "", ErrWalletLocked
+	}
+
+	var encrypted encryptedWallets
+	if err := gob.NewDecoder(bytes.NewReader(content[len(encryptedMagic):])).Decode(&encrypted); err != nil {
+		return nil, "", err
+	}
+
+	aead, err := walletCipher(passphrase, encrypted.Salt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	plain, err := aead.Open(nil, encrypted.Nonce, encrypted.Data, encryptedMagic)
+	if err != nil {
+		return nil, "", errors.New("wallet passphrase is wrong")
+	}
+
+	return plain, passphrase, nil
+}
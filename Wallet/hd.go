@@ -0,0 +1,253 @@
+package Wallet
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"github.com/koushamad/blockchain/Handler"
+	"github.com/mr-tron/base58"
+	"math/big"
+)
+
+const (
+	HardenedKeyStart = uint32(0x80000000)
+	SeedLength       = 32
+	ExternalChain    = uint32(0)
+	InternalChain    = uint32(1)
+	extendedKeyLen   = 4 + 1 + 4 + 4 + KeyLength + 2*KeyLength
+)
+
+// The keys are derived on P-256 and not on secp256k1 like BIP32, so they have
+// their own version bytes and encode to strings starting with pprv and ppub
+// that no BIP32 wallet takes for its own.
+var (
+	masterKey            = []byte("Blockchain seed")
+	ExtendedPrivateMagic = []byte{0x39, 0xb6, 0x2f, 0x16}
+	ExtendedPublicMagic  = []byte{0x39, 0xb6, 0x6d, 0xe9}
+	bip32PrivateMagic    = []byte{0x04, 0x88, 0xad, 0xe4}
+	bip32PublicMagic     = []byte{0x04, 0x88, 0xb2, 0x1e}
+)
+
+type ExtendedKey struct {
+	Key               []byte
+	ChainCode         []byte
+	Depth             byte
+	ParentFingerprint []byte
+	Index             uint32
+	Private           bool
+}
+
+func NewSeed() []byte {
+	seed := make([]byte, SeedLength)
+
+	_, err := rand.Read(seed)
+	Handler.Handle(err)
+
+	return seed
+}
+
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	hasher := hmac.New(sha512.New, masterKey)
+	hasher.Write(seed)
+	sum := hasher.Sum(nil)
+
+	d := new(big.Int).SetBytes(sum[:KeyLength])
+	if d.Sign() == 0 || d.Cmp(elliptic.P256().Params().N) >= 0 {
+		return nil, errors.New("seed produces an invalid master key")
+	}
+
+	return &ExtendedKey{
+		Key:               sum[:KeyLength],
+		ChainCode:         sum[KeyLength:],
+		ParentFingerprint: make([]byte, 4),
+		Private:           true,
+	}, nil
+}
+
+func (k *ExtendedKey) PublicKey() []byte {
+	if !k.Private {
+		return k.Key
+	}
+
+	private := PrivateKeyFromBytes(k.Key)
+
+	return PublicKeyBytes(private.PublicKey)
+}
+
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if index >= HardenedKeyStart && !k.Private {
+		return nil, errors.New("cannot derive a hardened key from a public key")
+	}
+
+	data := make([]byte, 0, 2*KeyLength+4)
+	if index >= HardenedKeyStart {
+		data = append(data, 0x00)
+		data = append(data, k.Key...)
+	} else {
+		data = append(data, k.PublicKey()...)
+	}
+	data = append(data, uint32Bytes(index)...)
+
+	hasher := hmac.New(sha512.New, k.ChainCode)
+	hasher.Write(data)
+	sum := hasher.Sum(nil)
+
+	curve := elliptic.P256()
+	n := curve.Params().N
+	il := new(big.Int).SetBytes(sum[:KeyLength])
+	if il.Cmp(n) >= 0 {
+		return nil, errors.New("derived key is invalid, use the next index")
+	}
+
+	child := ExtendedKey{
+		ChainCode:         sum[KeyLength:],
+		Depth:             k.Depth + 1,
+		ParentFingerprint: PublicKeyHash(k.PublicKey())[:4],
+		Index:             index,
+		Private:           k.Private,
+	}
+
+	if k.Private {
+		d := new(big.Int).Add(il, new(big.Int).SetBytes(k.Key))
+		d.Mod(d, n)
+		if d.Sign() == 0 {
+			return nil, errors.New("derived key is invalid, use the next index")
+		}
+		child.Key = PaddedBytes(d)
+	} else {
+		parent, err := ParsePublicKey(k.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		x, y := curve.ScalarBaseMult(sum[:KeyLength])
+		x, y = curve.Add(x, y, parent.X, parent.Y)
+		if x.Sign() == 0 && y.Sign() == 0 {
+			return nil, errors.New("derived key is invalid, use the next index")
+		}
+		child.Key = append(PaddedBytes(x), PaddedBytes(y)...)
+	}
+
+	return &child, nil
+}
+
+func (k *ExtendedKey) Derive(path ...uint32) (*ExtendedKey, error) {
+	key := k
+
+	for _, index := range path {
+		child, err := key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+		key = child
+	}
+
+	return key, nil
+}
+
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.Private {
+		return k
+	}
+
+	return &ExtendedKey{
+		Key:               k.PublicKey(),
+		ChainCode:         k.ChainCode,
+		Depth:             k.Depth,
+		ParentFingerprint: k.ParentFingerprint,
+		Index:             k.Index,
+	}
+}
+
+func (k *ExtendedKey) Wallet() (*Wallet, error) {
+	if !k.Private {
+		return nil, errors.New("extended key is public")
+	}
+
+	return &Wallet{PrivateKeyFromBytes(k.Key), k.PublicKey()}, nil
+}
+
+func (k *ExtendedKey) String() string {
+	payload := make([]byte, 0, extendedKeyLen+ChecksumLength)
+
+	if k.Private {
+		payload = append(payload, ExtendedPrivateMagic...)
+	} else {
+		payload = append(payload, ExtendedPublicMagic...)
+	}
+
+	payload = append(payload, k.Depth)
+	payload = append(payload, k.ParentFingerprint...)
+	payload = append(payload, uint32Bytes(k.Index)...)
+	payload = append(payload, k.ChainCode...)
+	if k.Private {
+		payload = append(payload, make([]byte, KeyLength)...)
+	}
+	payload = append(payload, k.Key...)
+	payload = append(payload, Checksum(payload)...)
+
+	return string(Base58Encode(payload))
+}
+
+func ParseExtendedKey(key string) (*ExtendedKey, error) {
+	if len(key) == 0 {
+		return nil, errors.New("extended key is empty")
+	}
+
+	payload, err := base58.Decode(key)
+	if err != nil {
+		return nil, errors.New("extended key is not base58 encoded")
+	}
+
+	if len(payload) != extendedKeyLen+ChecksumLength {
+		return nil, errors.New("extended key has invalid length")
+	}
+
+	data := payload[:extendedKeyLen]
+	if !bytes.Equal(Checksum(data), payload[extendedKeyLen:]) {
+		return nil, errors.New("extended key has an invalid checksum")
+	}
+
+	extended := ExtendedKey{
+		Depth:             data[4],
+		ParentFingerprint: data[5:9],
+		Index:             binary.BigEndian.Uint32(data[9:13]),
+		ChainCode:         data[13 : 13+KeyLength],
+	}
+
+	keyData := data[13+KeyLength:]
+	switch {
+	case bytes.Equal(data[:4], ExtendedPrivateMagic):
+		if !bytes.Equal(keyData[:KeyLength], make([]byte, KeyLength)) {
+			return nil, errors.New("extended private key has a nonzero padding")
+		}
+		d := new(big.Int).SetBytes(keyData[KeyLength:])
+		if d.Sign() == 0 || d.Cmp(elliptic.P256().Params().N) >= 0 {
+			return nil, errors.New("extended private key is out of range")
+		}
+		extended.Private = true
+		extended.Key = keyData[KeyLength:]
+	case bytes.Equal(data[:4], ExtendedPublicMagic):
+		if _, err := ParsePublicKey(keyData); err != nil {
+			return nil, err
+		}
+		extended.Key = keyData
+	case bytes.Equal(data[:4], bip32PrivateMagic), bytes.Equal(data[:4], bip32PublicMagic):
+		return nil, errors.New("extended key has BIP32 secp256k1 version bytes, P-256 keys use pprv and ppub")
+	default:
+		return nil, errors.New("unknown extended key version")
+	}
+
+	return &extended, nil
+}
+
+func uint32Bytes(value uint32) []byte {
+	buffer := make([]byte, 4)
+	binary.BigEndian.PutUint32(buffer, value)
+
+	return buffer
+}
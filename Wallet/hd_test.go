@@ -0,0 +1,85 @@
+package Wallet
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExtendedKeyVersions(t *testing.T) {
+	master, err := NewMasterKey(NewSeed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key := master.String(); !strings.HasPrefix(key, "pprv") {
+		t.Errorf("private key %s does not start with pprv", key)
+	}
+	if key := master.Neuter().String(); !strings.HasPrefix(key, "ppub") {
+		t.Errorf("public key %s does not start with ppub", key)
+	}
+
+	for _, magic := range [][]byte{bip32PrivateMagic, bip32PublicMagic} {
+		key := reencode(t, master.String(), func(data []byte) {
+			copy(data, magic)
+		})
+		if _, err := ParseExtendedKey(key); err == nil {
+			t.Errorf("parsed a key with the BIP32 version bytes %x", magic)
+		}
+	}
+}
+
+func TestAddWatchExtendedKeyGapLimit(t *testing.T) {
+	master, err := NewMasterKey(NewSeed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := master.Child(HardenedKeyStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	external, err := account.Child(ExternalChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := func(index uint32) string {
+		child, err := external.Child(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("%s", EncodeAddress(Version, PublicKeyHash(child.PublicKey())))
+	}
+
+	tests := []struct {
+		name string
+		gap  int
+		used []uint32
+		want int
+	}{
+		{"nothing used", 5, nil, 5},
+		{"first used", 5, []uint32{0}, 6},
+		{"used past the first gap", 3, []uint32{2, 5}, 9},
+		{"used beyond the gap", 3, []uint32{10}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			used := make(map[string]bool)
+			for _, index := range test.used {
+				used[address(index)] = true
+			}
+
+			ws := Wallets{Wallets: map[string]*Wallet{}, Scripts: map[string][]byte{}, WatchOnly: map[string]*WatchOnly{}}
+			addresses, err := ws.AddWatchExtendedKey(account.Neuter().String(), test.gap, func(address string) bool {
+				return used[address]
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addresses) != test.want {
+				t.Errorf("watched %d addresses, want %d", len(addresses), test.want)
+			}
+		})
+	}
+}
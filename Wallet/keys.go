@@ -0,0 +1,95 @@
+package Wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/mr-tron/base58"
+)
+
+const (
+	WIFVersion   = byte(0x80)
+	pemBlockType = "PRIVATE KEY"
+)
+
+func (w Wallet) WIF() string {
+	payload := append([]byte{WIFVersion}, PaddedBytes(w.PrivateKey.D)...)
+	payload = append(payload, Checksum(payload)...)
+
+	return string(Base58Encode(payload))
+}
+
+func DecodeWIF(wif string) (*Wallet, error) {
+	payload, err := base58.Decode(wif)
+	if err != nil {
+		return nil, errors.New("key is not base58 encoded")
+	}
+
+	if len(payload) != 1+KeyLength+ChecksumLength {
+		return nil, errors.New("key has invalid length")
+	}
+
+	data := payload[:1+KeyLength]
+	if !bytes.Equal(Checksum(data), payload[1+KeyLength:]) {
+		return nil, errors.New("key has an invalid checksum")
+	}
+
+	if data[0] != WIFVersion {
+		return nil, errors.New("key has an unknown version")
+	}
+
+	return walletFromKey(PrivateKeyFromBytes(data[1:]))
+}
+
+func (w Wallet) PEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(&w.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemBlockType, Bytes: der}), nil
+}
+
+func DecodePEM(content []byte) (*Wallet, error) {
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != pemBlockType {
+		return nil, errors.New("no PKCS#8 private key found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := key.(*ecdsa.PrivateKey)
+	if !ok || private.Curve != elliptic.P256() {
+		return nil, errors.New("key is not a P-256 ECDSA key")
+	}
+
+	return walletFromKey(PrivateKeyFromBytes(PaddedBytes(private.D)))
+}
+
+func walletFromKey(private ecdsa.PrivateKey) (*Wallet, error) {
+	if private.D.Sign() == 0 || private.D.Cmp(elliptic.P256().Params().N) >= 0 {
+		return nil, errors.New("private key is out of range")
+	}
+
+	return &Wallet{private, PublicKeyBytes(private.PublicKey)}, nil
+}
+
+func (ws *Wallets) ImportWallet(wallet *Wallet) (string, error) {
+	address := fmt.Sprintf("%s", wallet.Address())
+
+	if _, ok := ws.Wallets[address]; ok {
+		return "", fmt.Errorf("address %s is already in the wallet", address)
+	}
+
+	delete(ws.WatchOnly, address)
+	ws.Wallets[address] = wallet
+
+	return address, nil
+}
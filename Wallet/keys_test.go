@@ -0,0 +1,138 @@
+package Wallet
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"github.com/mr-tron/base58"
+	"os"
+	"testing"
+)
+
+// reencode changes the payload of an extended key and fixes its checksum.
+func reencode(t *testing.T, key string, change func(data []byte)) string {
+	payload, err := base58.Decode(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := payload[:extendedKeyLen]
+	change(data)
+
+	return string(Base58Encode(append(data, Checksum(data)...)))
+}
+
+func badChecksum(t *testing.T, key string) string {
+	payload, err := base58.Decode(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload[len(payload)-1] ^= 0xff
+
+	return string(Base58Encode(payload))
+}
+
+func TestParseExtendedKey(t *testing.T) {
+	master, err := NewMasterKey(NewSeed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	xprv := master.String()
+	keyStart := extendedKeyLen - 2*KeyLength
+
+	tests := []struct {
+		name string
+		key  string
+		ok   bool
+	}{
+		{"private", xprv, true},
+		{"public", master.Neuter().String(), true},
+		{"empty", "", false},
+		{"not base58", "0OIl", false},
+		{"bad checksum", badChecksum(t, xprv), false},
+		{"nonzero padding", reencode(t, xprv, func(data []byte) {
+			data[keyStart] = 1
+		}), false},
+		{"zero private key", reencode(t, xprv, func(data []byte) {
+			copy(data[keyStart+KeyLength:], make([]byte, KeyLength))
+		}), false},
+		{"private key equal to the order", reencode(t, xprv, func(data []byte) {
+			copy(data[keyStart+KeyLength:], PaddedBytes(elliptic.P256().Params().N))
+		}), false},
+		{"unknown version", reencode(t, xprv, func(data []byte) {
+			data[0] = 0xff
+		}), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := ParseExtendedKey(test.key)
+			if test.ok != (err == nil) {
+				t.Fatalf("got error %v, want success %t", err, test.ok)
+			}
+			if test.ok && key.String() != test.key {
+				t.Errorf("round trip gave %s", key.String())
+			}
+		})
+	}
+}
+
+func TestWIFRoundTrip(t *testing.T) {
+	w := MakeWallet()
+
+	decoded, err := DecodeWIF(w.WIF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.PublicKey, w.PublicKey) {
+		t.Error("decoded key has another public key")
+	}
+
+	pemKey, err := w.PEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err = DecodePEM(pemKey); err != nil || !bytes.Equal(decoded.PublicKey, w.PublicKey) {
+		t.Errorf("PEM round trip failed: %v", err)
+	}
+}
+
+func TestEncryptedWalletsStayLocked(t *testing.T) {
+	content := []byte("wallet content")
+	encrypted, err := encryptWallets(content, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, content) {
+		t.Fatal("encrypted wallet contains the plain content")
+	}
+	defer os.Unsetenv(PassphraseEnv)
+
+	tests := []struct {
+		passphrase string
+		err        bool
+	}{
+		{"", true},
+		{"wrong", true},
+		{"secret", false},
+	}
+
+	for _, test := range tests {
+		os.Setenv(PassphraseEnv, test.passphrase)
+
+		plain, passphrase, err := decryptWallets(encrypted)
+		if test.err {
+			if err == nil {
+				t.Errorf("passphrase %q unlocked the wallet", test.passphrase)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(plain, content) || passphrase != test.passphrase {
+			t.Errorf("passphrase %q: got %q %v", test.passphrase, plain, err)
+		}
+	}
+
+	plain, passphrase, err := decryptWallets(content)
+	if err != nil || passphrase != "" || !bytes.Equal(plain, content) {
+		t.Errorf("unencrypted content came back as %q %q %v", plain, passphrase, err)
+	}
+}
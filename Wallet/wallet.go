@@ -6,13 +6,21 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
 	"github.com/koushamad/blockchain/Handler"
+	"github.com/mr-tron/base58"
 	"golang.org/x/crypto/ripemd160"
+	"math/big"
 )
 
 const (
 	ChecksumLength = 4
 	Version        = byte(0x00)
+	ScriptVersion  = byte(0x05)
+	KeyLength      = 32
+	walletFormat   = 1
 )
 
 type Wallet struct {
@@ -20,23 +28,120 @@ type Wallet struct {
 	PublicKey  []byte
 }
 
+// walletData is the stored form of a wallet, Format 0 is what was written
+// before the format was recorded and has the same fields.
+type walletData struct {
+	Format    int
+	D         []byte
+	PublicKey []byte
+}
+
+// legacyWallet is the layout of wallet files from before keys were stored as
+// scalars, gob encoded the whole ecdsa.PrivateKey along with its curve.
+type legacyWallet struct {
+	PrivateKey legacyPrivateKey
+	PublicKey  []byte
+}
+
+type legacyPrivateKey struct {
+	D *big.Int
+}
+
+type legacyWallets struct {
+	Wallets map[string]*legacyWallet
+}
+
 func (w Wallet) Address() []byte {
 	pubHash := PublicKeyHash(w.PublicKey)
 
-	versionedHash := append([]byte{Version}, pubHash...)
+	return EncodeAddress(Version, pubHash)
+}
+
+func (w Wallet) GobEncode() ([]byte, error) {
+	var buffer bytes.Buffer
+
+	data := walletData{walletFormat, PaddedBytes(w.PrivateKey.D), w.PublicKey}
+	err := gob.NewEncoder(&buffer).Encode(data)
+
+	return buffer.Bytes(), err
+}
+
+func (w *Wallet) GobDecode(content []byte) error {
+	var data walletData
+
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data); err != nil {
+		return err
+	}
+
+	if data.Format > walletFormat {
+		return fmt.Errorf("wallet format %d is newer than the supported format %d", data.Format, walletFormat)
+	}
+
+	w.PrivateKey = PrivateKeyFromBytes(data.D)
+	w.PublicKey = data.PublicKey
+
+	return nil
+}
+
+// decodeLegacyWallets reads the wallets of a file in the legacy layout, every
+// private key has to match the public key stored with it. Legacy public keys
+// are the unpadded coordinates, so they are compared in that form.
+func decodeLegacyWallets(content []byte) (map[string]*Wallet, error) {
+	var legacy legacyWallets
+
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&legacy); err != nil {
+		return nil, err
+	}
+
+	wallets := make(map[string]*Wallet)
+	for address, old := range legacy.Wallets {
+		if old.PrivateKey.D == nil {
+			return nil, fmt.Errorf("wallet %s has no private key", address)
+		}
+
+		wallet := Wallet{PrivateKeyFromBytes(PaddedBytes(old.PrivateKey.D)), old.PublicKey}
+		public := wallet.PrivateKey.PublicKey
+		if !bytes.Equal(append(public.X.Bytes(), public.Y.Bytes()...), old.PublicKey) {
+			return nil, fmt.Errorf("private key of wallet %s does not match its public key", address)
+		}
+		wallets[address] = &wallet
+	}
+
+	return wallets, nil
+}
+
+func EncodeAddress(version byte, hash []byte) []byte {
+	versionedHash := append([]byte{version}, hash...)
 	checksum := Checksum(versionedHash)
 
 	fullHash := append(versionedHash, checksum...)
-	address := Base58Encode(fullHash)
 
-	return address
+	return Base58Encode(fullHash)
+}
+
+func DecodeAddress(address string) (byte, []byte, error) {
+	if !ValidateAddress(address) {
+		return 0, nil, errors.New("address is not valid")
+	}
+
+	fullHash := Base58Decode([]byte(address))
+
+	return fullHash[0], fullHash[1 : len(fullHash)-ChecksumLength], nil
 }
 
 func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-ChecksumLength:]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-ChecksumLength]
-	targetChecksum := Checksum(append([]byte{Version}, pubKeyHash...))
+	fullHash, err := base58.Decode(address)
+	if err != nil || len(fullHash) <= ChecksumLength+1 {
+		return false
+	}
+
+	version := fullHash[0]
+	if version != Version && version != ScriptVersion {
+		return false
+	}
+
+	actualChecksum := fullHash[len(fullHash)-ChecksumLength:]
+	targetChecksum := Checksum(fullHash[:len(fullHash)-ChecksumLength])
 
 	return bytes.Compare(actualChecksum, targetChecksum) == 0
 }
@@ -47,8 +152,7 @@ func NewKeyPair() (ecdsa.PrivateKey, []byte) {
 	private, err := ecdsa.GenerateKey(curve, rand.Reader)
 	Handler.Handle(err)
 
-	public := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
-	return *private, public
+	return *private, PublicKeyBytes(private.PublicKey)
 }
 
 func MakeWallet() *Wallet {
@@ -58,6 +162,43 @@ func MakeWallet() *Wallet {
 	return &wallet
 }
 
+func PublicKeyBytes(key ecdsa.PublicKey) []byte {
+	return append(PaddedBytes(key.X), PaddedBytes(key.Y)...)
+}
+
+func PrivateKeyFromBytes(d []byte) ecdsa.PrivateKey {
+	curve := elliptic.P256()
+
+	private := ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(PaddedBytes(private.D))
+
+	return private
+}
+
+func ParsePublicKey(pubKey []byte) (*ecdsa.PublicKey, error) {
+	if len(pubKey) == 0 || len(pubKey)%2 != 0 {
+		return nil, errors.New("public key has invalid length")
+	}
+
+	curve := elliptic.P256()
+	keyLen := len(pubKey)
+	x := new(big.Int).SetBytes(pubKey[:(keyLen / 2)])
+	y := new(big.Int).SetBytes(pubKey[(keyLen / 2):])
+
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("public key is not on the curve")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func PaddedBytes(num *big.Int) []byte {
+	buffer := make([]byte, KeyLength)
+
+	return num.FillBytes(buffer)
+}
+
 func PublicKeyHash(pubKey []byte) []byte {
 	pubHash := sha256.Sum256(pubKey)
 
@@ -0,0 +1,108 @@
+package Wallet
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"testing"
+)
+
+func TestWalletGobFormats(t *testing.T) {
+	w := MakeWallet()
+
+	encode := func(data interface{}) []byte {
+		var buffer bytes.Buffer
+		if err := gob.NewEncoder(&buffer).Encode(data); err != nil {
+			t.Fatal(err)
+		}
+		return buffer.Bytes()
+	}
+
+	current, err := w.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unversioned := encode(struct {
+		D         []byte
+		PublicKey []byte
+	}{PaddedBytes(w.PrivateKey.D), w.PublicKey})
+	future := encode(walletData{walletFormat + 1, PaddedBytes(w.PrivateKey.D), w.PublicKey})
+
+	tests := []struct {
+		name    string
+		content []byte
+		ok      bool
+	}{
+		{"current format", current, true},
+		{"before the format was recorded", unversioned, true},
+		{"newer format", future, false},
+		{"garbage", []byte("not a wallet"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var decoded Wallet
+			err := decoded.GobDecode(test.content)
+			if test.ok != (err == nil) {
+				t.Fatalf("got error %v, want success %t", err, test.ok)
+			}
+			if test.ok && !bytes.Equal(decoded.Address(), w.Address()) {
+				t.Errorf("decoded %s, want %s", decoded.Address(), w.Address())
+			}
+		})
+	}
+}
+
+// TestLegacyWalletFile loads the wallet file committed with the repository,
+// it predates the scalar key layout.
+func TestLegacyWalletFile(t *testing.T) {
+	content, err := ioutil.ReadFile("../tmp/wallet.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, err := decodeLegacyWallets(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wallets) == 0 {
+		t.Fatal("no wallets decoded")
+	}
+
+	for address, wallet := range wallets {
+		if got := string(wallet.Address()); got != address {
+			t.Errorf("wallet stored as %s has address %s", address, got)
+		}
+	}
+}
+
+// TestLegacyShortCoordinate stores a key with a coordinate below 32 bytes the
+// way the legacy layout did, without padding.
+func TestLegacyShortCoordinate(t *testing.T) {
+	var legacy legacyWallets
+	for len(legacy.Wallets) == 0 {
+		private, _ := NewKeyPair()
+		if len(private.X.Bytes()) == KeyLength && len(private.Y.Bytes()) == KeyLength {
+			continue
+		}
+
+		public := append(private.X.Bytes(), private.Y.Bytes()...)
+		address := string(Wallet{private, public}.Address())
+		legacy.Wallets = map[string]*legacyWallet{address: {legacyPrivateKey{private.D}, public}}
+	}
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, err := decodeLegacyWallets(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for address, wallet := range wallets {
+		if got := string(wallet.Address()); got != address {
+			t.Errorf("wallet stored as %s has address %s", address, got)
+		}
+	}
+}
@@ -2,8 +2,8 @@ package Wallet
 
 import (
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"github.com/koushamad/blockchain/Handler"
 	"io/ioutil"
@@ -13,12 +13,22 @@ import (
 const walletFile = "./tmp/wallet.data"
 
 type Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets    map[string]*Wallet
+	Scripts    map[string][]byte
+	WatchOnly  map[string]*WatchOnly
+	Change     map[string]bool
+	Master     *ExtendedKey
+	NextIndex  uint32
+	NextChange uint32
+	passphrase string
 }
 
 func CreateWallets() (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.Scripts = make(map[string][]byte)
+	wallets.WatchOnly = make(map[string]*WatchOnly)
+	wallets.Change = make(map[string]bool)
 	err := wallets.LoadFile()
 
 	return &wallets, err
@@ -32,6 +42,65 @@ func (ws *Wallets) AddWallet() string {
 	return address
 }
 
+func (ws *Wallets) Account() *ExtendedKey {
+	if ws.Master == nil {
+		master, err := NewMasterKey(NewSeed())
+		Handler.Handle(err)
+		ws.Master = master
+	}
+
+	account, err := ws.Master.Child(HardenedKeyStart)
+	Handler.Handle(err)
+
+	return account
+}
+
+func (ws *Wallets) AddHDWallet() string {
+	wallet, index := ws.deriveWallet(ExternalChain, ws.NextIndex)
+	ws.NextIndex = index + 1
+
+	address := fmt.Sprintf("%s", wallet.Address())
+	ws.Wallets[address] = wallet
+	return address
+}
+
+func (ws *Wallets) PeekChangeAddress() string {
+	wallet, _ := ws.deriveWallet(InternalChain, ws.NextChange)
+
+	return fmt.Sprintf("%s", wallet.Address())
+}
+
+func (ws *Wallets) AddChangeWallet() string {
+	wallet, index := ws.deriveWallet(InternalChain, ws.NextChange)
+	ws.NextChange = index + 1
+
+	address := fmt.Sprintf("%s", wallet.Address())
+	ws.Wallets[address] = wallet
+	ws.Change[address] = true
+	return address
+}
+
+func (ws *Wallets) IsChange(address string) bool {
+	return ws.Change[address]
+}
+
+func (ws *Wallets) deriveWallet(chain, index uint32) (*Wallet, uint32) {
+	keys, err := ws.Account().Child(chain)
+	Handler.Handle(err)
+
+	for ; ; index++ {
+		key, err := keys.Child(index)
+		if err != nil {
+			continue
+		}
+
+		wallet, err := key.Wallet()
+		Handler.Handle(err)
+
+		return wallet, index
+	}
+}
+
 func (ws *Wallets) GetAllAddresses() map[string]*Wallet {
 	addresses := make(map[string]*Wallet)
 
@@ -43,23 +112,69 @@ func (ws *Wallets) GetAllAddresses() map[string]*Wallet {
 }
 
 func (ws *Wallets) GetWallet(address string) Wallet {
-	return *ws.Wallets[address]
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		if _, watched := ws.WatchOnly[address]; watched {
+			Handler.Handle(fmt.Errorf("address %s is watch-only and cannot sign", address))
+		}
+		Handler.Handle(errors.New("address is not in the wallet"))
+	}
+
+	return *wallet
+}
+
+func (ws *Wallets) FindWalletByPublicKey(pubKey []byte) (*Wallet, bool) {
+	for _, wallet := range ws.Wallets {
+		if bytes.Equal(wallet.PublicKey, pubKey) {
+			return wallet, true
+		}
+	}
+
+	return nil, false
+}
+
+func (ws *Wallets) AddScript(script []byte) string {
+	address := fmt.Sprintf("%s", EncodeAddress(ScriptVersion, PublicKeyHash(script)))
+
+	ws.Scripts[address] = script
+	return address
+}
+
+func (ws *Wallets) GetScript(address string) ([]byte, bool) {
+	script, ok := ws.Scripts[address]
+
+	return script, ok
+}
+
+func (ws *Wallets) GetAllScripts() map[string][]byte {
+	scripts := make(map[string][]byte)
+
+	for address, script := range ws.Scripts {
+		scripts[address] = script
+	}
+
+	return scripts
 }
 
 func (ws *Wallets) SaveFile() {
 	var content bytes.Buffer
-	gob.Register(elliptic.P256())
 	encoder := gob.NewEncoder(&content)
 	err := encoder.Encode(ws)
 	Handler.Handle(err)
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	data := content.Bytes()
+	if ws.Encrypted() {
+		data, err = encryptWallets(data, ws.passphrase)
+		Handler.Handle(err)
+	}
+
+	err = ioutil.WriteFile(walletFile, data, 0644)
 	Handler.Handle(err)
 }
 
 func (ws *Wallets) LoadFile() error {
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
-		return err
+		return nil
 	}
 
 	var wallets Wallets
@@ -68,14 +183,34 @@ func (ws *Wallets) LoadFile() error {
 		return err
 	}
 
-	gob.Register(elliptic.P256())
+	fileContent, ws.passphrase, err = decryptWallets(fileContent)
+	if err != nil {
+		return err
+	}
+
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&wallets)
 	if err != nil {
-		return err
+		legacy, legacyErr := decodeLegacyWallets(fileContent)
+		if legacyErr != nil {
+			return err
+		}
+		wallets = Wallets{Wallets: legacy}
 	}
 
 	ws.Wallets = wallets.Wallets
+	if wallets.Scripts != nil {
+		ws.Scripts = wallets.Scripts
+	}
+	if wallets.WatchOnly != nil {
+		ws.WatchOnly = wallets.WatchOnly
+	}
+	if wallets.Change != nil {
+		ws.Change = wallets.Change
+	}
+	ws.Master = wallets.Master
+	ws.NextIndex = wallets.NextIndex
+	ws.NextChange = wallets.NextChange
 
 	return nil
 }
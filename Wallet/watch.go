@@ -0,0 +1,113 @@
+package Wallet
+
+import (
+	"errors"
+	"fmt"
+)
+
+const DefaultGapLimit = 20
+
+type WatchOnly struct {
+	PublicKey   []byte
+	ExtendedKey string
+	Index       uint32
+}
+
+func (ws *Wallets) AddWatchAddress(address string) (string, error) {
+	if !ValidateAddress(address) {
+		return "", errors.New("address is not valid")
+	}
+
+	return address, ws.addWatchOnly(address, &WatchOnly{})
+}
+
+func (ws *Wallets) AddWatchPublicKey(pubKey []byte) (string, error) {
+	if _, err := ParsePublicKey(pubKey); err != nil {
+		return "", err
+	}
+
+	address := fmt.Sprintf("%s", EncodeAddress(Version, PublicKeyHash(pubKey)))
+
+	return address, ws.addWatchOnly(address, &WatchOnly{PublicKey: pubKey})
+}
+
+// AddWatchExtendedKey watches the external addresses of an extended public key
+// until gap addresses in a row were never used, used reports whether the chain
+// has seen an address.
+func (ws *Wallets) AddWatchExtendedKey(key string, gap int, used func(address string) bool) ([]string, error) {
+	if gap < 1 {
+		return nil, errors.New("gap limit must be at least 1")
+	}
+
+	extended, err := ParseExtendedKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if extended.Private {
+		return nil, errors.New("extended key is private, import the public key instead")
+	}
+
+	external, err := extended.Child(ExternalChain)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	unused := 0
+	for index := uint32(0); unused < gap; index++ {
+		child, err := external.Child(index)
+		if err != nil {
+			continue
+		}
+
+		address := fmt.Sprintf("%s", EncodeAddress(Version, PublicKeyHash(child.Key)))
+		if used(address) {
+			unused = 0
+		} else {
+			unused++
+		}
+
+		if _, ok := ws.WatchOnly[address]; ok {
+			addresses = append(addresses, address)
+			continue
+		}
+
+		err = ws.addWatchOnly(address, &WatchOnly{PublicKey: child.Key, ExtendedKey: key, Index: index})
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+
+	return addresses, nil
+}
+
+func (ws *Wallets) addWatchOnly(address string, watch *WatchOnly) error {
+	if _, ok := ws.Wallets[address]; ok {
+		return fmt.Errorf("address %s is already in the wallet with its private key", address)
+	}
+
+	if _, ok := ws.Scripts[address]; ok {
+		return fmt.Errorf("address %s is already in the wallet with its redeem script", address)
+	}
+
+	ws.WatchOnly[address] = watch
+	return nil
+}
+
+func (ws *Wallets) IsWatchOnly(address string) bool {
+	_, ok := ws.WatchOnly[address]
+
+	return ok
+}
+
+func (ws *Wallets) GetAllWatchOnly() map[string]*WatchOnly {
+	addresses := make(map[string]*WatchOnly)
+
+	for address, watch := range ws.WatchOnly {
+		addresses[address] = watch
+	}
+
+	return addresses
+}
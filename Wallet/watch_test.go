@@ -0,0 +1,58 @@
+package Wallet
+
+import (
+	"testing"
+)
+
+func newTestWallets() *Wallets {
+	return &Wallets{
+		Wallets:   map[string]*Wallet{},
+		Scripts:   map[string][]byte{},
+		WatchOnly: map[string]*WatchOnly{},
+		Change:    map[string]bool{},
+	}
+}
+
+func TestWatchOnly(t *testing.T) {
+	ws := newTestWallets()
+
+	if _, err := ws.AddWatchAddress("address"); err == nil {
+		t.Error("watched an invalid address")
+	}
+	if _, err := ws.AddWatchPublicKey([]byte{1, 2, 3}); err == nil {
+		t.Error("watched an invalid public key")
+	}
+
+	watched := MakeWallet()
+	address, err := ws.AddWatchPublicKey(watched.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != string(watched.Address()) || !ws.IsWatchOnly(address) {
+		t.Errorf("watched %s, want %s", address, watched.Address())
+	}
+
+	held := ws.AddWallet()
+	if _, err := ws.AddWatchAddress(held); err == nil || ws.IsWatchOnly(held) {
+		t.Error("watched an address whose private key is in the wallet")
+	}
+
+	signer := newTestWallets()
+	first := signer.AddHDWallet()
+	if _, err := ws.AddWatchExtendedKey(signer.Master.String(), 1, func(string) bool { return false }); err == nil {
+		t.Error("watched a private extended key")
+	}
+
+	addresses, err := ws.AddWatchExtendedKey(signer.Account().Neuter().String(), 1, func(address string) bool {
+		return address == first
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 2 || addresses[0] != first || !ws.IsWatchOnly(first) {
+		t.Errorf("watched %v, want %s and the next address", addresses, first)
+	}
+	if next := signer.AddHDWallet(); addresses[1] != next {
+		t.Errorf("second watched address is %s, the wallet derives %s", addresses[1], next)
+	}
+}
@@ -3,7 +3,7 @@ module github.com/koushamad/blockchain
 go 1.16
 
 require (
-	github.com/dgraph-io/badger v1.6.2 // indirect
-	github.com/mr-tron/base58 v1.2.0 // indirect
-	golang.org/x/crypto v0.0.0-20220427172511-eb4f295cb31f // indirect
+	github.com/dgraph-io/badger v1.6.2
+	github.com/mr-tron/base58 v1.2.0
+	golang.org/x/crypto v0.0.0-20220427172511-eb4f295cb31f
 )